@@ -22,6 +22,21 @@ type Statement interface {
 	statementNode()
 }
 
+// StatementPos 语句开始的位置，即语句第一个 Token 的位置。未知的语句返回无效的位置。
+func StatementPos(statement Statement) token.Position {
+	switch s := statement.(type) {
+	case *LetStatement:
+		return s.Token.Pos
+	case *ReturnStatement:
+		return s.Token.Pos
+	case *ExpressionStatement:
+		return s.Token.Pos
+	case *BlockStatement:
+		return s.Token.Pos
+	}
+	return token.Position{}
+}
+
 type Expression interface {
 	Node
 	expressionNode()
@@ -81,6 +96,10 @@ func (i *IfExpression) expressionNode() {
 type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
+	// ParameterTypes 参数的类型标注，与 Parameters 一一对应，没有标注的参数为 nil
+	ParameterTypes []*TypeAnnotation
+	// ReturnType 返回值的类型标注，没有标注时为 nil
+	ReturnType *TypeAnnotation
 	Body       *BlockStatement
 }
 
@@ -91,13 +110,20 @@ func (f *FunctionLiteral) TokenLiteral() string {
 func (f *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	var params []string
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
+	for i, p := range f.Parameters {
+		param := p.String()
+		if i < len(f.ParameterTypes) && f.ParameterTypes[i] != nil {
+			param += ": " + f.ParameterTypes[i].String()
+		}
+		params = append(params, param)
 	}
 	out.WriteString(f.TokenLiteral())
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ","))
 	out.WriteString(") ")
+	if f.ReturnType != nil {
+		out.WriteString(": " + f.ReturnType.String() + " ")
+	}
 	out.WriteString(f.Body.String())
 	return out.String()
 }
@@ -168,7 +194,11 @@ func (p *Program) TokenLiteral() string {
 type LetStatement struct {
 	Token token.Token
 	Name  *Identifier
+	// Type 绑定的类型标注，没有标注时为 nil
+	Type  *TypeAnnotation
 	Value Expression
+	// Exported 以 export 开头的顶层绑定，模块导入时可以访问
+	Exported bool
 }
 
 type PrefixExpression struct {
@@ -192,8 +222,14 @@ func (p *PrefixExpression) expressionNode() {
 
 func (l *LetStatement) String() string {
 	var out bytes.Buffer
+	if l.Exported {
+		out.WriteString("export ")
+	}
 	out.WriteString(l.TokenLiteral() + " ")
 	out.WriteString(l.Name.String())
+	if l.Type != nil {
+		out.WriteString(": " + l.Type.String())
+	}
 	out.WriteString(" = ")
 	if l.Value != nil {
 		out.WriteString(l.Value.String())
@@ -365,3 +401,33 @@ func (ie *IndexExpression) String() string {
 	out.WriteString("])")
 	return out.String()
 }
+
+// ImportExpression 导入模块表达式，例如 import "lib/math"
+type ImportExpression struct {
+	Token token.Token // the 'import' token
+	Path  *StringLiteral
+}
+
+func (ie *ImportExpression) expressionNode()      {}
+func (ie *ImportExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *ImportExpression) String() string {
+	return ie.TokenLiteral() + ` "` + ie.Path.Value + `"`
+}
+
+// TypeAnnotation 类型标注，例如 int、fn 和 [string]
+type TypeAnnotation struct {
+	Token token.Token
+	// Name 类型的名字，数组类型为 "array"
+	Name string
+	// Elem 写成 [T] 的数组类型的元素类型，其他情况为 nil
+	Elem *TypeAnnotation
+}
+
+func (t *TypeAnnotation) TokenLiteral() string { return t.Token.Literal }
+
+func (t *TypeAnnotation) String() string {
+	if t.Elem != nil {
+		return "[" + t.Elem.String() + "]"
+	}
+	return t.Name
+}
@@ -33,3 +33,45 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", p.String())
 	}
 }
+
+func TestDump(t *testing.T) {
+	p := &Program{Statements: []Statement{
+		&ExpressionStatement{
+			Token: token.Token{Type: token.INT, Literal: "1"},
+			Expression: &InfixExpression{
+				Token:    token.Token{Type: token.PLUS, Literal: "+"},
+				Operator: "+",
+				Left:     &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1},
+				Right:    &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x"}, Value: "x"},
+			},
+		},
+	}}
+	expected := `Program "1"
+  Statements[0]: ExpressionStatement "1"
+    Expression: InfixExpression "+"
+      Left: IntegerLiteral "1"
+      Right: Identifier "x"
+`
+	if got := Dump(p); got != expected {
+		t.Errorf("Dump() wrong.\ngot=%s\nwant=%s", got, expected)
+	}
+}
+
+func TestStatementPos(t *testing.T) {
+	pos := token.Position{Line: 2, Column: 3}
+	tests := []struct {
+		statement Statement
+		expected  token.Position
+	}{
+		{&LetStatement{Token: token.Token{Type: token.LET, Literal: "let", Pos: pos}}, pos},
+		{&ReturnStatement{Token: token.Token{Type: token.RETURN, Literal: "return", Pos: pos}}, pos},
+		{&ExpressionStatement{Token: token.Token{Type: token.INT, Literal: "1", Pos: pos}}, pos},
+		{&BlockStatement{Token: token.Token{Type: token.LBRACE, Literal: "{", Pos: pos}}, pos},
+		{nil, token.Position{}},
+	}
+	for _, tt := range tests {
+		if got := StatementPos(tt.statement); got != tt.expected {
+			t.Errorf("StatementPos(%T) wrong. got=%v, want=%v", tt.statement, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	nodeType           = reflect.TypeOf((*Node)(nil)).Elem()
+	typeAnnotationType = reflect.TypeOf((*TypeAnnotation)(nil))
+)
+
+// Dump 以缩进树的形式打印 AST，每行一个节点，节点后面是它的 token 字面。
+// 子节点前面带有字段名，没有写出的类型标注不打印。用于调试和 REPL 的 :ast 命令。
+func Dump(node Node) string {
+	var out bytes.Buffer
+	dumpNode(&out, "", node, 0)
+	return out.String()
+}
+
+// dumpNode 打印单个节点和它的子节点
+func dumpNode(out *bytes.Buffer, label string, node Node, depth int) {
+	value := reflect.ValueOf(node)
+	out.WriteString(strings.Repeat("  ", depth))
+	if label != "" {
+		out.WriteString(label + ": ")
+	}
+	if node == nil || value.Kind() == reflect.Pointer && value.IsNil() {
+		out.WriteString("nil\n")
+		return
+	}
+	elem := reflect.Indirect(value)
+	out.WriteString(elem.Type().Name())
+	if literal := node.TokenLiteral(); literal != "" {
+		out.WriteString(fmt.Sprintf(" %q", literal))
+	}
+	out.WriteString("\n")
+	if elem.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < elem.NumField(); i++ {
+		field := elem.Field(i)
+		name := elem.Type().Field(i).Name
+		switch {
+		case field.Type() == typeAnnotationType && field.IsNil():
+		case field.Type().Implements(nodeType):
+			child, _ := field.Interface().(Node)
+			dumpNode(out, name, child, depth+1)
+		case field.Kind() == reflect.Slice && field.Type().Elem().Implements(nodeType):
+			for j := 0; j < field.Len(); j++ {
+				if field.Type().Elem() == typeAnnotationType && field.Index(j).IsNil() {
+					continue
+				}
+				child, _ := field.Index(j).Interface().(Node)
+				dumpNode(out, fmt.Sprintf("%s[%d]", name, j), child, depth+1)
+			}
+		}
+	}
+}
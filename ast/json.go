@@ -0,0 +1,203 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hollykbuck/muskmelon/token"
+	"reflect"
+	"unicode"
+	"unicode/utf8"
+)
+
+// nodeKinds JSON 中的 kind 对应的节点类型，新增节点类型时需要加到这里
+var nodeKinds = map[string]reflect.Type{}
+
+func init() {
+	for _, node := range []Node{
+		&Program{},
+		&LetStatement{},
+		&ReturnStatement{},
+		&ExpressionStatement{},
+		&BlockStatement{},
+		&Identifier{},
+		&IntegerLiteral{},
+		&Boolean{},
+		&StringLiteral{},
+		&PrefixExpression{},
+		&InfixExpression{},
+		&IfExpression{},
+		&FunctionLiteral{},
+		&CallExpression{},
+		&ArrayLiteral{},
+		&IndexExpression{},
+		&ImportExpression{},
+		&TypeAnnotation{},
+	} {
+		typ := reflect.TypeOf(node).Elem()
+		nodeKinds[typ.Name()] = typ
+	}
+}
+
+var tokenType = reflect.TypeOf(token.Token{})
+
+// jsonToken token 的 JSON 表示
+type jsonToken struct {
+	Type    token.TokenType `json:"type"`
+	Literal string          `json:"literal"`
+	Pos     jsonPosition    `json:"pos"`
+}
+
+type jsonPosition struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// EncodeJSON 将 AST 编码为缩进的 JSON。
+// 每个节点是一个对象，kind 是节点类型，token 是节点的 token 和位置，其余的键是首字母小写的字段名。
+// 对象的键按字母顺序排列，相同的 AST 总是得到相同的输出。
+func EncodeJSON(node Node) ([]byte, error) {
+	data, err := json.MarshalIndent(encodeNode(node), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// DecodeJSON 解码 EncodeJSON 的输出
+func DecodeJSON(data []byte) (Node, error) {
+	return decodeNode(data)
+}
+
+// encodeNode 将节点转换为可以直接交给 encoding/json 的值
+func encodeNode(node Node) interface{} {
+	value := reflect.ValueOf(node)
+	if node == nil || value.Kind() == reflect.Pointer && value.IsNil() {
+		return nil
+	}
+	elem := value.Elem()
+	m := map[string]interface{}{"kind": elem.Type().Name()}
+	for i := 0; i < elem.NumField(); i++ {
+		field := elem.Field(i)
+		key := jsonKey(elem.Type().Field(i).Name)
+		switch {
+		case field.Type() == tokenType:
+			tok := field.Interface().(token.Token)
+			m[key] = jsonToken{
+				Type:    tok.Type,
+				Literal: tok.Literal,
+				Pos:     jsonPosition{Offset: tok.Pos.Offset, Line: tok.Pos.Line, Column: tok.Pos.Column},
+			}
+		case field.Type().Implements(nodeType):
+			child, _ := field.Interface().(Node)
+			m[key] = encodeNode(child)
+		case field.Kind() == reflect.Slice && field.Type().Elem().Implements(nodeType):
+			// nil 和空的列表分别编码为 null 和 []，解码后与原来的 AST 完全相同
+			if field.IsNil() {
+				m[key] = nil
+				continue
+			}
+			children := make([]interface{}, field.Len())
+			for j := range children {
+				child, _ := field.Index(j).Interface().(Node)
+				children[j] = encodeNode(child)
+			}
+			m[key] = children
+		default:
+			m[key] = field.Interface()
+		}
+	}
+	return m
+}
+
+// decodeNode 解码一个节点，JSON 的 null 解码为 nil
+func decodeNode(data json.RawMessage) (Node, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, nil
+	}
+	var kind string
+	if err := json.Unmarshal(m["kind"], &kind); err != nil {
+		return nil, fmt.Errorf("node without kind: %s", data)
+	}
+	typ, ok := nodeKinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown node kind %q", kind)
+	}
+	value := reflect.New(typ)
+	elem := value.Elem()
+	for i := 0; i < elem.NumField(); i++ {
+		field := elem.Field(i)
+		name := typ.Field(i).Name
+		raw, ok := m[jsonKey(name)]
+		if !ok {
+			continue
+		}
+		if err := decodeField(field, raw); err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", kind, name, err)
+		}
+	}
+	return value.Interface().(Node), nil
+}
+
+// decodeField 解码节点的一个字段
+func decodeField(field reflect.Value, raw json.RawMessage) error {
+	switch {
+	case field.Type() == tokenType:
+		var tok jsonToken
+		if err := json.Unmarshal(raw, &tok); err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(token.Token{
+			Type:    tok.Type,
+			Literal: tok.Literal,
+			Pos:     token.Position{Offset: tok.Pos.Offset, Line: tok.Pos.Line, Column: tok.Pos.Column},
+		}))
+	case field.Type().Implements(nodeType):
+		return decodeChild(field, raw)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Implements(nodeType):
+		var list []json.RawMessage
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return err
+		}
+		if list == nil {
+			return nil
+		}
+		slice := reflect.MakeSlice(field.Type(), len(list), len(list))
+		for j, item := range list {
+			if err := decodeChild(slice.Index(j), item); err != nil {
+				return fmt.Errorf("[%d]: %w", j, err)
+			}
+		}
+		field.Set(slice)
+	default:
+		return json.Unmarshal(raw, field.Addr().Interface())
+	}
+	return nil
+}
+
+// decodeChild 解码子节点并检查它能否放进字段
+func decodeChild(field reflect.Value, raw json.RawMessage) error {
+	child, err := decodeNode(raw)
+	if err != nil {
+		return err
+	}
+	if child == nil {
+		return nil
+	}
+	value := reflect.ValueOf(child)
+	if !value.Type().AssignableTo(field.Type()) {
+		return fmt.Errorf("cannot use %T as %s", child, field.Type())
+	}
+	field.Set(value)
+	return nil
+}
+
+// jsonKey 字段名首字母小写作为 JSON 的键
+func jsonKey(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(r)) + name[size:]
+}
@@ -0,0 +1,73 @@
+package ast
+
+import (
+	"github.com/hollykbuck/muskmelon/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	pos := func(offset int) token.Position { return token.Position{Offset: offset, Line: 1, Column: offset + 1} }
+	p := &Program{Statements: []Statement{
+		&LetStatement{
+			Token: token.Token{Type: token.LET, Literal: "let", Pos: pos(0)},
+			Name:  &Identifier{Token: token.Token{Type: token.IDENT, Literal: "f", Pos: pos(4)}, Value: "f"},
+			Value: &FunctionLiteral{
+				Token:      token.Token{Type: token.FUNCTION, Literal: "fn", Pos: pos(8)},
+				Parameters: []*Identifier{{Token: token.Token{Type: token.IDENT, Literal: "x", Pos: pos(11)}, Value: "x"}},
+				Body: &BlockStatement{
+					Token: token.Token{Type: token.LBRACE, Literal: "{", Pos: pos(14)},
+					Statements: []Statement{&ExpressionStatement{
+						Token: token.Token{Type: token.BANG, Literal: "!", Pos: pos(16)},
+						Expression: &PrefixExpression{
+							Token:    token.Token{Type: token.BANG, Literal: "!", Pos: pos(16)},
+							Operator: "!",
+							Right:    &Boolean{Token: token.Token{Type: token.TRUE, Literal: "true", Pos: pos(17)}, Value: true},
+						},
+					}},
+				},
+			},
+		},
+		&ReturnStatement{Token: token.Token{Type: token.RETURN, Literal: "return", Pos: pos(25)}},
+	}}
+	data, err := EncodeJSON(p)
+	if err != nil {
+		t.Fatalf("EncodeJSON error: %s", err)
+	}
+	decoded, err := DecodeJSON(data)
+	if err != nil {
+		t.Fatalf("DecodeJSON error: %s", err)
+	}
+	if !reflect.DeepEqual(decoded, p) {
+		t.Errorf("round trip mismatch.\ngot=%s\nwant=%s", Dump(decoded), Dump(p))
+	}
+	again, err := EncodeJSON(decoded)
+	if err != nil {
+		t.Fatalf("EncodeJSON error: %s", err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("encoding is not stable.\ngot=%s\nwant=%s", again, data)
+	}
+	if !strings.Contains(string(data), `"returnValue": null`) {
+		t.Errorf("nil child should be encoded as null. got=%s", data)
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind": "Nope"}`, `unknown node kind "Nope"`},
+		{`{"token": {}}`, "node without kind"},
+		{`{"kind": "LetStatement", "name": {"kind": "IntegerLiteral"}}`, "LetStatement.Name: cannot use *ast.IntegerLiteral as *ast.Identifier"},
+		{`{"kind": "Program", "statements": [{"kind": "Identifier"}]}`, "Program.Statements: [0]: cannot use *ast.Identifier as ast.Statement"},
+	}
+	for _, tt := range tests {
+		_, err := DecodeJSON([]byte(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("DecodeJSON(%s) error wrong. got=%v, want=%q", tt.input, err, tt.expected)
+		}
+	}
+}
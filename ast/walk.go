@@ -0,0 +1,192 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Visitor Walk 遍历 AST 时对每个节点调用 Visit。
+// 返回的 Visitor 不为 nil 时用它继续遍历节点的子节点，最后以 nil 再调用一次 Visit。
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk 深度优先遍历 AST。nil 和包含 nil 指针的节点会被跳过，有语法错误的 AST 中可能有这样的子节点。
+// 新增节点类型时需要在这里加上对应的分支，否则遍历到该节点时会 panic。
+func Walk(v Visitor, node Node) {
+	if isNil(node) {
+		return
+	}
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+	case *LetStatement:
+		Walk(v, n.Name)
+		Walk(v, n.Type)
+		Walk(v, n.Value)
+	case *ReturnStatement:
+		Walk(v, n.ReturnValue)
+	case *ExpressionStatement:
+		Walk(v, n.Expression)
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+	case *Identifier, *IntegerLiteral, *Boolean, *StringLiteral:
+		// 没有子节点
+	case *PrefixExpression:
+		Walk(v, n.Right)
+	case *InfixExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case *IfExpression:
+		Walk(v, n.Condition)
+		Walk(v, n.Consequence)
+		Walk(v, n.Alternative)
+	case *FunctionLiteral:
+		for _, param := range n.Parameters {
+			Walk(v, param)
+		}
+		for _, t := range n.ParameterTypes {
+			Walk(v, t)
+		}
+		Walk(v, n.ReturnType)
+		Walk(v, n.Body)
+	case *CallExpression:
+		Walk(v, n.Function)
+		walkExpressions(v, n.Arguments)
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+	case *IndexExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Index)
+	case *ImportExpression:
+		Walk(v, n.Path)
+	case *TypeAnnotation:
+		Walk(v, n.Elem)
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+	v.Visit(nil)
+}
+
+func walkStatements(v Visitor, list []Statement) {
+	for _, s := range list {
+		Walk(v, s)
+	}
+}
+
+func walkExpressions(v Visitor, list []Expression) {
+	for _, e := range list {
+		Walk(v, e)
+	}
+}
+
+// inspector 把函数包装为 Visitor
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect 深度优先遍历 AST，对每个节点调用 f(node)。
+// f 返回 false 时不再遍历该节点的子节点。子节点遍历完之后会调用 f(nil)。
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Rewrite 后序遍历 AST，先改写子节点，再以 f 的返回值替换节点本身。
+// f 返回的节点必须能放进原来的字段，例如表达式的位置只能替换为表达式，否则会 panic。
+// 与 Walk 相同，nil 节点不会被改写，也不会传给 f。返回改写后的根节点。
+func Rewrite(node Node, f func(Node) Node) Node {
+	if isNil(node) {
+		return node
+	}
+	switch n := node.(type) {
+	case *Program:
+		rewriteStatements(n.Statements, f)
+	case *LetStatement:
+		n.Name = rewriteAs[*Identifier](n.Name, f)
+		n.Type = rewriteAs[*TypeAnnotation](n.Type, f)
+		n.Value = rewriteAs[Expression](n.Value, f)
+	case *ReturnStatement:
+		n.ReturnValue = rewriteAs[Expression](n.ReturnValue, f)
+	case *ExpressionStatement:
+		n.Expression = rewriteAs[Expression](n.Expression, f)
+	case *BlockStatement:
+		rewriteStatements(n.Statements, f)
+	case *Identifier, *IntegerLiteral, *Boolean, *StringLiteral:
+		// 没有子节点
+	case *PrefixExpression:
+		n.Right = rewriteAs[Expression](n.Right, f)
+	case *InfixExpression:
+		n.Left = rewriteAs[Expression](n.Left, f)
+		n.Right = rewriteAs[Expression](n.Right, f)
+	case *IfExpression:
+		n.Condition = rewriteAs[Expression](n.Condition, f)
+		n.Consequence = rewriteAs[*BlockStatement](n.Consequence, f)
+		n.Alternative = rewriteAs[*BlockStatement](n.Alternative, f)
+	case *FunctionLiteral:
+		for i, param := range n.Parameters {
+			n.Parameters[i] = rewriteAs[*Identifier](param, f)
+		}
+		for i, t := range n.ParameterTypes {
+			n.ParameterTypes[i] = rewriteAs[*TypeAnnotation](t, f)
+		}
+		n.ReturnType = rewriteAs[*TypeAnnotation](n.ReturnType, f)
+		n.Body = rewriteAs[*BlockStatement](n.Body, f)
+	case *CallExpression:
+		n.Function = rewriteAs[Expression](n.Function, f)
+		rewriteExpressions(n.Arguments, f)
+	case *ArrayLiteral:
+		rewriteExpressions(n.Elements, f)
+	case *IndexExpression:
+		n.Left = rewriteAs[Expression](n.Left, f)
+		n.Index = rewriteAs[Expression](n.Index, f)
+	case *ImportExpression:
+		n.Path = rewriteAs[*StringLiteral](n.Path, f)
+	case *TypeAnnotation:
+		n.Elem = rewriteAs[*TypeAnnotation](n.Elem, f)
+	default:
+		panic(fmt.Sprintf("ast.Rewrite: unexpected node type %T", n))
+	}
+	return f(node)
+}
+
+// rewriteAs 改写子节点并检查结果的类型
+func rewriteAs[T Node](node T, f func(Node) Node) T {
+	if isNil(node) {
+		return node
+	}
+	result := Rewrite(node, f)
+	replaced, ok := result.(T)
+	if !ok {
+		panic(fmt.Sprintf("ast.Rewrite: cannot replace %T with %T", node, result))
+	}
+	return replaced
+}
+
+func rewriteStatements(list []Statement, f func(Node) Node) {
+	for i, s := range list {
+		list[i] = rewriteAs[Statement](s, f)
+	}
+}
+
+func rewriteExpressions(list []Expression, f func(Node) Node) {
+	for i, e := range list {
+		list[i] = rewriteAs[Expression](e, f)
+	}
+}
+
+// isNil 判断节点是否为 nil 或者包含 nil 指针
+func isNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+	value := reflect.ValueOf(node)
+	return value.Kind() == reflect.Pointer && value.IsNil()
+}
@@ -0,0 +1,229 @@
+package ast
+
+import (
+	goast "go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// declaredNodeTypes 扫描包的源码，找出所有实现了 TokenLiteral 的类型
+func declaredNodeTypes(t *testing.T) []string {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(info fs.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatalf("parse package: %s", err)
+	}
+	seen := make(map[string]bool)
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*goast.FuncDecl)
+				if !ok || fn.Recv == nil || fn.Name.Name != "TokenLiteral" {
+					continue
+				}
+				if star, ok := fn.Recv.List[0].Type.(*goast.StarExpr); ok {
+					seen[star.X.(*goast.Ident).Name] = true
+				}
+			}
+		}
+	}
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestNodeKindsComplete(t *testing.T) {
+	for _, name := range declaredNodeTypes(t) {
+		if _, ok := nodeKinds[name]; !ok {
+			t.Errorf("node type %s is missing from nodeKinds, add it there and to Walk and Rewrite", name)
+		}
+	}
+}
+
+// fillChildren 给节点所有的子节点字段填上新的节点，返回填入的子节点
+func fillChildren(node Node) []Node {
+	var children []Node
+	elem := reflect.ValueOf(node).Elem()
+	newChild := func(typ reflect.Type) reflect.Value {
+		var child Node
+		switch {
+		case typ == reflect.TypeOf((*Statement)(nil)).Elem():
+			child = &ExpressionStatement{}
+		case typ.Kind() == reflect.Interface:
+			child = &Identifier{Value: "child"}
+		default:
+			child = reflect.New(typ.Elem()).Interface().(Node)
+		}
+		children = append(children, child)
+		return reflect.ValueOf(child)
+	}
+	for i := 0; i < elem.NumField(); i++ {
+		field := elem.Field(i)
+		switch {
+		case field.Type().Implements(nodeType):
+			field.Set(newChild(field.Type()))
+		case field.Kind() == reflect.Slice && field.Type().Elem().Implements(nodeType):
+			slice := reflect.MakeSlice(field.Type(), 0, 2)
+			for j := 0; j < 2; j++ {
+				slice = reflect.Append(slice, newChild(field.Type().Elem()))
+			}
+			field.Set(slice)
+		}
+	}
+	return children
+}
+
+func TestWalkVisitsAllChildren(t *testing.T) {
+	for name, typ := range nodeKinds {
+		node := reflect.New(typ).Interface().(Node)
+		children := fillChildren(node)
+
+		var visited []Node
+		Inspect(node, func(n Node) bool {
+			if n != nil {
+				visited = append(visited, n)
+			}
+			return n == node
+		})
+		if len(visited) != len(children)+1 {
+			t.Errorf("Walk(%s) visited %d nodes. want=%d", name, len(visited), len(children)+1)
+			continue
+		}
+		for i, child := range children {
+			if visited[i+1] != child {
+				t.Errorf("Walk(%s) child %d wrong. got=%T, want=%T", name, i, visited[i+1], child)
+			}
+		}
+
+		count := 0
+		Rewrite(node, func(n Node) Node {
+			count++
+			return n
+		})
+		if count != len(children)+1 {
+			t.Errorf("Rewrite(%s) visited %d nodes. want=%d", name, count, len(children)+1)
+		}
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	program := &Program{Statements: []Statement{
+		&ExpressionStatement{Expression: &InfixExpression{
+			Left:  &IntegerLiteral{Value: 1},
+			Right: &IntegerLiteral{Value: 2},
+		}},
+	}}
+	var types []string
+	Inspect(program, func(n Node) bool {
+		if n == nil {
+			return false
+		}
+		types = append(types, reflect.TypeOf(n).Elem().Name())
+		_, isInfix := n.(*InfixExpression)
+		return !isInfix
+	})
+	expected := "Program ExpressionStatement InfixExpression"
+	if got := strings.Join(types, " "); got != expected {
+		t.Errorf("Inspect order wrong. got=%q, want=%q", got, expected)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	program := &Program{Statements: []Statement{
+		&LetStatement{
+			Name: &Identifier{Value: "x"},
+			Value: &InfixExpression{
+				Operator: "+",
+				Left:     &IntegerLiteral{Value: 1},
+				Right:    &IntegerLiteral{Value: 2},
+			},
+		},
+	}}
+	// 把常量加法折叠为一个整数
+	Rewrite(program, func(n Node) Node {
+		infix, ok := n.(*InfixExpression)
+		if !ok || infix.Operator != "+" {
+			return n
+		}
+		left, leftOk := infix.Left.(*IntegerLiteral)
+		right, rightOk := infix.Right.(*IntegerLiteral)
+		if !leftOk || !rightOk {
+			return n
+		}
+		return &IntegerLiteral{Value: left.Value + right.Value}
+	})
+	let := program.Statements[0].(*LetStatement)
+	literal, ok := let.Value.(*IntegerLiteral)
+	if !ok || literal.Value != 3 {
+		t.Errorf("Rewrite did not fold constant. got=%#v", let.Value)
+	}
+}
+
+func TestRewriteWrongType(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Rewrite should panic when replacing an identifier with a statement")
+		}
+	}()
+	let := &LetStatement{Name: &Identifier{Value: "x"}, Value: &Identifier{Value: "y"}}
+	Rewrite(let, func(n Node) Node {
+		if _, ok := n.(*Identifier); ok {
+			return &ExpressionStatement{}
+		}
+		return n
+	})
+}
+
+// TestWalkSkipsNilChildren 有语法错误的 AST 中可能有 nil 和包含 nil 指针的子节点
+func TestWalkSkipsNilChildren(t *testing.T) {
+	var nilIdent *Identifier
+	program := &Program{Statements: []Statement{
+		&ExpressionStatement{Expression: &InfixExpression{Left: &IntegerLiteral{Value: 1}}},
+		&ExpressionStatement{Expression: &PrefixExpression{Right: nilIdent}},
+		&ExpressionStatement{Expression: &CallExpression{Arguments: []Expression{nil, &Boolean{}}}},
+		&ExpressionStatement{Expression: &IfExpression{Condition: &Boolean{}}},
+		&ReturnStatement{},
+		&LetStatement{Name: &Identifier{}},
+		nil,
+	}}
+	var visited []string
+	Inspect(program, func(n Node) bool {
+		if n == nil {
+			return false
+		}
+		if isNil(n) {
+			t.Fatalf("Inspect passed a nil %T", n)
+		}
+		visited = append(visited, reflect.TypeOf(n).Elem().Name())
+		return true
+	})
+	expected := "Program ExpressionStatement InfixExpression IntegerLiteral ExpressionStatement PrefixExpression " +
+		"ExpressionStatement CallExpression Boolean ExpressionStatement IfExpression Boolean ReturnStatement LetStatement Identifier"
+	if got := strings.Join(visited, " "); got != expected {
+		t.Errorf("Inspect order wrong.\ngot=%q\nwant=%q", got, expected)
+	}
+	count := 0
+	Rewrite(program, func(n Node) Node {
+		if isNil(n) {
+			t.Fatalf("Rewrite passed a nil %T", n)
+		}
+		count++
+		return n
+	})
+	if count != len(visited) {
+		t.Errorf("Rewrite visited %d nodes. want=%d", count, len(visited))
+	}
+	if program.Statements[1].(*ExpressionStatement).Expression.(*PrefixExpression).Right != nilIdent {
+		t.Errorf("Rewrite replaced a nil child")
+	}
+}
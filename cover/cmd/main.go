@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/cover"
+	"github.com/hollykbuck/muskmelon/evaluator"
+	"github.com/hollykbuck/muskmelon/lexer"
+	"github.com/hollykbuck/muskmelon/object"
+	"github.com/hollykbuck/muskmelon/parser"
+	"github.com/hollykbuck/muskmelon/repl"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 进程退出码
+const (
+	exitOK           = 0
+	exitRuntimeError = 1
+	exitParseError   = 2
+	exitUsage        = 64
+)
+
+const usage = `usage: muskcover [-summary] [-lcov file] [-html file] script.mk ...
+  依次运行脚本，然后输出每个文件和脚本导入的每个模块的覆盖率和按行标注的源码。
+  *_test.mk 文件按 muskmelon test 的方式运行其中的测试函数，测试失败时退出码为 1。
+  行号后面是执行次数，"#####" 表示没有执行，"*" 表示这一行只有部分语句执行过。
+`
+
+// run 解析命令行参数，运行脚本并输出覆盖率，返回进程退出码
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("muskcover", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	summary := flags.Bool("summary", false, "只输出每个文件的覆盖率，不输出源码")
+	lcovPath := flags.String("lcov", "", "把 lcov tracefile 写入文件")
+	htmlPath := flags.String("html", "", "把 HTML 报告写入文件")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	code := exitOK
+	coverage := evaluator.NewCoverage()
+	var files []*cover.File
+	// seen 已经收集的文件，键是绝对路径。被多个脚本导入的模块合并为一个文件。
+	seen := make(map[string]*cover.File)
+	add := func(path string, f *cover.File) {
+		if key, err := filepath.Abs(path); err == nil {
+			path = key
+		}
+		if previous, ok := seen[path]; ok && previous.Merge(f) {
+			return
+		}
+		seen[path] = f
+		files = append(files, f)
+	}
+	for _, name := range flags.Args() {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintf(stderr, "读取脚本失败: %s\n", err)
+			return exitUsage
+		}
+		src := repl.StripShebang(string(content))
+		p := parser.New(lexer.New(src))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			fmt.Fprintf(stderr, "%s: %s\n", name, &repl.ParseError{Errors: p.Errors()})
+			return exitParseError
+		}
+		interpreter := evaluator.New()
+		interpreter.Builtins.Set("puts", evaluator.Puts(stdout))
+		interpreter.Coverage = coverage
+		interpreter.Modules = evaluator.NewModules(evaluator.NewOSLoader(filepath.Dir(name)))
+		// 运行出错时仍然报告已经执行的部分
+		if !execute(interpreter, name, program, stderr) {
+			code = exitRuntimeError
+		}
+		add(name, cover.Collect(name, src, program, coverage))
+		for _, module := range interpreter.Modules.Loaded() {
+			add(module.Key, cover.Collect(displayName(module.Key), module.Src, module.Program, coverage))
+		}
+	}
+	write := cover.WriteText
+	if *summary {
+		write = cover.WriteSummary
+	}
+	if err := write(stdout, files); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	for _, report := range []struct {
+		path  string
+		write func(w io.Writer, files []*cover.File) error
+	}{{*lcovPath, cover.WriteLcov}, {*htmlPath, cover.WriteHTML}} {
+		if report.path == "" {
+			continue
+		}
+		var b strings.Builder
+		err := report.write(&b, files)
+		if err == nil {
+			err = os.WriteFile(report.path, []byte(b.String()), 0o644)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "写入报告失败: %s\n", err)
+			return exitUsage
+		}
+	}
+	return code
+}
+
+// execute 运行脚本，测试文件运行其中的测试函数。出错或者有测试失败时把原因写入 stderr 并返回 false。
+func execute(interpreter *evaluator.Interpreter, name string, program *ast.Program, stderr io.Writer) bool {
+	if !strings.HasSuffix(name, repl.TEST_FILE_SUFFIX) {
+		if errObj, ok := interpreter.Eval(program, repl.NewScriptEnvironment(nil)).(*object.Error); ok {
+			fmt.Fprintf(stderr, "%s: %s\n", name, &repl.RuntimeError{Err: errObj})
+			return false
+		}
+		return true
+	}
+	results, err := repl.RunTestProgram(interpreter, program, nil)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", name, err)
+		return false
+	}
+	ok := true
+	for _, result := range results {
+		if !result.Passed() {
+			fmt.Fprintf(stderr, "--- FAIL: %s\n    %s:%s: %s\n", result.Name, name, result.FailurePos(), result.Err.Message)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// displayName 报告中模块的名字，当前目录下的模块使用相对路径
+func displayName(key string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return key
+	}
+	if rel, err := filepath.Rel(wd, key); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return key
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunModules(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib.mk":       "export let abs = fn(n) {\n\tif (n < 0) { return -n; }\n\tn\n};\n",
+		"main.mk":      "let abs = import \"lib\"[\"abs\"];\nputs(abs(1));\n",
+		"lib_test.mk":  "let abs = import \"lib\"[\"abs\"];\nlet testAbs = fn() { assertEq(abs(-2), 2) };\n",
+		"fail_test.mk": "let abs = import \"lib\"[\"abs\"];\nlet testAbs = fn() { assertEq(abs(-2), 3) };\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	at := func(name string) string { return filepath.Join(dir, name) }
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		stdout []string
+		stderr string
+	}{
+		{"module", []string{"-summary", at("main.mk")}, exitOK, []string{
+			at("main.mk") + ": statements 2/2 (100.0%), branches 0/0 (100.0%)",
+			"lib.mk: statements 3/4 (75.0%), branches 1/2 (50.0%)",
+		}, ""},
+		// 测试文件运行测试函数，两个脚本导入的模块合并为一个文件
+		{"merged", []string{"-summary", at("main.mk"), at("lib_test.mk")}, exitOK, []string{
+			"lib.mk: statements 4/4 (100.0%), branches 2/2 (100.0%)",
+			at("lib_test.mk") + ": statements 3/3 (100.0%)",
+		}, ""},
+		{"failed test", []string{"-summary", at("fail_test.mk")}, exitRuntimeError, []string{"lib.mk: statements 3/4"}, "--- FAIL: testAbs"},
+	}
+	for _, tt := range tests {
+		var stdout, stderr strings.Builder
+		code := run(tt.args, &stdout, &stderr)
+		if code != tt.code {
+			t.Errorf("%s: exit code wrong. got=%d, want=%d (stderr=%q)", tt.name, code, tt.code, stderr.String())
+		}
+		for _, s := range tt.stdout {
+			if !strings.Contains(stdout.String(), s) {
+				t.Errorf("%s: stdout does not contain %q. got=%q", tt.name, s, stdout.String())
+			}
+		}
+		if n := strings.Count(stdout.String(), "lib.mk:"); n != 1 {
+			t.Errorf("%s: lib.mk reported %d times. got=%q", tt.name, n, stdout.String())
+		}
+		if !strings.Contains(stderr.String(), tt.stderr) || tt.stderr == "" && stderr.Len() != 0 {
+			t.Errorf("%s: stderr wrong. got=%q, want %q", tt.name, stderr.String(), tt.stderr)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+// Package cover 根据 evaluator.Coverage 的记录计算脚本的覆盖率，
+// 输出按行标注的文本报告、lcov tracefile 和 HTML 报告。
+package cover
+
+import (
+	"fmt"
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/evaluator"
+	"github.com/hollykbuck/muskmelon/token"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Statement 一条语句和它执行的次数
+type Statement struct {
+	Pos  token.Position
+	Hits int
+}
+
+// Branch 一个 if 表达式两个分支的执行次数。没有 else 时条件为假计入 Alternative。
+type Branch struct {
+	Pos         token.Position
+	Consequence int
+	Alternative int
+}
+
+// Line 一行源码的覆盖情况
+type Line struct {
+	Line int
+	// Hits 这一行的语句中执行次数最多的
+	Hits int
+	// Statements 这一行开始的语句数，Covered 是其中执行过的
+	Statements int
+	Covered    int
+}
+
+// File 一个文件的覆盖情况
+type File struct {
+	Name       string
+	Source     string
+	Statements []Statement
+	Branches   []Branch
+}
+
+// Collect 从 coverage 中收集 program 的覆盖情况，program 是 src 解析出的、实际运行的语法树
+func Collect(name string, src string, program *ast.Program, coverage *evaluator.Coverage) *File {
+	f := &File{Name: name, Source: src}
+	addStatements := func(list []ast.Statement) {
+		for _, statement := range list {
+			if pos := ast.StatementPos(statement); pos.IsValid() {
+				f.Statements = append(f.Statements, Statement{Pos: pos, Hits: coverage.StatementHits(statement)})
+			}
+		}
+	}
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.Program:
+			addStatements(n.Statements)
+		case *ast.BlockStatement:
+			addStatements(n.Statements)
+		case *ast.IfExpression:
+			consequence, alternative := coverage.BranchHits(n)
+			f.Branches = append(f.Branches, Branch{Pos: n.Token.Pos, Consequence: consequence, Alternative: alternative})
+		}
+		return true
+	})
+	sort.SliceStable(f.Statements, func(i, j int) bool { return f.Statements[i].Pos.Offset < f.Statements[j].Pos.Offset })
+	sort.SliceStable(f.Branches, func(i, j int) bool { return f.Branches[i].Pos.Offset < f.Branches[j].Pos.Offset })
+	return f
+}
+
+// Merge 把同一份源码另一次运行的覆盖情况累加到 f，例如被多个脚本导入的模块。
+// 源码不同时不累加，返回 false。
+func (f *File) Merge(other *File) bool {
+	if f.Source != other.Source || len(f.Statements) != len(other.Statements) || len(f.Branches) != len(other.Branches) {
+		return false
+	}
+	for i := range f.Statements {
+		f.Statements[i].Hits += other.Statements[i].Hits
+	}
+	for i := range f.Branches {
+		f.Branches[i].Consequence += other.Branches[i].Consequence
+		f.Branches[i].Alternative += other.Branches[i].Alternative
+	}
+	return true
+}
+
+// Lines 有语句开始的行，按行号排序
+func (f *File) Lines() []Line {
+	var lines []Line
+	for _, s := range f.Statements {
+		if len(lines) == 0 || lines[len(lines)-1].Line != s.Pos.Line {
+			lines = append(lines, Line{Line: s.Pos.Line})
+		}
+		line := &lines[len(lines)-1]
+		line.Statements++
+		if s.Hits > 0 {
+			line.Covered++
+		}
+		if s.Hits > line.Hits {
+			line.Hits = s.Hits
+		}
+	}
+	return lines
+}
+
+// StatementCoverage 执行过的语句数和语句总数
+func (f *File) StatementCoverage() (covered int, total int) {
+	for _, s := range f.Statements {
+		if s.Hits > 0 {
+			covered++
+		}
+	}
+	return covered, len(f.Statements)
+}
+
+// BranchCoverage 执行过的分支数和分支总数，每个 if 表达式有两个分支
+func (f *File) BranchCoverage() (covered int, total int) {
+	for _, b := range f.Branches {
+		if b.Consequence > 0 {
+			covered++
+		}
+		if b.Alternative > 0 {
+			covered++
+		}
+	}
+	return covered, 2 * len(f.Branches)
+}
+
+// percent covered 占 total 的百分比，total 为 0 时是 100%
+func percent(covered int, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(covered) * 100 / float64(total)
+}
+
+// summary 文件覆盖率的一行总结
+func (f *File) summary() string {
+	statements, totalStatements := f.StatementCoverage()
+	branches, totalBranches := f.BranchCoverage()
+	return fmt.Sprintf("%s: statements %d/%d (%.1f%%), branches %d/%d (%.1f%%)",
+		f.Name, statements, totalStatements, percent(statements, totalStatements),
+		branches, totalBranches, percent(branches, totalBranches))
+}
+
+// WriteSummary 每个文件写一行覆盖率总结
+func WriteSummary(w io.Writer, files []*File) error {
+	for _, f := range files {
+		if _, err := fmt.Fprintln(w, f.summary()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteText 写出每个文件的总结和按行标注的源码。
+// 每行前面是行号和执行次数，没有语句的行次数为空，有语句没有执行的行标记为 "#####"。
+func WriteText(w io.Writer, files []*File) error {
+	for i, f := range files {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(w, f.summary()); err != nil {
+			return err
+		}
+		hits := make(map[int]Line)
+		for _, line := range f.Lines() {
+			hits[line.Line] = line
+		}
+		for n, text := range sourceLines(f.Source) {
+			count := ""
+			if line, ok := hits[n+1]; ok {
+				switch {
+				case line.Covered == 0:
+					count = "#####"
+				case line.Covered < line.Statements:
+					count = fmt.Sprintf("%d*", line.Hits)
+				default:
+					count = fmt.Sprint(line.Hits)
+				}
+			}
+			if _, err := fmt.Fprintf(w, "%5d %6s  %s\n", n+1, count, text); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sourceLines 按行切分源码，去掉最后的空行
+func sourceLines(src string) []string {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// WriteLcov 写出 lcov tracefile，可以用 genhtml 等工具处理
+func WriteLcov(w io.Writer, files []*File) error {
+	var b strings.Builder
+	for _, f := range files {
+		fmt.Fprintf(&b, "TN:\nSF:%s\n", f.Name)
+		taken := 0
+		for block, br := range f.Branches {
+			for branch, hits := range []int{br.Consequence, br.Alternative} {
+				if br.Consequence+br.Alternative == 0 {
+					// 条件没有计算过
+					fmt.Fprintf(&b, "BRDA:%d,%d,%d,-\n", br.Pos.Line, block, branch)
+					continue
+				}
+				fmt.Fprintf(&b, "BRDA:%d,%d,%d,%d\n", br.Pos.Line, block, branch, hits)
+				if hits > 0 {
+					taken++
+				}
+			}
+		}
+		fmt.Fprintf(&b, "BRF:%d\nBRH:%d\n", 2*len(f.Branches), taken)
+		lines := f.Lines()
+		covered := 0
+		for _, line := range lines {
+			fmt.Fprintf(&b, "DA:%d,%d\n", line.Line, line.Hits)
+			if line.Hits > 0 {
+				covered++
+			}
+		}
+		fmt.Fprintf(&b, "LF:%d\nLH:%d\nend_of_record\n", len(lines), covered)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+const htmlHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>muskmelon coverage</title>
+<style>
+body { font-family: sans-serif; }
+pre { font-family: monospace; line-height: 1.3; }
+.hits { display: inline-block; width: 5em; text-align: right; padding-right: 1em; color: #888; }
+.covered { background: #d8f5d0; }
+.partial { background: #fbeec0; }
+.uncovered { background: #f8d0d0; }
+</style>
+</head>
+<body>
+`
+
+// WriteHTML 写出 HTML 报告，执行过的行为绿色，部分执行的为黄色，没有执行的为红色
+func WriteHTML(w io.Writer, files []*File) error {
+	var b strings.Builder
+	b.WriteString(htmlHeader)
+	b.WriteString("<ul>\n")
+	for i, f := range files {
+		fmt.Fprintf(&b, "<li><a href=\"#file%d\">%s</a></li>\n", i, html.EscapeString(f.summary()))
+	}
+	b.WriteString("</ul>\n")
+	for i, f := range files {
+		fmt.Fprintf(&b, "<h2 id=\"file%d\">%s</h2>\n<pre>\n", i, html.EscapeString(f.Name))
+		hits := make(map[int]Line)
+		for _, line := range f.Lines() {
+			hits[line.Line] = line
+		}
+		for n, text := range sourceLines(f.Source) {
+			class, count := "", ""
+			if line, ok := hits[n+1]; ok {
+				count = fmt.Sprint(line.Hits)
+				switch {
+				case line.Covered == 0:
+					class = "uncovered"
+				case line.Covered < line.Statements:
+					class = "partial"
+				default:
+					class = "covered"
+				}
+			}
+			fmt.Fprintf(&b, "<span class=\"%s\"><span class=\"hits\">%s</span>%s</span>\n", class, count, html.EscapeString(text))
+		}
+		b.WriteString("</pre>\n")
+	}
+	b.WriteString("</body>\n</html>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
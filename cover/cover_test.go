@@ -0,0 +1,148 @@
+package cover
+
+import (
+	"bytes"
+	"github.com/hollykbuck/muskmelon/evaluator"
+	"github.com/hollykbuck/muskmelon/lexer"
+	"github.com/hollykbuck/muskmelon/object"
+	"github.com/hollykbuck/muskmelon/parser"
+	"strings"
+	"testing"
+)
+
+const testInput = `let abs = fn(n) {
+	if (n < 0) { return -n; }
+	n
+};
+let sign = fn(n) { if (n > 0) { 1 } else { -1 } };
+abs(3); abs(-2);
+let unused = fn() { 1 };
+sign(1)
+`
+
+// collect 运行 testInput 并收集覆盖情况
+func collect(t *testing.T) *File {
+	t.Helper()
+	p := parser.New(lexer.New(testInput))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parse errors: %v", p.Errors())
+	}
+	coverage := evaluator.NewCoverage()
+	in := evaluator.New()
+	in.Coverage = coverage
+	in.Eval(program, object.NewEnvironment())
+	return Collect("test.mk", testInput, program, coverage)
+}
+
+func TestCollect(t *testing.T) {
+	f := collect(t)
+	if covered, total := f.StatementCoverage(); covered != 11 || total != 13 {
+		t.Errorf("statement coverage wrong. got=%d/%d", covered, total)
+	}
+	if covered, total := f.BranchCoverage(); covered != 3 || total != 4 {
+		t.Errorf("branch coverage wrong. got=%d/%d", covered, total)
+	}
+	expected := []Line{
+		{Line: 1, Hits: 1, Statements: 1, Covered: 1},
+		{Line: 2, Hits: 2, Statements: 2, Covered: 2},
+		{Line: 3, Hits: 1, Statements: 1, Covered: 1},
+		{Line: 5, Hits: 1, Statements: 4, Covered: 3},
+		{Line: 6, Hits: 1, Statements: 2, Covered: 2},
+		{Line: 7, Hits: 1, Statements: 2, Covered: 1},
+		{Line: 8, Hits: 1, Statements: 1, Covered: 1},
+	}
+	lines := f.Lines()
+	if len(lines) != len(expected) {
+		t.Fatalf("wrong number of lines. got=%+v", lines)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("line %d wrong. got=%+v want=%+v", i, lines[i], expected[i])
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	f := collect(t)
+	if !f.Merge(collect(t)) {
+		t.Fatalf("Merge of the same source failed")
+	}
+	if covered, total := f.StatementCoverage(); covered != 11 || total != 13 || f.Statements[0].Hits != 2 {
+		t.Errorf("merged statements wrong. got=%d/%d, first hits=%d", covered, total, f.Statements[0].Hits)
+	}
+	if other := (&File{Source: "1"}); f.Merge(other) {
+		t.Errorf("Merge of a different source succeeded")
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteText(&buf, []*File{collect(t)}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `test.mk: statements 11/13 (84.6%), branches 3/4 (75.0%)
+    1      1  let abs = fn(n) {
+    2      2  	if (n < 0) { return -n; }
+    3      1  	n
+    4         };
+    5     1*  let sign = fn(n) { if (n > 0) { 1 } else { -1 } };
+    6      1  abs(3); abs(-2);
+    7     1*  let unused = fn() { 1 };
+    8      1  sign(1)
+`
+	if buf.String() != expected {
+		t.Errorf("text wrong.\ngot=\n%s\nwant=\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteLcov(t *testing.T) {
+	f := collect(t)
+	// 没有执行过的 if 的分支记为 "-"
+	f.Branches = append(f.Branches, Branch{Pos: f.Branches[0].Pos})
+	var buf bytes.Buffer
+	if err := WriteLcov(&buf, []*File{f}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `TN:
+SF:test.mk
+BRDA:2,0,0,1
+BRDA:2,0,1,1
+BRDA:5,1,0,1
+BRDA:5,1,1,0
+BRDA:2,2,0,-
+BRDA:2,2,1,-
+BRF:6
+BRH:3
+DA:1,1
+DA:2,2
+DA:3,1
+DA:5,1
+DA:6,1
+DA:7,1
+DA:8,1
+LF:7
+LH:7
+end_of_record
+`
+	if buf.String() != expected {
+		t.Errorf("lcov wrong.\ngot=\n%s\nwant=\n%s", buf.String(), expected)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, []*File{collect(t)}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<span class="covered"><span class="hits">2</span>	if (n &lt; 0) { return -n; }</span>`,
+		`<span class="partial"><span class="hits">1</span>let unused = fn() { 1 };</span>`,
+		`<span class=""><span class="hits"></span>};</span>`,
+		`test.mk: statements 11/13 (84.6%)`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("html missing %q", want)
+		}
+	}
+}
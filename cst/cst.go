@@ -0,0 +1,133 @@
+// Package cst 提供保留全部 token 和空白的语法树。
+// 与 ast 不同，语法树按源码的顺序保存每个 token 的原始写法和它前面的空白、注释，
+// 打印语法树可以逐字节还原源码，修改个别 token 后再打印不会影响其他部分的格式。
+package cst
+
+import (
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/token"
+	"strings"
+)
+
+// TriviaKind 空白的种类
+type TriviaKind int
+
+const (
+	// Whitespace 空格、制表符和换行
+	Whitespace TriviaKind = iota
+	// Comment 行注释，不包含行尾的换行符
+	Comment
+)
+
+// Trivia token 之间对语法没有影响的文本
+type Trivia struct {
+	Kind TriviaKind
+	Text string
+}
+
+// Element 语法树的元素，*Node 或者 *Token
+type Element interface {
+	// Source 还原元素对应的源码
+	Source() string
+	element()
+}
+
+// Token 源码中的一个 token
+type Token struct {
+	token.Token
+	// Leading token 前面的空白和注释
+	Leading []Trivia
+	// Text token 在源码中的原始写法，例如字符串字面量包含引号
+	Text string
+}
+
+func (t *Token) element() {}
+
+// Source 还原 token 和它前面的空白
+func (t *Token) Source() string {
+	var out strings.Builder
+	for _, trivia := range t.Leading {
+		out.WriteString(trivia.Text)
+	}
+	out.WriteString(t.Text)
+	return out.String()
+}
+
+// Node 语法树的节点，对应一个 AST 节点
+type Node struct {
+	// AST 节点对应的 AST 节点
+	AST ast.Node
+	// Children 按源码顺序排列的子节点和 token
+	Children []Element
+}
+
+func (n *Node) element() {}
+
+// Source 还原节点覆盖的源码
+func (n *Node) Source() string {
+	var out strings.Builder
+	for _, child := range n.Children {
+		out.WriteString(child.Source())
+	}
+	return out.String()
+}
+
+// String 与 Source 相同，根节点的 String 就是完整的源码
+func (n *Node) String() string {
+	return n.Source()
+}
+
+// Tokens 按顺序返回节点下所有的 token
+func (n *Node) Tokens() []*Token {
+	var tokens []*Token
+	for _, child := range n.Children {
+		switch child := child.(type) {
+		case *Token:
+			tokens = append(tokens, child)
+		case *Node:
+			tokens = append(tokens, child.Tokens()...)
+		}
+	}
+	return tokens
+}
+
+// Find 深度优先查找第一个满足条件的节点，找不到时返回 nil
+func (n *Node) Find(f func(*Node) bool) *Node {
+	if f(n) {
+		return n
+	}
+	for _, child := range n.Children {
+		if child, ok := child.(*Node); ok {
+			if found := child.Find(f); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// SplitTrivia 将 token 之间的文本拆分为空白和注释。
+// 与 lexer 一致，开头的 #! 行也是注释。lexer 只在源码开头把 #! 当作注释，
+// 其他位置的 # 是非法 token，不会出现在 token 之间的文本中。
+func SplitTrivia(text string) []Trivia {
+	var trivia []Trivia
+	for text != "" {
+		var end int
+		kind := Whitespace
+		if strings.HasPrefix(text, "//") || len(trivia) == 0 && strings.HasPrefix(text, "#!") {
+			kind = Comment
+			end = strings.IndexByte(text, '\n')
+			if end < 0 {
+				end = len(text)
+			}
+		} else {
+			end = strings.Index(text, "//")
+			if end < 0 {
+				end = len(text)
+			}
+		}
+		trivia = append(trivia, Trivia{Kind: kind, Text: text[:end]})
+		text = text[end:]
+	}
+	return trivia
+}
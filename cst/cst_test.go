@@ -0,0 +1,25 @@
+package cst
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitTrivia(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []Trivia
+	}{
+		{"", nil},
+		{" \t", []Trivia{{Whitespace, " \t"}}},
+		{" // a\n\t// b", []Trivia{{Whitespace, " "}, {Comment, "// a"}, {Whitespace, "\n\t"}, {Comment, "// b"}}},
+		{"//x\r\n", []Trivia{{Comment, "//x\r"}, {Whitespace, "\n"}}},
+		{"#!/usr/bin/env muskmelon\n// a\n", []Trivia{{Comment, "#!/usr/bin/env muskmelon"}, {Whitespace, "\n"}, {Comment, "// a"}, {Whitespace, "\n"}}},
+		{"#!", []Trivia{{Comment, "#!"}}},
+	}
+	for _, tt := range tests {
+		if got := SplitTrivia(tt.input); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("SplitTrivia(%q) wrong. got=%+v, want=%+v", tt.input, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/hollykbuck/muskmelon/dap"
+	"io"
+	"os"
+)
+
+// 进程退出码
+const (
+	exitOK    = 0
+	exitError = 1
+)
+
+const usage = `usage: muskdap
+  通过 stdin 和 stdout 提供 Debug Adapter Protocol 服务，用 launch 请求的 program 指定要调试的脚本。
+`
+
+// run 解析命令行参数并运行服务器，返回进程退出码
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("muskdap", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return exitError
+	}
+	if err := dap.New(stdin, stdout).Serve(); err != nil {
+		fmt.Fprintf(stderr, "muskdap: %s\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
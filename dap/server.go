@@ -0,0 +1,543 @@
+package dap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/evaluator"
+	"github.com/hollykbuck/muskmelon/framing"
+	"github.com/hollykbuck/muskmelon/lexer"
+	"github.com/hollykbuck/muskmelon/object"
+	"github.com/hollykbuck/muskmelon/parser"
+	"github.com/hollykbuck/muskmelon/repl"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// THREAD_ID 脚本只有一个线程
+const THREAD_ID = 1
+
+// handler 处理一个请求，返回响应的 body
+type handler func(s *Server, args json.RawMessage) (interface{}, error)
+
+var handlers map[string]handler
+
+// resumeActions 让暂停的脚本继续执行的请求，发送响应之后才让脚本继续执行，
+// 保证客户端先收到响应，再收到之后的 stopped 等事件
+var resumeActions = map[string]evaluator.Action{
+	"continue": evaluator.ActionContinue,
+	"next":     evaluator.ActionStepOver,
+	"stepIn":   evaluator.ActionStepIn,
+	"stepOut":  evaluator.ActionStepOut,
+}
+
+func init() {
+	handlers = map[string]handler{
+		"initialize":        (*Server).initialize,
+		"launch":            (*Server).launch,
+		"setBreakpoints":    (*Server).setBreakpoints,
+		"configurationDone": (*Server).configurationDone,
+		"threads":           (*Server).threads,
+		"stackTrace":        (*Server).stackTrace,
+		"scopes":            (*Server).scopes,
+		"variables":         (*Server).variables,
+		"evaluate":          (*Server).evaluate,
+		"continue":          (*Server).resumeRequest,
+		"next":              (*Server).resumeRequest,
+		"stepIn":            (*Server).resumeRequest,
+		"stepOut":           (*Server).resumeRequest,
+		"terminate":         (*Server).terminate,
+		"disconnect":        (*Server).terminate,
+	}
+}
+
+// Server 通过 stdio 等连接提供 Debug Adapter Protocol 服务，一次调试一个脚本。
+// 脚本在单独的 goroutine 中运行，暂停时由调试器的 OnStop 等待客户端的 continue 等请求。
+type Server struct {
+	in  *framing.Reader
+	out *writer
+	// lineBase 和 columnBase 客户端的行号和列号从 0 还是 1 开始
+	lineBase   int
+	columnBase int
+
+	program     string
+	ast         *ast.Program
+	env         *object.Environment
+	interpreter *evaluator.Interpreter
+	debugger    *evaluator.Debugger
+	// configured 和 launched 都为 true 时开始运行脚本
+	configured bool
+	launched   bool
+	started    bool
+	// resume 暂停的脚本从这里接收继续执行的方式
+	resume chan evaluator.Action
+	// done 脚本运行结束时关闭
+	done chan struct{}
+
+	// mu 保护以下在脚本的 goroutine 中也会访问的字段
+	mu sync.Mutex
+	// breakpoints 每个文件的断点，键是绝对路径
+	breakpoints map[string][]int
+	// frames 暂停时的调用栈，运行时为 nil
+	frames []*evaluator.Frame
+	// refs 暂停时分配的 variablesReference，值是 *object.Environment 或者可以展开的对象
+	refs map[int]interface{}
+	// terminating 正在结束调试，之后的暂停直接停止执行
+	terminating bool
+}
+
+// New 创建从 in 读取请求、向 out 写入响应和事件的 Server
+func New(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:          framing.NewReader(in),
+		out:         &writer{w: framing.NewWriter(out)},
+		lineBase:    1,
+		columnBase:  1,
+		resume:      make(chan evaluator.Action),
+		done:        make(chan struct{}),
+		breakpoints: make(map[string][]int),
+	}
+}
+
+// errDisconnect 由 disconnect 请求返回，通知 Serve 结束
+var errDisconnect = errors.New("disconnect")
+
+// Serve 处理请求直到收到 disconnect 或者连接关闭，正在运行的脚本会被停止。
+// 无法解析的消息回复失败的响应，然后继续处理之后的请求。
+func (s *Server) Serve() error {
+	defer s.stop()
+	for {
+		data, err := s.in.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var req Request
+		if err := json.Unmarshal(data, &req); err != nil {
+			resp := &Response{Success: false, Message: "invalid message: " + err.Error()}
+			if err := s.out.send(resp); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Type != "request" {
+			continue
+		}
+		err = s.handle(&req)
+		if errors.Is(err, errDisconnect) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handle 处理一个请求并发送响应，只有写入失败或者 disconnect 时返回错误
+func (s *Server) handle(req *Request) error {
+	resp := &Response{RequestSeq: req.Seq, Command: req.Command, Success: true}
+	h, ok := handlers[req.Command]
+	if !ok {
+		resp.Success, resp.Message = false, "unsupported command: "+req.Command
+		return s.out.send(resp)
+	}
+	body, err := h(s, req.Arguments)
+	if err != nil {
+		resp.Success, resp.Message = false, err.Error()
+	} else {
+		resp.Body = body
+	}
+	if err := s.out.send(resp); err != nil {
+		return err
+	}
+	if action, ok := resumeActions[req.Command]; ok && resp.Success {
+		s.continueWith(action)
+		return nil
+	}
+	switch {
+	case req.Command == "initialize" && resp.Success:
+		return s.event("initialized", nil)
+	case req.Command == "disconnect":
+		return errDisconnect
+	}
+	return s.start()
+}
+
+func (s *Server) event(name string, body interface{}) error {
+	return s.out.send(&Event{Event: name, Body: body})
+}
+
+func decode(args json.RawMessage, v interface{}) error {
+	if len(args) == 0 {
+		return nil
+	}
+	return json.Unmarshal(args, v)
+}
+
+func (s *Server) initialize(args json.RawMessage) (interface{}, error) {
+	var a InitializeArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	if a.LinesStartAt1 != nil && !*a.LinesStartAt1 {
+		s.lineBase = 0
+	}
+	if a.ColumnsStartAt1 != nil && !*a.ColumnsStartAt1 {
+		s.columnBase = 0
+	}
+	return Capabilities{
+		SupportsConfigurationDoneRequest: true,
+		SupportsEvaluateForHovers:        true,
+		SupportsTerminateRequest:         true,
+	}, nil
+}
+
+// launch 读取并解析脚本，收到 configurationDone 之后才开始运行
+func (s *Server) launch(args json.RawMessage) (interface{}, error) {
+	var a LaunchArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	if s.launched {
+		return nil, errors.New("already launched")
+	}
+	program, err := filepath.Abs(a.Program)
+	if err != nil {
+		return nil, err
+	}
+	src, err := os.ReadFile(program)
+	if err != nil {
+		return nil, err
+	}
+	p := parser.New(lexer.New(repl.StripShebang(string(src))))
+	s.ast = p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &repl.ParseError{Errors: p.Errors()}
+	}
+	s.program = program
+	s.env = repl.NewScriptEnvironment(a.Args)
+	s.interpreter = evaluator.New()
+	s.interpreter.File = program
+	s.interpreter.Builtins.Set("puts", evaluator.Puts(&output{s: s, category: "stdout"}))
+	s.interpreter.Modules = evaluator.NewModules(evaluator.NewOSLoader(filepath.Dir(program)))
+	// noDebug 时调试器只用于停止脚本，不会暂停
+	s.debugger = evaluator.NewDebugger(nil)
+	if !a.NoDebug {
+		s.debugger.OnStop = s.onStop
+		s.debugger.StopOnEntry = a.StopOnEntry
+	}
+	s.interpreter.Debugger = s.debugger
+	s.launched = true
+	return nil, nil
+}
+
+func (s *Server) configurationDone(json.RawMessage) (interface{}, error) {
+	s.configured = true
+	return nil, nil
+}
+
+// start 在 launch 和 configurationDone 都完成之后开始运行脚本
+func (s *Server) start() error {
+	if s.started || !s.launched || !s.configured {
+		return nil
+	}
+	s.started = true
+	s.mu.Lock()
+	s.applyBreakpoints()
+	s.mu.Unlock()
+	go s.run()
+	return nil
+}
+
+// run 在单独的 goroutine 中运行脚本，结束时发送 exited 和 terminated 事件
+func (s *Server) run() {
+	defer close(s.done)
+	exitCode := 0
+	result := s.interpreter.Eval(s.ast, s.env)
+	if err, ok := result.(*object.Error); ok && err.Message != evaluator.ErrStopped {
+		exitCode = 1
+		_ = s.event("output", OutputEventBody{Category: "stderr", Output: err.Inspect() + "\n"})
+	}
+	_ = s.event("exited", ExitedEventBody{ExitCode: exitCode})
+	_ = s.event("terminated", nil)
+}
+
+// onStop 在脚本的 goroutine 中调用，记录调用栈并等待客户端决定如何继续
+func (s *Server) onStop(d *evaluator.Debugger, reason evaluator.StopReason) evaluator.Action {
+	s.mu.Lock()
+	if s.terminating {
+		s.mu.Unlock()
+		return evaluator.ActionStop
+	}
+	// 运行期间修改的断点在暂停时生效
+	s.applyBreakpoints()
+	s.frames = d.Frames()
+	s.refs = make(map[int]interface{})
+	s.mu.Unlock()
+	_ = s.event("stopped", StoppedEventBody{Reason: string(reason), ThreadID: THREAD_ID, AllThreadsStopped: true})
+	return <-s.resume
+}
+
+// applyBreakpoints 把每个文件的断点设置到调试器，调用时需要持有 mu，并且脚本没有在运行。
+// 帧的文件是脚本或者模块的绝对路径，与 breakpoints 的键一致。
+func (s *Server) applyBreakpoints() {
+	s.debugger.ClearBreakpoints()
+	for path, lines := range s.breakpoints {
+		for _, line := range lines {
+			s.debugger.SetBreakpoint(path, line)
+		}
+	}
+}
+
+// paused 返回暂停时的调用栈，脚本没有暂停时返回错误
+func (s *Server) paused() ([]*evaluator.Frame, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.frames == nil {
+		return nil, errors.New("program is not paused")
+	}
+	return s.frames, nil
+}
+
+// resumeRequest 检查脚本是否暂停，handle 在发送响应之后按照 resumeActions 让脚本继续执行
+func (s *Server) resumeRequest(json.RawMessage) (interface{}, error) {
+	if _, err := s.paused(); err != nil {
+		return nil, err
+	}
+	return ContinueResponseBody{AllThreadsContinued: true}, nil
+}
+
+// continueWith 清空暂停时的状态并让脚本继续执行
+func (s *Server) continueWith(action evaluator.Action) {
+	s.mu.Lock()
+	s.frames = nil
+	s.refs = nil
+	s.mu.Unlock()
+	s.resume <- action
+}
+
+func (s *Server) setBreakpoints(args json.RawMessage) (interface{}, error) {
+	var a SetBreakpointsArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	path, err := filepath.Abs(a.Source.Path)
+	if err != nil {
+		return nil, err
+	}
+	body := SetBreakpointsResponseBody{Breakpoints: []Breakpoint{}}
+	var lines []int
+	for _, bp := range a.Breakpoints {
+		line := bp.Line + 1 - s.lineBase
+		lines = append(lines, line)
+		body.Breakpoints = append(body.Breakpoints, Breakpoint{Verified: line >= 1, Line: bp.Line})
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.breakpoints[path] = lines
+	// 脚本暂停或者还没有开始运行时调试器不会被并发访问，可以立即生效
+	if s.debugger != nil && (!s.started || s.frames != nil) {
+		s.applyBreakpoints()
+	}
+	return body, nil
+}
+
+func (s *Server) threads(json.RawMessage) (interface{}, error) {
+	return ThreadsResponseBody{Threads: []Thread{{ID: THREAD_ID, Name: "main"}}}, nil
+}
+
+// stackTrace 列出调用栈，frame 的 id 是从 1 开始的下标，最内层的帧在最前面
+func (s *Server) stackTrace(args json.RawMessage) (interface{}, error) {
+	var a StackTraceArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	frames, err := s.paused()
+	if err != nil {
+		return nil, err
+	}
+	body := StackTraceResponseBody{StackFrames: []StackFrame{}, TotalFrames: len(frames)}
+	end := len(frames)
+	if a.Levels > 0 && a.StartFrame+a.Levels < end {
+		end = a.StartFrame + a.Levels
+	}
+	for i := a.StartFrame; i < end; i++ {
+		pos := frames[i].Pos()
+		body.StackFrames = append(body.StackFrames, StackFrame{
+			ID:     i + 1,
+			Name:   frames[i].Name,
+			Source: Source{Name: filepath.Base(frames[i].File), Path: frames[i].File},
+			Line:   pos.Line - 1 + s.lineBase,
+			Column: pos.Column - 1 + s.columnBase,
+		})
+	}
+	return body, nil
+}
+
+// frame 根据 id 找到暂停时的帧
+func (s *Server) frame(id int) (*evaluator.Frame, error) {
+	frames, err := s.paused()
+	if err != nil {
+		return nil, err
+	}
+	if id < 1 || id > len(frames) {
+		return nil, fmt.Errorf("invalid frame id %d", id)
+	}
+	return frames[id-1], nil
+}
+
+// reference 为 environment 或者可以展开的对象分配 variablesReference
+func (s *Server) reference(v interface{}) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ref := len(s.refs) + 1
+	s.refs[ref] = v
+	return ref
+}
+
+// scopes 帧的 environment 链，从内到外依次是 Locals、Closure 和 Globals
+func (s *Server) scopes(args json.RawMessage) (interface{}, error) {
+	var a ScopesArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	frame, err := s.frame(a.FrameID)
+	if err != nil {
+		return nil, err
+	}
+	body := ScopesResponseBody{Scopes: []Scope{}}
+	for env := frame.Env; env != nil; env = env.Outer() {
+		name := "Closure"
+		switch {
+		case env.Outer() == nil:
+			name = "Globals"
+		case env == frame.Env:
+			name = "Locals"
+		}
+		body.Scopes = append(body.Scopes, Scope{Name: name, VariablesReference: s.reference(env)})
+	}
+	return body, nil
+}
+
+// variables 列出作用域中的绑定，或者数组和 Hash 的元素
+func (s *Server) variables(args json.RawMessage) (interface{}, error) {
+	var a VariablesArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	if _, err := s.paused(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	v, ok := s.refs[a.VariablesReference]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("invalid variablesReference %d", a.VariablesReference)
+	}
+	body := VariablesResponseBody{Variables: []Variable{}}
+	switch v := v.(type) {
+	case *object.Environment:
+		for _, name := range v.Names() {
+			value, _ := v.Get(name)
+			body.Variables = append(body.Variables, s.variable(name, value))
+		}
+	case *object.Array:
+		for i, element := range v.Elements {
+			body.Variables = append(body.Variables, s.variable(fmt.Sprintf("[%d]", i), element))
+		}
+	case *object.Hash:
+		for _, pair := range v.Pairs {
+			body.Variables = append(body.Variables, s.variable(pair.Key.Inspect(), pair.Value))
+		}
+		sort.Slice(body.Variables, func(i, j int) bool { return body.Variables[i].Name < body.Variables[j].Name })
+	}
+	return body, nil
+}
+
+// variable 数组和非空的 Hash 可以展开
+func (s *Server) variable(name string, value object.Object) Variable {
+	v := Variable{Name: name, Value: value.Inspect(), Type: string(value.Type())}
+	switch value := value.(type) {
+	case *object.Array:
+		if len(value.Elements) > 0 {
+			v.VariablesReference = s.reference(value)
+		}
+	case *object.Hash:
+		if len(value.Pairs) > 0 {
+			v.VariablesReference = s.reference(value)
+		}
+	}
+	return v
+}
+
+// evaluate 在帧的 environment 中计算表达式，没有指定帧时使用最内层的帧。计算时不会触发断点。
+func (s *Server) evaluate(args json.RawMessage) (interface{}, error) {
+	var a EvaluateArguments
+	if err := decode(args, &a); err != nil {
+		return nil, err
+	}
+	if a.FrameID == 0 {
+		a.FrameID = 1
+	}
+	frame, err := s.frame(a.FrameID)
+	if err != nil {
+		return nil, err
+	}
+	p := parser.New(lexer.New(a.Expression))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "; "))
+	}
+	in := &evaluator.Interpreter{Builtins: s.interpreter.Builtins}
+	result := in.Eval(program, frame.Env)
+	if result == nil {
+		result = evaluator.NULL
+	}
+	if err, ok := result.(*object.Error); ok {
+		return nil, errors.New(err.Message)
+	}
+	v := s.variable("", result)
+	return EvaluateResponseBody{Result: v.Value, Type: v.Type, VariablesReference: v.VariablesReference}, nil
+}
+
+// terminate 停止正在运行的脚本并等待它结束
+func (s *Server) terminate(json.RawMessage) (interface{}, error) {
+	s.stop()
+	return nil, nil
+}
+
+// stop 停止脚本，暂停中的脚本以 ActionStop 继续执行，正在运行的脚本在下一条语句之前停止
+func (s *Server) stop() {
+	if !s.started {
+		return
+	}
+	s.debugger.Stop()
+	s.mu.Lock()
+	s.terminating = true
+	paused := s.frames != nil
+	s.mu.Unlock()
+	if paused {
+		s.continueWith(evaluator.ActionStop)
+	}
+	<-s.done
+}
+
+// output 把 puts 的输出转换为 output 事件
+type output struct {
+	s        *Server
+	category string
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	if err := o.s.event("output", OutputEventBody{Category: o.category, Output: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
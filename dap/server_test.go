@@ -0,0 +1,405 @@
+package dap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/hollykbuck/muskmelon/evaluator"
+	"github.com/hollykbuck/muskmelon/framing/framingtest"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// message 客户端收到的响应或者事件
+type message struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Command    string          `json:"command"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// client 在同一个进程中通过管道与 Server 通信的客户端
+type client struct {
+	*framingtest.Client
+	t   *testing.T
+	seq int
+	// events 等待响应时收到的事件
+	events []*message
+}
+
+func newClient(t *testing.T) *client {
+	return &client{Client: framingtest.NewClient(t, func(in io.Reader, out io.Writer) error {
+		return New(in, out).Serve()
+	}), t: t}
+}
+
+// next 读取下一条消息
+func (c *client) next() *message {
+	c.t.Helper()
+	m := &message{}
+	c.Next(m)
+	return m
+}
+
+// request 发送请求并等待响应，body 不为 nil 时解码响应的 body
+func (c *client) request(command string, args interface{}, body interface{}) *message {
+	c.t.Helper()
+	c.seq++
+	c.Send(map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	for {
+		m := c.next()
+		if m.Type == "event" {
+			c.events = append(c.events, m)
+			continue
+		}
+		if m.RequestSeq != c.seq || m.Command != command {
+			c.t.Fatalf("unexpected response %+v", m)
+		}
+		if body != nil && m.Success {
+			if err := json.Unmarshal(m.Body, body); err != nil {
+				c.t.Fatal(err)
+			}
+		}
+		return m
+	}
+}
+
+// mustRequest 发送请求并要求成功
+func (c *client) mustRequest(command string, args interface{}, body interface{}) {
+	c.t.Helper()
+	if m := c.request(command, args, body); !m.Success {
+		c.t.Fatalf("%s failed: %s", command, m.Message)
+	}
+}
+
+// event 等待指定的事件，跳过其他事件。body 不为 nil 时解码事件的 body。
+func (c *client) event(name string, body interface{}) {
+	c.t.Helper()
+	for {
+		var m *message
+		if len(c.events) > 0 {
+			m, c.events = c.events[0], c.events[1:]
+		} else {
+			m = c.next()
+		}
+		if m.Type != "event" || m.Event != name {
+			continue
+		}
+		if body != nil {
+			if err := json.Unmarshal(m.Body, body); err != nil {
+				c.t.Fatal(err)
+			}
+		}
+		return
+	}
+}
+
+const testScript = `let add = fn(a, b) {
+	let sum = a + b;
+	sum
+};
+let xs = [1, 2];
+let x = add(xs[0], 2);
+puts(x);
+add(x, 3)
+`
+
+// launch 初始化服务器并启动脚本，breakpoints 是脚本中的断点
+func (c *client) launch(stopOnEntry bool, breakpoints ...int) string {
+	c.t.Helper()
+	program := filepath.Join(c.t.TempDir(), "test.mk")
+	if err := os.WriteFile(program, []byte(testScript), 0o644); err != nil {
+		c.t.Fatal(err)
+	}
+	c.mustRequest("initialize", map[string]interface{}{"clientID": "test"}, nil)
+	c.event("initialized", nil)
+	c.mustRequest("launch", LaunchArguments{Program: program, StopOnEntry: stopOnEntry}, nil)
+	var lines []SourceBreakpoint
+	for _, line := range breakpoints {
+		lines = append(lines, SourceBreakpoint{Line: line})
+	}
+	c.mustRequest("setBreakpoints", SetBreakpointsArguments{Source: Source{Path: program}, Breakpoints: lines}, nil)
+	c.mustRequest("configurationDone", nil, nil)
+	return program
+}
+
+// stopped 等待 stopped 事件，返回原因和调用栈 "帧名:行号"
+func (c *client) stopped() (string, []string) {
+	c.t.Helper()
+	var event StoppedEventBody
+	c.event("stopped", &event)
+	var trace StackTraceResponseBody
+	c.mustRequest("stackTrace", StackTraceArguments{ThreadID: THREAD_ID}, &trace)
+	var frames []string
+	for _, frame := range trace.StackFrames {
+		frames = append(frames, fmt.Sprintf("%s:%d", frame.Name, frame.Line))
+	}
+	return event.Reason, frames
+}
+
+func TestLaunchAndStep(t *testing.T) {
+	c := newClient(t)
+	program := c.launch(true)
+	steps := []struct {
+		command string
+		reason  string
+		frames  []string
+	}{
+		{"", "entry", []string{"<main>:1"}},
+		{"next", "step", []string{"<main>:5"}},
+		{"next", "step", []string{"<main>:6"}},
+		{"stepIn", "step", []string{"add:2", "<main>:6"}},
+		{"next", "step", []string{"add:3", "<main>:6"}},
+		{"stepOut", "step", []string{"<main>:7"}},
+	}
+	for _, step := range steps {
+		if step.command != "" {
+			c.mustRequest(step.command, ThreadArguments{ThreadID: THREAD_ID}, nil)
+		}
+		reason, frames := c.stopped()
+		if reason != step.reason || !reflect.DeepEqual(frames, step.frames) {
+			t.Fatalf("after %q: got %s %v, want %s %v", step.command, reason, frames, step.reason, step.frames)
+		}
+	}
+	var trace StackTraceResponseBody
+	c.mustRequest("stackTrace", StackTraceArguments{ThreadID: THREAD_ID}, &trace)
+	if source := trace.StackFrames[0].Source; source.Path != program || source.Name != "test.mk" {
+		t.Errorf("wrong source %+v", source)
+	}
+	c.mustRequest("continue", ThreadArguments{ThreadID: THREAD_ID}, nil)
+	var out OutputEventBody
+	c.event("output", &out)
+	if out.Category != "stdout" || out.Output != "3\n" {
+		t.Errorf("wrong output %+v", out)
+	}
+	var exited ExitedEventBody
+	c.event("exited", &exited)
+	if exited.ExitCode != 0 {
+		t.Errorf("wrong exit code %d", exited.ExitCode)
+	}
+	c.event("terminated", nil)
+	c.mustRequest("disconnect", nil, nil)
+	if err := c.Wait(); err != nil {
+		t.Errorf("Serve returned %v", err)
+	}
+}
+
+func TestBreakpointsAndVariables(t *testing.T) {
+	c := newClient(t)
+	program := c.launch(false, 3, 8)
+	reason, frames := c.stopped()
+	if reason != "breakpoint" || !reflect.DeepEqual(frames, []string{"add:3", "<main>:6"}) {
+		t.Fatalf("got %s %v", reason, frames)
+	}
+	var scopes ScopesResponseBody
+	c.mustRequest("scopes", ScopesArguments{FrameID: 1}, &scopes)
+	if len(scopes.Scopes) != 2 || scopes.Scopes[0].Name != "Locals" || scopes.Scopes[1].Name != "Globals" {
+		t.Fatalf("wrong scopes %+v", scopes.Scopes)
+	}
+	variables := func(ref int) []Variable {
+		var body VariablesResponseBody
+		c.mustRequest("variables", VariablesArguments{VariablesReference: ref}, &body)
+		return body.Variables
+	}
+	locals := variables(scopes.Scopes[0].VariablesReference)
+	expected := []Variable{
+		{Name: "a", Value: "1", Type: "INTEGER"},
+		{Name: "b", Value: "2", Type: "INTEGER"},
+		{Name: "sum", Value: "3", Type: "INTEGER"},
+	}
+	if !reflect.DeepEqual(locals, expected) {
+		t.Errorf("locals wrong.\ngot=%+v\nwant=%+v", locals, expected)
+	}
+	globals := variables(scopes.Scopes[1].VariablesReference)
+	if len(globals) != 3 || globals[2].Name != "xs" || globals[2].VariablesReference == 0 {
+		t.Fatalf("globals wrong: %+v", globals)
+	}
+	elements := variables(globals[2].VariablesReference)
+	if len(elements) != 2 || elements[1].Name != "[1]" || elements[1].Value != "2" {
+		t.Errorf("elements wrong: %+v", elements)
+	}
+	var result EvaluateResponseBody
+	c.mustRequest("evaluate", EvaluateArguments{Expression: "sum * 10", FrameID: 1}, &result)
+	if result.Result != "30" || result.Type != "INTEGER" {
+		t.Errorf("evaluate wrong: %+v", result)
+	}
+	if m := c.request("evaluate", EvaluateArguments{Expression: "nope", FrameID: 2}, nil); m.Success || m.Message != "identifier not found: nope" {
+		t.Errorf("expected evaluate error, got %+v", m)
+	}
+	c.mustRequest("continue", ThreadArguments{ThreadID: THREAD_ID}, nil)
+	if _, frames := c.stopped(); !reflect.DeepEqual(frames, []string{"<main>:8"}) {
+		t.Fatalf("got %v", frames)
+	}
+	// 暂停时删除断点立即生效，第二次调用 add 时不会再停在第 3 行
+	c.mustRequest("setBreakpoints", SetBreakpointsArguments{Source: Source{Path: program}}, nil)
+	c.mustRequest("continue", ThreadArguments{ThreadID: THREAD_ID}, nil)
+	c.event("terminated", nil)
+	if m := c.request("stackTrace", StackTraceArguments{ThreadID: THREAD_ID}, nil); m.Success {
+		t.Errorf("expected stackTrace to fail after exit")
+	}
+}
+
+func TestDisconnectWhilePaused(t *testing.T) {
+	c := newClient(t)
+	c.launch(true)
+	c.stopped()
+	c.mustRequest("disconnect", nil, nil)
+	if err := c.Wait(); err != nil {
+		t.Errorf("Serve returned %v", err)
+	}
+}
+
+func TestModuleBreakpoints(t *testing.T) {
+	c := newClient(t)
+	dir := t.TempDir()
+	program := filepath.Join(dir, "main.mk")
+	lib := filepath.Join(dir, "lib.mk")
+	files := map[string]string{
+		program: "let inc = import \"lib\"[\"inc\"];\nlet x = inc(1);\nputs(x);\n",
+		lib:     "let one = 1;\nlet two = 2;\nexport let inc = fn(n) {\n\tn + one\n};\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.mustRequest("initialize", nil, nil)
+	c.mustRequest("launch", LaunchArguments{Program: program}, nil)
+	c.mustRequest("setBreakpoints", SetBreakpointsArguments{Source: Source{Path: program}, Breakpoints: []SourceBreakpoint{{Line: 2}}}, nil)
+	c.mustRequest("setBreakpoints", SetBreakpointsArguments{Source: Source{Path: lib}, Breakpoints: []SourceBreakpoint{{Line: 4}}}, nil)
+	c.mustRequest("configurationDone", nil, nil)
+	// 第 2 行的断点只在 main.mk 中生效，运行 lib.mk 的第 2 行时不会暂停
+	expected := [][]string{
+		{"<main> main.mk:2"},
+		{"inc lib.mk:4", "<main> main.mk:2"},
+	}
+	for i, want := range expected {
+		if i > 0 {
+			c.mustRequest("continue", ThreadArguments{ThreadID: THREAD_ID}, nil)
+		}
+		c.event("stopped", nil)
+		var trace StackTraceResponseBody
+		c.mustRequest("stackTrace", StackTraceArguments{ThreadID: THREAD_ID}, &trace)
+		var frames []string
+		for _, frame := range trace.StackFrames {
+			if frame.Source.Path != filepath.Join(dir, frame.Source.Name) {
+				t.Errorf("wrong source %+v", frame.Source)
+			}
+			frames = append(frames, fmt.Sprintf("%s %s:%d", frame.Name, frame.Source.Name, frame.Line))
+		}
+		if !reflect.DeepEqual(frames, want) {
+			t.Fatalf("stop %d: got %v, want %v", i, frames, want)
+		}
+	}
+	c.mustRequest("continue", ThreadArguments{ThreadID: THREAD_ID}, nil)
+	c.event("terminated", nil)
+}
+
+func TestTerminateRunning(t *testing.T) {
+	// 调用次数是 2 的 40 次方，不会自己结束
+	script := "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1); f(n - 1) } };\nf(40);\n"
+	for _, noDebug := range []bool{false, true} {
+		c := newClient(t)
+		program := filepath.Join(t.TempDir(), "loop.mk")
+		if err := os.WriteFile(program, []byte(script), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		c.mustRequest("initialize", nil, nil)
+		c.mustRequest("launch", LaunchArguments{Program: program, NoDebug: noDebug}, nil)
+		c.mustRequest("configurationDone", nil, nil)
+		c.mustRequest("terminate", nil, nil)
+		var exited ExitedEventBody
+		c.event("exited", &exited)
+		if exited.ExitCode != 0 {
+			t.Errorf("noDebug=%v: wrong exit code %d", noDebug, exited.ExitCode)
+		}
+		c.event("terminated", nil)
+		c.mustRequest("disconnect", nil, nil)
+		if err := c.Wait(); err != nil {
+			t.Errorf("noDebug=%v: Serve returned %v", noDebug, err)
+		}
+	}
+}
+
+func TestLaunchErrors(t *testing.T) {
+	c := newClient(t)
+	c.mustRequest("initialize", nil, nil)
+	if m := c.request("launch", LaunchArguments{Program: filepath.Join(t.TempDir(), "missing.mk")}, nil); m.Success {
+		t.Errorf("expected launch of missing file to fail")
+	}
+	bad := filepath.Join(t.TempDir(), "bad.mk")
+	if err := os.WriteFile(bad, []byte("let = 1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if m := c.request("launch", LaunchArguments{Program: bad}, nil); m.Success {
+		t.Errorf("expected launch of invalid script to fail")
+	}
+	if m := c.request("pause", ThreadArguments{ThreadID: THREAD_ID}, nil); m.Success || m.Message != "unsupported command: pause" {
+		t.Errorf("expected pause to be unsupported, got %+v", m)
+	}
+	if m := c.request("continue", ThreadArguments{ThreadID: THREAD_ID}, nil); m.Success {
+		t.Errorf("expected continue to fail when not paused")
+	}
+}
+
+// lockedBuffer 可以在多个 goroutine 中读写的 bytes.Buffer
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestResponseBeforeResume(t *testing.T) {
+	for command, action := range resumeActions {
+		out := &lockedBuffer{}
+		s := New(nil, out)
+		s.frames = []*evaluator.Frame{{Name: "<main>"}}
+		// 脚本收到继续执行的方式时，响应必须已经发出，之后的 stopped 等事件才会排在响应后面
+		written := make(chan string)
+		go func() {
+			if got := <-s.resume; got != action {
+				t.Errorf("%s: wrong action %v", command, got)
+			}
+			written <- out.String()
+		}()
+		if err := s.handle(&Request{Seq: 1, Command: command}); err != nil {
+			t.Fatal(err)
+		}
+		if got := <-written; !strings.Contains(got, `"command":"`+command+`"`) {
+			t.Errorf("%s: script resumed before the response was sent, output %q", command, got)
+		}
+	}
+}
+
+func TestInvalidMessage(t *testing.T) {
+	c := newClient(t)
+	c.Write([]byte("{not json"))
+	if m := c.next(); m.Type != "response" || m.Success || !strings.HasPrefix(m.Message, "invalid message: ") {
+		t.Fatalf("expected error response, got %+v", m)
+	}
+	c.mustRequest("initialize", nil, nil)
+	c.mustRequest("disconnect", nil, nil)
+	if err := c.Wait(); err != nil {
+		t.Errorf("Serve returned %v", err)
+	}
+}
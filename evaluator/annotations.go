@@ -0,0 +1,71 @@
+package evaluator
+
+import (
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/object"
+	"strings"
+)
+
+// annotationTypes 类型标注中的名字对应的对象类型，any 不做检查
+var annotationTypes = map[string][]object.ObjectType{
+	"int":    {object.INTEGER_OBJ},
+	"string": {object.STRING_OBJ},
+	"bool":   {object.BOOLEAN_OBJ},
+	"null":   {object.NULL_OBJ},
+	"array":  {object.ARRAY_OBJ},
+	"hash":   {object.HASH_OBJ},
+	"fn":     {object.FUNCTION_OBJ, object.BUILTIN_OBJ},
+}
+
+// checkAnnotation 检查值是否符合类型标注，不符合时返回类型错误。
+// annotation 为 nil 表示没有标注，不做检查。what 描述被检查的值，用于错误信息。
+func checkAnnotation(annotation *ast.TypeAnnotation, val object.Object, what string) *object.Error {
+	if annotation == nil || matchesAnnotation(annotation, val) {
+		return nil
+	}
+	return newError("type error: %s expects %s, got %s", what, annotation, describeType(val))
+}
+
+func matchesAnnotation(annotation *ast.TypeAnnotation, val object.Object) bool {
+	if annotation.Name == "any" {
+		return true
+	}
+	matched := false
+	for _, t := range annotationTypes[annotation.Name] {
+		matched = matched || val.Type() == t
+	}
+	if !matched || annotation.Elem == nil {
+		return matched
+	}
+	for _, element := range val.(*object.Array).Elements {
+		if !matchesAnnotation(annotation.Elem, element) {
+			return false
+		}
+	}
+	return true
+}
+
+// describeType 用类型标注的写法描述值的类型，元素类型都相同的非空数组描述为 [T]
+func describeType(val object.Object) string {
+	switch v := val.(type) {
+	case *object.Array:
+		if len(v.Elements) == 0 {
+			return "array"
+		}
+		elem := describeType(v.Elements[0])
+		for _, element := range v.Elements[1:] {
+			if describeType(element) != elem {
+				return "array"
+			}
+		}
+		return "[" + elem + "]"
+	case *object.Builtin:
+		return "fn"
+	}
+	for name, types := range annotationTypes {
+		if types[0] == val.Type() {
+			return name
+		}
+	}
+	return strings.ToLower(string(val.Type()))
+}
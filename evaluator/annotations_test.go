@@ -0,0 +1,83 @@
+package evaluator
+
+import (
+	"github.com/hollykbuck/muskmelon/object"
+	"testing"
+)
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x: int = 5; x;", 5},
+		{"let x: any = 5; x;", 5},
+		{"let xs: [int] = [1, 2]; len(xs);", 2},
+		{"let xs: [int] = []; len(xs);", 0},
+		{"let xs: array = [1, \"a\"]; len(xs);", 2},
+		{"let f: fn = len; f(\"ab\");", 2},
+		{"let add = fn(a: int, b: int): int { a + b }; add(1, 2);", 3},
+		{"let add = fn(a: int, b) { a + b }; add(1, 2);", 3},
+		{"let f = fn(s: string): int { return len(s); }; f(\"abc\");", 3},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTypeAnnotationErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{
+			`let x: int = "five";`,
+			"type error: let x expects int, got string",
+		},
+		{
+			`let xs: [int] = [1, "two"];`,
+			"type error: let xs expects [int], got array",
+		},
+		{
+			`let xs: [string] = [1];`,
+			"type error: let xs expects [string], got [int]",
+		},
+		{
+			`let f = fn(a: string, b: int) { a }; f(1, 2);`,
+			"type error: argument a expects string, got int",
+		},
+		{
+			`let f = fn(a: string, b: int) { a }; f("a", true);`,
+			"type error: argument b expects int, got bool",
+		},
+		{
+			`let f = fn(a): bool { a }; f(1);`,
+			"type error: return value expects bool, got int",
+		},
+		{
+			`let f = fn(): int { if (false) { 1 } }; f();`,
+			"type error: return value expects int, got null",
+		},
+		{
+			`let f = fn(a: fn) { a }; f([]);`,
+			"type error: argument a expects fn, got array",
+		},
+		{
+			`let f = fn(a, b) { a }; f(1);`,
+			"wrong number of arguments. got=1, want=2",
+		},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)",
+				tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
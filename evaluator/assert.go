@@ -0,0 +1,133 @@
+package evaluator
+
+import (
+	"fmt"
+	"github.com/hollykbuck/muskmelon/object"
+	"strings"
+)
+
+// ASSERTION_FAILED 断言失败时错误信息的前缀
+const ASSERTION_FAILED = "assertion failed"
+
+// assertionError 创建断言失败的错误，message 是脚本传入的说明，可以为 nil
+func assertionError(message object.Object, format string, a ...interface{}) *object.Error {
+	msg := ASSERTION_FAILED
+	if message != nil {
+		msg += ": " + message.Inspect()
+	}
+	if format != "" {
+		msg += ": " + fmt.Sprintf(format, a...)
+	}
+	return &object.Error{Message: msg}
+}
+
+// optionalMessage 取出可选的最后一个说明参数
+func optionalMessage(name string, args []object.Object, required int) (object.Object, *object.Error) {
+	switch len(args) {
+	case required:
+		return nil, nil
+	case required + 1:
+		return args[required], nil
+	}
+	return nil, newError("wrong number of arguments to `%s`. got=%d, want=%d or %d", name, len(args), required, required+1)
+}
+
+// assert(condition, [message]) condition 不为真时失败
+func assert(args ...object.Object) object.Object {
+	message, err := optionalMessage("assert", args, 1)
+	if err != nil {
+		return err
+	}
+	if !isTruthy(args[0]) {
+		return assertionError(message, "")
+	}
+	return NULL
+}
+
+// assertEq(actual, expected, [message]) 两个值不相等时失败，数组和 Hash 逐个比较元素
+func assertEq(args ...object.Object) object.Object {
+	message, err := optionalMessage("assertEq", args, 2)
+	if err != nil {
+		return err
+	}
+	if !objectsEqual(args[0], args[1]) {
+		return assertionError(message, "got %s, want %s", args[0].Inspect(), args[1].Inspect())
+	}
+	return NULL
+}
+
+// assertError(fn, [substring]) 不带参数调用 fn，没有返回错误，
+// 或者错误信息不包含 substring 时失败
+func assertError(apply object.ApplyFunction, args ...object.Object) object.Object {
+	substring, err := optionalMessage("assertError", args, 1)
+	if err != nil {
+		return err
+	}
+	switch args[0].(type) {
+	case *object.Function, *object.Builtin:
+	default:
+		return newError("argument to `assertError` must be FUNCTION, got %s", args[0].Type())
+	}
+	result := apply(args[0])
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		got := "null"
+		if result != nil {
+			got = result.Inspect()
+		}
+		return assertionError(nil, "expected an error, got %s", got)
+	}
+	if substring != nil {
+		want, ok := substring.(*object.String)
+		if !ok {
+			return newError("second argument to `assertError` must be STRING, got %s", substring.Type())
+		}
+		if !strings.Contains(errObj.Message, want.Value) {
+			return assertionError(nil, "error %q does not contain %q", errObj.Message, want.Value)
+		}
+	}
+	return NULL
+}
+
+// objectsEqual 比较两个值是否相等
+func objectsEqual(a object.Object, b object.Object) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a := a.(type) {
+	case *object.Integer:
+		return a.Value == b.(*object.Integer).Value
+	case *object.String:
+		return a.Value == b.(*object.String).Value
+	case *object.Array:
+		other := b.(*object.Array)
+		if len(a.Elements) != len(other.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !objectsEqual(a.Elements[i], other.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		other := b.(*object.Hash)
+		if len(a.Pairs) != len(other.Pairs) {
+			return false
+		}
+		for key, pair := range a.Pairs {
+			otherPair, ok := other.Pairs[key]
+			if !ok || !objectsEqual(pair.Value, otherPair.Value) {
+				return false
+			}
+		}
+		return true
+	case *object.Error:
+		return a.Message == b.(*object.Error).Message
+	}
+	// 布尔值和 null 是单例，函数按引用比较
+	return a == b
+}
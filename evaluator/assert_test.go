@@ -0,0 +1,54 @@
+package evaluator
+
+import (
+	"github.com/hollykbuck/muskmelon/object"
+	"testing"
+)
+
+func TestAssertions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`assert(1 < 2)`, ""},
+		{`assert(1 > 2)`, "assertion failed"},
+		{`assert(false, "must hold")`, "assertion failed: must hold"},
+		{`assert()`, "wrong number of arguments to `assert`. got=0, want=1 or 2"},
+		{`assertEq(1 + 1, 2)`, ""},
+		{`assertEq([1, [2, "a"]], [1, [2, "a"]])`, ""},
+		{`assertEq([1, 2], [1, 3])`, "assertion failed: got [1, 2], want [1, 3]"},
+		{`assertEq("a", 1, "mixed")`, "assertion failed: mixed: got a, want 1"},
+		{`let f = fn() { 1 }; assertEq(f, f)`, ""},
+		{`assertEq(true, !false)`, ""},
+		{`assertError(fn() { 1 + true })`, ""},
+		{`assertError(fn() { 1 + true }, "type mismatch")`, ""},
+		{`assertError(fn() { 1 + true }, "nope")`, `assertion failed: error "type mismatch: INTEGER + BOOLEAN" does not contain "nope"`},
+		{`assertError(fn() { 1 })`, "assertion failed: expected an error, got 1"},
+		{`assertError(fn() { let x = 1; })`, "assertion failed: expected an error, got null"},
+		{`assertError(1)`, "argument to `assertError` must be FUNCTION, got INTEGER"},
+	}
+	for _, tt := range tests {
+		evaluated := testEvalWith(New(), tt.input)
+		if tt.expected == "" {
+			testNullObject(t, evaluated)
+			continue
+		}
+		testErrorObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBuiltinErrorPos(t *testing.T) {
+	evaluated := testEvalWith(New(), "let f = fn() {\n  assert(false)\n};\nf()")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("expected error, got %T", evaluated)
+	}
+	if errObj.Pos.String() != "2:3" {
+		t.Errorf("wrong error position. got=%s", errObj.Pos)
+	}
+	// 其他函数传回的错误保留最初的位置
+	evaluated = testEvalWith(New(), "assertError(fn() { len(1) }, \"nope\")")
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Pos.String() != "1:1" {
+		t.Errorf("wrong error position. got=%v", evaluated)
+	}
+}
@@ -1,8 +1,15 @@
 package evaluator
 
-import "github.com/hollykbuck/muskmelon/object"
+import (
+	"fmt"
+	"github.com/hollykbuck/muskmelon/object"
+	"io"
+	"os"
+	"sort"
+)
 
-var builtins = map[string]*object.Builtin{
+// defaultBuiltins 语言自带的内置函数
+var defaultBuiltins = map[string]*object.Builtin{
 	"len": {
 		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
@@ -12,10 +19,145 @@ var builtins = map[string]*object.Builtin{
 			switch arg := args[0].(type) {
 			case *object.String:
 				return &object.Integer{Value: int64(len(arg.Value))}
+			case *object.Array:
+				return &object.Integer{Value: int64(len(arg.Elements))}
 			default:
 				return newError("argument to `len` not supported, got %s",
 					args[0].Type())
 			}
 		},
 	},
+	"puts":        Puts(os.Stdout),
+	"assert":      {Fn: assert},
+	"assertEq":    {Fn: assertEq},
+	"assertError": {HigherOrder: assertError},
+}
+
+// Puts 创建 puts 内置函数，逐行把参数写入 out
+func Puts(out io.Writer) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			for _, arg := range args {
+				if _, err := fmt.Fprintln(out, arg.Inspect()); err != nil {
+					return newError("puts: %s", err)
+				}
+			}
+			return NULL
+		},
+	}
+}
+
+// builtins 包级别 Eval 使用的内置函数
+var builtins = DefaultBuiltins()
+
+// Builtins 内置函数表。
+// 每个 Interpreter 持有自己的 Builtins，可以单独增加、替换或者删除内置函数。
+// 命名空间中的内置函数以 Hash 的形式暴露给脚本，例如 math["abs"](-1)。
+type Builtins struct {
+	entries    map[string]*object.Builtin
+	namespaces map[string]*Builtins
+}
+
+// NewBuiltins 创建一个空的内置函数表
+func NewBuiltins() *Builtins {
+	return &Builtins{
+		entries:    make(map[string]*object.Builtin),
+		namespaces: make(map[string]*Builtins),
+	}
+}
+
+// DefaultBuiltins 创建包含语言自带内置函数的内置函数表
+func DefaultBuiltins() *Builtins {
+	b := NewBuiltins()
+	for name, builtin := range defaultBuiltins {
+		b.Set(name, builtin)
+	}
+	return b
+}
+
+// Set 增加或者替换内置函数
+func (b *Builtins) Set(name string, builtin *object.Builtin) {
+	b.entries[name] = builtin
+}
+
+// Register 通过反射把 Go 函数注册为内置函数，参见 NewNativeBuiltin
+func (b *Builtins) Register(name string, fn interface{}) error {
+	builtin, err := NewNativeBuiltin(fn)
+	if err != nil {
+		return err
+	}
+	b.Set(name, builtin)
+	return nil
+}
+
+// Get 查询内置函数，不包含命名空间
+func (b *Builtins) Get(name string) (*object.Builtin, bool) {
+	builtin, ok := b.entries[name]
+	return builtin, ok
+}
+
+// Remove 删除内置函数或者命名空间
+func (b *Builtins) Remove(name string) {
+	delete(b.entries, name)
+	delete(b.namespaces, name)
+}
+
+// Namespace 返回名为 name 的命名空间，不存在时创建
+func (b *Builtins) Namespace(name string) *Builtins {
+	ns, ok := b.namespaces[name]
+	if !ok {
+		ns = NewBuiltins()
+		b.namespaces[name] = ns
+	}
+	return ns
+}
+
+// Lookup 按名字查询脚本中可见的对象。
+// 内置函数优先于同名的命名空间，命名空间会被转换为 Hash。
+func (b *Builtins) Lookup(name string) (object.Object, bool) {
+	if builtin, ok := b.entries[name]; ok {
+		return builtin, true
+	}
+	if ns, ok := b.namespaces[name]; ok {
+		return ns.hash(), true
+	}
+	return nil, false
+}
+
+// Names 返回所有内置函数和命名空间的名字，按字典序排序
+func (b *Builtins) Names() []string {
+	names := make([]string, 0, len(b.entries)+len(b.namespaces))
+	for name := range b.entries {
+		names = append(names, name)
+	}
+	for name := range b.namespaces {
+		if _, ok := b.entries[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Clone 深拷贝内置函数表，修改副本不会影响原表
+func (b *Builtins) Clone() *Builtins {
+	clone := NewBuiltins()
+	for name, builtin := range b.entries {
+		clone.entries[name] = builtin
+	}
+	for name, ns := range b.namespaces {
+		clone.namespaces[name] = ns.Clone()
+	}
+	return clone
+}
+
+// hash 将命名空间转换为 Hash 对象
+func (b *Builtins) hash() *object.Hash {
+	pairs := make(map[object.HashKey]object.HashPair)
+	for _, name := range b.Names() {
+		value, _ := b.Lookup(name)
+		key := &object.String{Value: name}
+		pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+	return &object.Hash{Pairs: pairs}
 }
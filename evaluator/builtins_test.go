@@ -0,0 +1,78 @@
+package evaluator
+
+import (
+	"github.com/hollykbuck/muskmelon/lexer"
+	"github.com/hollykbuck/muskmelon/object"
+	"github.com/hollykbuck/muskmelon/parser"
+	"testing"
+)
+
+// testEvalWith 使用指定的 Interpreter 运行 input 代码
+func testEvalWith(in *Interpreter, input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	return in.Eval(program, object.NewEnvironment())
+}
+
+// TestBuiltinsIsolation 测试不同 Interpreter 的内置函数互不影响
+func TestBuiltinsIsolation(t *testing.T) {
+	first := New()
+	second := New()
+	if err := first.Builtins.Register("double", func(n int64) int64 { return n * 2 }); err != nil {
+		t.Fatalf("Register failed: %s", err)
+	}
+	second.Builtins.Remove("len")
+
+	testIntegerObject(t, testEvalWith(first, "double(21)"), 42)
+	testIntegerObject(t, testEvalWith(first, `len("abc")`), 3)
+	testErrorObject(t, testEvalWith(second, "double(21)"), "identifier not found: double")
+	testErrorObject(t, testEvalWith(second, `len("abc")`), "identifier not found: len")
+	testIntegerObject(t, testEval(`len("abc")`), 3)
+	if _, ok := builtins.Get("double"); ok {
+		t.Errorf("package builtins were modified by an interpreter")
+	}
+}
+
+func TestBuiltinsReplaceAndNamespace(t *testing.T) {
+	in := &Interpreter{Builtins: NewBuiltins()}
+	if err := in.Builtins.Register("len", func(s string) int { return -1 }); err != nil {
+		t.Fatalf("Register failed: %s", err)
+	}
+	math := in.Builtins.Namespace("math")
+	if err := math.Register("abs", func(n int64) int64 {
+		if n < 0 {
+			return -n
+		}
+		return n
+	}); err != nil {
+		t.Fatalf("Register failed: %s", err)
+	}
+	testIntegerObject(t, testEvalWith(in, `len("abc")`), -1)
+	testErrorObject(t, testEvalWith(in, `puts("abc")`), "identifier not found: puts")
+	testIntegerObject(t, testEvalWith(in, `math["abs"](-5)`), 5)
+	testIntegerObject(t, testEvalWith(in, `let math = 1; math`), 1)
+
+	clone := in.Builtins.Clone()
+	clone.Namespace("math").Remove("abs")
+	testIntegerObject(t, testEvalWith(in, `math["abs"](-5)`), 5)
+
+	names := in.Builtins.Names()
+	if len(names) != 2 || names[0] != "len" || names[1] != "math" {
+		t.Errorf("Names() wrong. got=%v", names)
+	}
+}
+
+// testErrorObject 检查 eval 的结果是否为错误对象，检查错误信息是否为 expected
+func testErrorObject(t *testing.T, obj object.Object, expected string) bool {
+	errObj, ok := obj.(*object.Error)
+	if !ok {
+		t.Errorf("object is not Error. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package evaluator
+
+import "github.com/hollykbuck/muskmelon/ast"
+
+// Coverage 记录执行过的语句和 if 表达式的分支。
+// 设置到 Interpreter.Coverage 之后生效，按节点记录执行次数，可以在多次运行之间累计。
+type Coverage struct {
+	statements map[ast.Statement]int
+	branches   map[*ast.IfExpression]*[2]int
+}
+
+// NewCoverage Coverage 的构造函数
+func NewCoverage() *Coverage {
+	return &Coverage{
+		statements: make(map[ast.Statement]int),
+		branches:   make(map[*ast.IfExpression]*[2]int),
+	}
+}
+
+// Reset 清空记录
+func (c *Coverage) Reset() {
+	c.statements = make(map[ast.Statement]int)
+	c.branches = make(map[*ast.IfExpression]*[2]int)
+}
+
+// StatementHits 语句执行的次数
+func (c *Coverage) StatementHits(statement ast.Statement) int {
+	return c.statements[statement]
+}
+
+// BranchHits if 表达式选择 Consequence 和 Alternative 的次数。
+// 没有 else 的 if 在条件为假时也计入 alternative。
+func (c *Coverage) BranchHits(ie *ast.IfExpression) (consequence int, alternative int) {
+	if hits, ok := c.branches[ie]; ok {
+		return hits[0], hits[1]
+	}
+	return 0, 0
+}
+
+// statement 在语句执行之前调用
+func (c *Coverage) statement(statement ast.Statement) {
+	c.statements[statement]++
+}
+
+// branch 在 if 表达式选择分支之后调用
+func (c *Coverage) branch(ie *ast.IfExpression, consequence bool) {
+	hits, ok := c.branches[ie]
+	if !ok {
+		hits = &[2]int{}
+		c.branches[ie] = hits
+	}
+	if consequence {
+		hits[0]++
+	} else {
+		hits[1]++
+	}
+}
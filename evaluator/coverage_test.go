@@ -0,0 +1,44 @@
+package evaluator
+
+import (
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/lexer"
+	"github.com/hollykbuck/muskmelon/object"
+	"github.com/hollykbuck/muskmelon/parser"
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+	program := parser.New(lexer.New(`let f = fn(x) { if (x) { 1 } };
+f(true); f(false); f(true);
+if (y) { 2 }`)).ParseProgram()
+	coverage := NewCoverage()
+	in := New()
+	in.Coverage = coverage
+	in.Eval(program, object.NewEnvironment())
+	var ifs []*ast.IfExpression
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ie, ok := node.(*ast.IfExpression); ok {
+			ifs = append(ifs, ie)
+		}
+		return true
+	})
+	if consequence, alternative := coverage.BranchHits(ifs[0]); consequence != 2 || alternative != 1 {
+		t.Errorf("branch hits wrong. got=%d,%d", consequence, alternative)
+	}
+	// 条件出错时不记录分支
+	if consequence, alternative := coverage.BranchHits(ifs[1]); consequence != 0 || alternative != 0 {
+		t.Errorf("branch hits of erroneous condition wrong. got=%d,%d", consequence, alternative)
+	}
+	if hits := coverage.StatementHits(program.Statements[1]); hits != 1 {
+		t.Errorf("statement hits wrong. got=%d", hits)
+	}
+	body := program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral).Body
+	if hits := coverage.StatementHits(body.Statements[0]); hits != 3 {
+		t.Errorf("function body hits wrong. got=%d", hits)
+	}
+	coverage.Reset()
+	if hits := coverage.StatementHits(program.Statements[1]); hits != 0 {
+		t.Errorf("Reset did not clear hits")
+	}
+}
@@ -0,0 +1,208 @@
+package evaluator
+
+import (
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/object"
+	"github.com/hollykbuck/muskmelon/token"
+	"sort"
+	"sync/atomic"
+)
+
+// Action 调试器暂停之后继续执行的方式
+type Action int
+
+const (
+	// ActionContinue 运行到下一个断点
+	ActionContinue Action = iota
+	// ActionStepIn 停在下一条语句，包括被调用的函数中的语句
+	ActionStepIn
+	// ActionStepOver 停在当前函数或者调用者的下一条语句，不进入被调用的函数
+	ActionStepOver
+	// ActionStepOut 停在调用者的下一条语句
+	ActionStepOut
+	// ActionStop 停止执行，Eval 返回 ErrStopped 错误
+	ActionStop
+)
+
+// StopReason 调试器暂停的原因
+type StopReason string
+
+const (
+	StopEntry      StopReason = "entry"
+	StopBreakpoint StopReason = "breakpoint"
+	StopStep       StopReason = "step"
+)
+
+// ErrStopped 调试器停止执行时 Eval 返回的错误信息
+const ErrStopped = "execution stopped by debugger"
+
+// MAIN_FRAME 顶层代码的帧的名字
+const MAIN_FRAME = "<main>"
+
+// ANONYMOUS_FRAME 不是通过名字调用的函数的帧的名字
+const ANONYMOUS_FRAME = "<anonymous>"
+
+// Frame 调用栈中的一帧
+type Frame struct {
+	// Name 被调用的函数的名字，顶层代码和模块的顶层代码为 MAIN_FRAME
+	Name string
+	// File 这一帧的代码所在的文件，即运行时的 Interpreter.File 或者定义函数时的文件
+	File string
+	// Call 创建这一帧的调用表达式，顶层代码为 nil
+	Call *ast.CallExpression
+	// Function 被调用的函数，顶层代码为 nil
+	Function *object.Function
+	// Env 这一帧的 environment，外层作用域通过 Env.Outer() 访问
+	Env *object.Environment
+	// Statement 这一帧中正在执行的语句
+	Statement ast.Statement
+}
+
+// Pos 正在执行的语句的位置
+func (f *Frame) Pos() token.Position {
+	return ast.StatementPos(f.Statement)
+}
+
+// Line 正在执行的语句所在的行，没有位置信息时为 0
+func (f *Frame) Line() int {
+	return f.Pos().Line
+}
+
+// Debugger 在每条语句执行之前检查断点和单步执行的调试器。
+// 设置到 Interpreter.Debugger 之后生效，同一时间只能被一个 Interpreter 使用。
+type Debugger struct {
+	// OnStop 暂停时在执行 Eval 的 goroutine 中调用，返回值决定如何继续执行。
+	// 在 OnStop 中可以通过 Frames 查看调用栈，修改断点。
+	OnStop func(d *Debugger, reason StopReason) Action
+	// StopOnEntry 在第一条语句之前暂停
+	StopOnEntry bool
+	breakpoints map[breakpoint]bool
+	frames      []*Frame
+	action      Action
+	// depth 发出 step over 或者 step out 时调用栈的深度
+	depth int
+	// entered 是否已经执行过第一条语句
+	entered bool
+	// stopped 由 Stop 设置，可以在其他 goroutine 中访问
+	stopped atomic.Bool
+}
+
+// breakpoint 断点所在的文件和行
+type breakpoint struct {
+	file string
+	line int
+}
+
+// NewDebugger Debugger 的构造函数
+func NewDebugger(onStop func(d *Debugger, reason StopReason) Action) *Debugger {
+	return &Debugger{OnStop: onStop, breakpoints: make(map[breakpoint]bool)}
+}
+
+// SetBreakpoint 在 file 的 line 行设置断点，行号从 1 开始。
+// file 与帧的 File 比较，没有设置 Interpreter.File 时为空字符串。
+func (d *Debugger) SetBreakpoint(file string, line int) {
+	d.breakpoints[breakpoint{file, line}] = true
+}
+
+// ClearBreakpoint 删除 file 的 line 行的断点
+func (d *Debugger) ClearBreakpoint(file string, line int) {
+	delete(d.breakpoints, breakpoint{file, line})
+}
+
+// ClearBreakpoints 删除所有文件的断点
+func (d *Debugger) ClearBreakpoints() {
+	d.breakpoints = make(map[breakpoint]bool)
+}
+
+// Breakpoints file 中按行号排序的断点
+func (d *Debugger) Breakpoints(file string) []int {
+	var lines []int
+	for bp := range d.breakpoints {
+		if bp.file == file {
+			lines = append(lines, bp.line)
+		}
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// Frames 当前的调用栈，最内层的帧在最前面
+func (d *Debugger) Frames() []*Frame {
+	frames := make([]*Frame, len(d.frames))
+	for i, frame := range d.frames {
+		frames[len(frames)-1-i] = frame
+	}
+	return frames
+}
+
+// Reset 清空调用栈、单步执行的状态和 Stop 的请求，断点保持不变。
+// 用于开始一次新的运行，下一条语句会重新检查 StopOnEntry。
+func (d *Debugger) Reset() {
+	d.frames = nil
+	d.action = ActionContinue
+	d.entered = false
+	d.stopped.Store(false)
+}
+
+// Stop 让正在运行的 Eval 在下一条语句之前停止并返回 ErrStopped 错误，不需要暂停。
+// 可以在其他 goroutine 中调用，直到 Reset 之前的运行都会被停止。
+func (d *Debugger) Stop() {
+	d.stopped.Store(true)
+}
+
+// push 进入一帧
+func (d *Debugger) push(frame *Frame) {
+	d.frames = append(d.frames, frame)
+}
+
+// pop 离开最内层的帧
+func (d *Debugger) pop() {
+	d.frames = d.frames[:len(d.frames)-1]
+}
+
+// before 在语句执行之前调用，需要停止执行时返回错误
+func (d *Debugger) before(statement ast.Statement, env *object.Environment, file string) *object.Error {
+	if d.stopped.Load() {
+		return newError(ErrStopped)
+	}
+	if len(d.frames) == 0 {
+		// 直接 Eval 语句或者块时没有经过 evalProgram
+		d.push(&Frame{Name: MAIN_FRAME, File: file, Env: env})
+	}
+	frame := d.frames[len(d.frames)-1]
+	previous := frame.Line()
+	frame.Statement = statement
+	line := frame.Line()
+	var reason StopReason
+	switch {
+	case !d.entered && d.StopOnEntry:
+		reason = StopEntry
+	case d.action == ActionStepIn,
+		d.action == ActionStepOver && len(d.frames) <= d.depth,
+		d.action == ActionStepOut && len(d.frames) < d.depth:
+		reason = StopStep
+	// 同一行的多条语句只在第一条语句处停下
+	case d.breakpoints[breakpoint{frame.File, line}] && line != previous:
+		reason = StopBreakpoint
+	}
+	d.entered = true
+	if reason == "" || d.OnStop == nil {
+		return nil
+	}
+	d.action = d.OnStop(d, reason)
+	d.depth = len(d.frames)
+	if d.action == ActionStop {
+		return newError(ErrStopped)
+	}
+	return nil
+}
+
+// frameName 调用表达式中函数的名字
+func frameName(call *ast.CallExpression) string {
+	if call != nil {
+		if ident, ok := call.Function.(*ast.Identifier); ok {
+			return ident.Value
+		}
+	}
+	return ANONYMOUS_FRAME
+}
@@ -0,0 +1,167 @@
+package evaluator
+
+import (
+	"fmt"
+	"github.com/hollykbuck/muskmelon/object"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const debugInput = `let add = fn(a, b) {
+	let sum = a + b;
+	sum
+};
+let x = add(1, 2);
+let y = add(x, 3);
+y`
+
+// debugRun 运行 debugInput，每次暂停时记录 "原因 帧名:行号" 并按顺序执行 actions 中的动作，
+// 动作用完之后继续运行到结束
+func debugRun(t *testing.T, setup func(d *Debugger), actions ...Action) ([]string, object.Object) {
+	t.Helper()
+	var stops []string
+	d := NewDebugger(func(d *Debugger, reason StopReason) Action {
+		frame := d.Frames()[0]
+		stops = append(stops, fmt.Sprintf("%s %s:%d", reason, frame.Name, frame.Line()))
+		if len(stops) > len(actions) {
+			return ActionContinue
+		}
+		return actions[len(stops)-1]
+	})
+	setup(d)
+	in := New()
+	in.Debugger = d
+	result := testEvalWith(in, debugInput)
+	if frames := d.Frames(); len(frames) != 0 {
+		t.Errorf("frames left after run: %d", len(frames))
+	}
+	return stops, result
+}
+
+func TestDebuggerStepping(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(d *Debugger)
+		actions  []Action
+		expected []string
+	}{
+		{
+			"breakpoints",
+			func(d *Debugger) { d.SetBreakpoint("", 2); d.SetBreakpoint("", 6) },
+			nil,
+			[]string{"breakpoint add:2", "breakpoint <main>:6", "breakpoint add:2"},
+		},
+		{
+			"cleared breakpoint",
+			func(d *Debugger) { d.SetBreakpoint("", 2); d.SetBreakpoint("", 6); d.ClearBreakpoint("", 2) },
+			nil,
+			[]string{"breakpoint <main>:6"},
+		},
+		{
+			"step in",
+			func(d *Debugger) { d.StopOnEntry = true },
+			[]Action{ActionStepIn, ActionStepIn, ActionStepIn, ActionStepIn, ActionStop},
+			[]string{"entry <main>:1", "step <main>:5", "step add:2", "step add:3", "step <main>:6"},
+		},
+		{
+			"step over",
+			func(d *Debugger) { d.StopOnEntry = true },
+			[]Action{ActionStepOver, ActionStepOver, ActionStepOver, ActionStepOver},
+			[]string{"entry <main>:1", "step <main>:5", "step <main>:6", "step <main>:7"},
+		},
+		{
+			"step out",
+			func(d *Debugger) { d.SetBreakpoint("", 2) },
+			[]Action{ActionStepOut, ActionStepOut},
+			[]string{"breakpoint add:2", "step <main>:6", "breakpoint add:2"},
+		},
+	}
+	for _, tt := range tests {
+		stops, _ := debugRun(t, tt.setup, tt.actions...)
+		if !reflect.DeepEqual(stops, tt.expected) {
+			t.Errorf("%s: stops wrong.\ngot=%q\nwant=%q", tt.name, stops, tt.expected)
+		}
+	}
+}
+
+func TestDebuggerStop(t *testing.T) {
+	_, result := debugRun(t, func(d *Debugger) { d.SetBreakpoint("", 2) }, ActionStop)
+	errObj, ok := result.(*object.Error)
+	if !ok || errObj.Message != ErrStopped {
+		t.Errorf("expected %q error, got %v", ErrStopped, result)
+	}
+	_, result = debugRun(t, func(d *Debugger) {})
+	testIntegerObject(t, result, 6)
+	// Stop 不需要暂停，OnStop 不会被调用
+	stops, result := debugRun(t, func(d *Debugger) { d.SetBreakpoint("", 2); d.Stop() })
+	if errObj, ok := result.(*object.Error); !ok || errObj.Message != ErrStopped || len(stops) != 0 {
+		t.Errorf("expected %q error without stops, got %v %q", ErrStopped, result, stops)
+	}
+}
+
+func TestDebuggerFrames(t *testing.T) {
+	var stack []string
+	d := NewDebugger(func(d *Debugger, reason StopReason) Action {
+		for _, frame := range d.Frames() {
+			var scopes []string
+			for env := frame.Env; env != nil; env = env.Outer() {
+				scopes = append(scopes, strings.Join(env.Names(), ","))
+			}
+			stack = append(stack, fmt.Sprintf("%s:%d [%s]", frame.Name, frame.Line(), strings.Join(scopes, " | ")))
+		}
+		return ActionContinue
+	})
+	d.SetBreakpoint("", 3)
+	in := New()
+	in.Debugger = d
+	testEvalWith(in, debugInput)
+	expected := []string{
+		"add:3 [a,b,sum | add]",
+		"<main>:5 [add]",
+		"add:3 [a,b,sum | add,x]",
+		"<main>:6 [add,x]",
+	}
+	if !reflect.DeepEqual(stack, expected) {
+		t.Errorf("stack wrong.\ngot=%q\nwant=%q", stack, expected)
+	}
+	if got := d.Breakpoints(""); !reflect.DeepEqual(got, []int{3}) {
+		t.Errorf("Breakpoints wrong. got=%v", got)
+	}
+}
+
+func TestDebuggerModuleBreakpoints(t *testing.T) {
+	var stops []string
+	d := NewDebugger(func(d *Debugger, reason StopReason) Action {
+		var frames []string
+		for _, frame := range d.Frames() {
+			frames = append(frames, fmt.Sprintf("%s %s:%d", frame.Name, frame.File, frame.Line()))
+		}
+		stops = append(stops, strings.Join(frames, ", "))
+		return ActionContinue
+	})
+	// 两个文件的第 2 行都有语句，断点只在设置的文件中生效
+	d.SetBreakpoint("main.mk", 2)
+	d.SetBreakpoint("lib.mk", 3)
+	in := New()
+	in.File = "main.mk"
+	in.Modules = NewModules(MapLoader{"lib.mk": "let one = 1;\nlet two = 2;\nexport let inc = fn(x) {\n\tx + one\n};"})
+	in.Debugger = d
+	testEvalWith(in, "let inc = import \"lib\"[\"inc\"];\ninc(1);\ninc(2)")
+	expected := []string{
+		"<main> lib.mk:3, <main> main.mk:1",
+		"<main> main.mk:2",
+	}
+	if !reflect.DeepEqual(stops, expected) {
+		t.Errorf("stops wrong.\ngot=%q\nwant=%q", stops, expected)
+	}
+	stops = nil
+	d.ClearBreakpoints()
+	d.SetBreakpoint("lib.mk", 4)
+	d.Reset()
+	// 模块已经加载，只会停在函数中
+	testEvalWith(in, "let inc = import \"lib\"[\"inc\"];\ninc(3)")
+	if expected := []string{"inc lib.mk:4, <main> main.mk:2"}; !reflect.DeepEqual(stops, expected) {
+		t.Errorf("stops in module function wrong.\ngot=%q\nwant=%q", stops, expected)
+	}
+}
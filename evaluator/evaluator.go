@@ -4,12 +4,14 @@ import (
 	"fmt"
 	"github.com/hollykbuck/muskmelon/ast"
 	"github.com/hollykbuck/muskmelon/object"
+	"github.com/hollykbuck/muskmelon/token"
+	"github.com/hollykbuck/muskmelon/trace"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
 // isError 判断 obj 类型是否是错误
@@ -20,15 +22,74 @@ func isError(obj object.Object) bool {
 	return false
 }
 
-// Eval eval 传入的 ast 节点
+// Interpreter 一次解释执行的上下文。
+// 不同的 Interpreter 之间互不影响，可以拥有各自的内置函数。
+type Interpreter struct {
+	// Builtins 标识符在 environment 中找不到时查询的内置函数
+	Builtins *Builtins
+	// Debugger 不为 nil 时在每条语句执行之前检查断点和单步执行
+	Debugger *Debugger
+	// Coverage 不为 nil 时记录执行过的语句和 if 分支
+	Coverage *Coverage
+	// Profiler 不为 nil 时统计每个函数和每行源码的运行时间
+	Profiler *Profiler
+	// Tracer 不为 nil 时在计算每个节点的前后发送事件
+	Tracer trace.Tracer
+	// Modules import 加载的模块，为 nil 时不能使用 import
+	Modules *Modules
+	// File 正在运行的代码所在的文件，记录在调试器的帧和函数中，用于区分不同文件的断点。
+	// 运行模块时临时设置为模块的 key。
+	File string
+	// traceDepth 当前事件的嵌套深度
+	traceDepth int
+}
+
+// New Interpreter 的构造函数，使用默认的内置函数。
+// Modules 为 nil，不能使用 import，需要读取模块时由调用者设置 Loader，例如 NewModules(NewOSLoader(dir))。
+func New() *Interpreter {
+	return &Interpreter{Builtins: DefaultBuiltins()}
+}
+
+// defaultInterpreter 包级别 Eval 使用的 Interpreter，共享包级别的内置函数
+var defaultInterpreter = &Interpreter{Builtins: builtins}
+
+// Eval 使用包级别的内置函数 eval 传入的 ast 节点
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return defaultInterpreter.Eval(node, env)
+}
+
+// Eval eval 传入的 ast 节点
+func (in *Interpreter) Eval(node ast.Node, env *object.Environment) object.Object {
+	if in.Tracer != nil {
+		return in.traceEval(node, env)
+	}
+	return in.eval(node, env)
+}
+
+// traceEval 计算节点并在前后发送跟踪事件
+func (in *Interpreter) traceEval(node ast.Node, env *object.Environment) object.Object {
+	name, pos := trace.NodeName(node), trace.NodePos(node)
+	in.Tracer.Trace(trace.Event{Phase: trace.PhaseEval, Kind: trace.KindEnter, Name: name, Depth: in.traceDepth, Pos: pos, Node: node})
+	in.traceDepth++
+	result := in.eval(node, env)
+	in.traceDepth--
+	e := trace.Event{Phase: trace.PhaseEval, Kind: trace.KindExit, Name: name, Depth: in.traceDepth, Pos: pos, Node: node, Value: result}
+	if errObj, ok := result.(*object.Error); ok {
+		e.Err = errObj.Message
+	}
+	in.Tracer.Trace(e)
+	return result
+}
+
+// eval Eval 的实现
+func (in *Interpreter) eval(node ast.Node, env *object.Environment) object.Object {
 	switch nodeActual := node.(type) {
 	case *ast.Program:
 		// Statements
-		return evalProgram(nodeActual, env)
+		return in.evalProgram(nodeActual, env)
 	case *ast.ExpressionStatement:
 		// Statements
-		return Eval(nodeActual.Expression, env)
+		return in.Eval(nodeActual.Expression, env)
 	case *ast.IntegerLiteral:
 		// Expressions
 		return &object.Integer{Value: nodeActual.Value}
@@ -37,7 +98,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return nativeBoolToBooleanObject(nodeActual.Value)
 	case *ast.PrefixExpression:
 		// Expressions
-		right := Eval(nodeActual.Right, env)
+		right := in.Eval(nodeActual.Right, env)
 		// operand 出现错误应当返回错误
 		if isError(right) {
 			return right
@@ -46,11 +107,11 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.InfixExpression:
 		// Expressions
 		// 任何一个 operand 出现错误都应返回错误
-		left := Eval(nodeActual.Left, env)
+		left := in.Eval(nodeActual.Left, env)
 		if isError(left) {
 			return left
 		}
-		right := Eval(nodeActual.Right, env)
+		right := in.Eval(nodeActual.Right, env)
 		if isError(right) {
 			return right
 		}
@@ -58,72 +119,191 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.BlockStatement:
 		// Expression
 		// 将实现委托给 evalStatements
-		return evalBlockStatement(nodeActual.Statements, env)
+		return in.evalBlockStatement(nodeActual.Statements, env)
 	case *ast.IfExpression:
 		// Expression
-		return evalIfExpression(nodeActual, env)
+		return in.evalIfExpression(nodeActual, env)
 	case *ast.ReturnStatement:
 		// 计算表达式的值
 		// 表达式的值作为返回值返回
-		val := Eval(nodeActual.ReturnValue, env)
+		val := in.Eval(nodeActual.ReturnValue, env)
 		// return 的 operand 出现错误应返回错误
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.LetStatement:
-		val := Eval(nodeActual.Value, env)
+		val := in.Eval(nodeActual.Value, env)
 		if isError(val) {
 			return val
 		}
+		if err := checkAnnotation(nodeActual.Type, val, "let "+nodeActual.Name.Value); err != nil {
+			return err
+		}
 		// 将等号右边的值存到 environment 中
 		env.Set(nodeActual.Name.Value, val)
 	case *ast.Identifier:
-		return evalIdentifier(nodeActual, env)
+		return in.evalIdentifier(nodeActual, env)
 	case *ast.FunctionLiteral:
-		params := nodeActual.Parameters
-		body := nodeActual.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{
+			Parameters:     nodeActual.Parameters,
+			ParameterTypes: nodeActual.ParameterTypes,
+			ReturnType:     nodeActual.ReturnType,
+			Env:            env,
+			Body:           nodeActual.Body,
+			File:           in.File,
+		}
 	case *ast.CallExpression:
-		function := Eval(nodeActual.Function, env)
+		function := in.Eval(nodeActual.Function, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(nodeActual.Arguments, env)
+		args := in.evalExpressions(nodeActual.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		return in.applyFunction(nodeActual, function, args)
 	case *ast.StringLiteral:
 		return &object.String{Value: nodeActual.Value}
+	case *ast.ArrayLiteral:
+		elements := in.evalExpressions(nodeActual.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+	case *ast.IndexExpression:
+		left := in.Eval(nodeActual.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := in.Eval(nodeActual.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+	case *ast.ImportExpression:
+		return in.evalImportExpression(nodeActual)
 	}
 	return nil
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// evalIndexExpression 按索引取数组元素或者按键取 Hash 的值
+func evalIndexExpression(left object.Object, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := left.(*object.Array).Elements
+		idx := index.(*object.Integer).Value
+		// 越界访问返回 null
+		if idx < 0 || idx >= int64(len(elements)) {
+			return NULL
+		}
+		return elements[idx]
+	case left.Type() == object.HASH_OBJ:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		pair, ok := left.(*object.Hash).Pairs[key.HashKey()]
+		if !ok {
+			return NULL
+		}
+		return pair.Value
+	case left.Type() == object.MODULE_OBJ && index.Type() == object.STRING_OBJ:
+		module := left.(*object.Module)
+		name := index.(*object.String).Value
+		value, ok := module.Exports[name]
+		if !ok {
+			return newError("module %q has no export %q", module.Name, name)
+		}
+		return value
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+// Apply 调用函数对象，供需要回调脚本函数的内置函数和宿主程序使用
+func (in *Interpreter) Apply(fn object.Object, args ...object.Object) object.Object {
+	return in.applyFunction(nil, fn, args)
+}
+
+// applyFunction 调用函数，call 是调用表达式，用于调试器显示调用栈
+func (in *Interpreter) applyFunction(call *ast.CallExpression, fn object.Object, args []object.Object) object.Object {
 	switch fnActual := fn.(type) {
 	case *object.Function:
 		// 如果是函数类型，进一步执行函数语句
-		extendedEnv := extendFunctionEnv(fnActual, args)
-		evaluated := Eval(fnActual.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		extendedEnv, err := extendFunctionEnv(fnActual, args)
+		if err != nil {
+			return err
+		}
+		if in.Debugger != nil {
+			in.Debugger.push(&Frame{Name: frameName(call), File: fnActual.File, Call: call, Function: fnActual, Env: extendedEnv})
+		}
+		if in.Profiler != nil {
+			in.Profiler.enter(ProfileFunction{Name: frameName(call), File: fnActual.File, Line: fnActual.Body.Token.Pos.Line})
+		}
+		evaluated := unwrapReturnValue(in.Eval(fnActual.Body, extendedEnv))
+		if in.Profiler != nil {
+			in.Profiler.exit()
+		}
+		if in.Debugger != nil {
+			in.Debugger.pop()
+		}
+		if isError(evaluated) {
+			return evaluated
+		}
+		if err := checkAnnotation(fnActual.ReturnType, evaluated, "return value"); err != nil {
+			return err
+		}
+		return evaluated
 	case *object.Builtin:
 		// 如果是 builtin 类型直接调用对应函数
-		return fnActual.Fn(args...)
+		if in.Profiler != nil {
+			in.Profiler.enter(ProfileFunction{Name: frameName(call)})
+			defer in.Profiler.exit()
+		}
+		var result object.Object
+		if fnActual.HigherOrder != nil {
+			result = fnActual.HigherOrder(in.Apply, args...)
+		} else {
+			result = fnActual.Fn(args...)
+		}
+		// 内置函数产生的错误记录调用的位置
+		if errObj, ok := result.(*object.Error); ok && !errObj.Pos.IsValid() && call != nil {
+			errObj.Pos = callPos(call)
+		}
+		return result
 	default:
 		return newError("not a function: %s", fnActual.Type())
 	}
 }
 
+// callPos 调用表达式的位置。通过名字调用时是名字的位置，否则是左括号的位置。
+func callPos(call *ast.CallExpression) token.Position {
+	if ident, ok := call.Function.(*ast.Identifier); ok {
+		return ident.Token.Pos
+	}
+	return call.Token.Pos
+}
+
+// extendFunctionEnv 创建函数体的 environment 并绑定参数。
+// 参数不够或者不符合类型标注时返回错误，多余的参数被忽略。
 func extendFunctionEnv(
 	fn *object.Function,
 	args []object.Object,
-) *object.Environment {
+) (*object.Environment, *object.Error) {
+	if len(args) < len(fn.Parameters) {
+		return nil, newError("wrong number of arguments. got=%d, want=%d", len(args), len(fn.Parameters))
+	}
 	env := object.NewEnclosedEnvironment(fn.Env)
 	for paramIdx, param := range fn.Parameters {
+		if paramIdx < len(fn.ParameterTypes) {
+			if err := checkAnnotation(fn.ParameterTypes[paramIdx], args[paramIdx], "argument "+param.Value); err != nil {
+				return nil, err
+			}
+		}
 		env.Set(param.Value, args[paramIdx])
 	}
-	return env
+	return env, nil
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -133,13 +313,13 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
-func evalExpressions(
+func (in *Interpreter) evalExpressions(
 	exps []ast.Expression,
 	env *object.Environment,
 ) []object.Object {
 	var result []object.Object
 	for _, e := range exps {
-		evaluated := Eval(e, env)
+		evaluated := in.Eval(e, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -149,22 +329,33 @@ func evalExpressions(
 }
 
 // evalIdentifier 计算标识符的值。如果标识符是一个内置函数，将解析为内置函数符号。
-func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+func (in *Interpreter) evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin, ok := in.Builtins.Lookup(node.Value); ok {
 		return builtin
 	}
 	return newError("identifier not found: " + node.Value)
 }
 
 // evalBlockStatement eval block statement
-func evalBlockStatement(statements []ast.Statement, env *object.Environment) object.Object {
+func (in *Interpreter) evalBlockStatement(statements []ast.Statement, env *object.Environment) object.Object {
 	var result object.Object
 	for _, statement := range statements {
+		if in.Debugger != nil {
+			if err := in.Debugger.before(statement, env, in.File); err != nil {
+				return err
+			}
+		}
+		if in.Profiler != nil {
+			in.Profiler.statement(statement)
+		}
+		if in.Coverage != nil {
+			in.Coverage.statement(statement)
+		}
 		// 执行单条语句
-		result = Eval(statement, env)
+		result = in.Eval(statement, env)
 
 		if result != nil {
 			resultType := result.Type()
@@ -179,10 +370,29 @@ func evalBlockStatement(statements []ast.Statement, env *object.Environment) obj
 }
 
 // evalProgram eval Program 节点
-func evalProgram(actual *ast.Program, env *object.Environment) object.Object {
+func (in *Interpreter) evalProgram(actual *ast.Program, env *object.Environment) object.Object {
+	if in.Debugger != nil {
+		in.Debugger.push(&Frame{Name: MAIN_FRAME, File: in.File, Env: env})
+		defer in.Debugger.pop()
+	}
+	if in.Profiler != nil {
+		in.Profiler.enter(ProfileFunction{Name: MAIN_FRAME, File: in.File, Line: 1})
+		defer in.Profiler.exit()
+	}
 	var result object.Object
 	for _, statement := range actual.Statements {
-		result = Eval(statement, env)
+		if in.Debugger != nil {
+			if err := in.Debugger.before(statement, env, in.File); err != nil {
+				return err
+			}
+		}
+		if in.Profiler != nil {
+			in.Profiler.statement(statement)
+		}
+		if in.Coverage != nil {
+			in.Coverage.statement(statement)
+		}
+		result = in.Eval(statement, env)
 		switch resultActual := result.(type) {
 		case *object.ReturnValue:
 			// 碰到 return 了就打断流程
@@ -197,12 +407,15 @@ func evalProgram(actual *ast.Program, env *object.Environment) object.Object {
 }
 
 // evalIfExpression eval if 表达式
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+func (in *Interpreter) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := in.Eval(ie.Condition, env)
+	if in.Coverage != nil && !isError(condition) {
+		in.Coverage.branch(ie, isTruthy(condition))
+	}
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return in.Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return in.Eval(ie.Alternative, env)
 	} else {
 		return NULL
 	}
@@ -264,6 +477,9 @@ func evalIntegerInfixExpression(operator string, left object.Object, right objec
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
 		return &object.Integer{Value: leftVal / rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
@@ -0,0 +1,144 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Loader 按 import 的路径查找并读取模块的源码。
+// Resolve 查找模块但不读取源码，Modules 先按 key 查找缓存，没有缓存时才调用 Load 读取源码。
+type Loader interface {
+	// Resolve 返回唯一标识模块的 key，不同的路径指向同一个模块时 key 相同。
+	// name 是补上扩展名之后的 import 路径，使用 / 分隔。
+	// from 是执行 import 的模块的 key，入口脚本中为空字符串。相对路径先在 from 所在的目录中查找。
+	// 找不到模块时返回的错误满足 errors.Is(err, fs.ErrNotExist)。
+	Resolve(name string, from string) (key string, err error)
+	// Load 读取 Resolve 返回的 key 对应的模块的源码
+	Load(key string) (src string, err error)
+}
+
+// OSLoader 从操作系统的文件系统加载模块。
+// 绝对路径直接读取，相对路径先在执行 import 的模块所在的目录中查找，
+// 然后依次在 Path 的每个目录中查找，使用第一个找到的文件。
+type OSLoader struct {
+	Path []string
+}
+
+// NewOSLoader OSLoader 的构造函数，path 是按顺序查找的目录
+func NewOSLoader(path ...string) *OSLoader {
+	return &OSLoader{Path: path}
+}
+
+// Resolve 返回找到的文件的绝对路径
+func (l *OSLoader) Resolve(name string, from string) (string, error) {
+	file := filepath.FromSlash(name)
+	if filepath.IsAbs(file) {
+		return findModuleFile(file)
+	}
+	dirs := l.Path
+	if from != "" {
+		dirs = append([]string{filepath.Dir(from)}, dirs...)
+	}
+	for _, dir := range dirs {
+		key, err := findModuleFile(filepath.Join(dir, file))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return key, err
+	}
+	return "", fs.ErrNotExist
+}
+
+func (l *OSLoader) Load(key string) (string, error) {
+	content, err := os.ReadFile(key)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// findModuleFile 检查文件是否存在，返回文件的绝对路径
+func findModuleFile(file string) (string, error) {
+	key, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(key)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", key)
+	}
+	return key, nil
+}
+
+// FSLoader 从 fs.FS 加载模块，例如 embed.FS。
+// import 的路径先相对于执行 import 的模块所在的目录查找，然后作为 fsys 中的路径查找。
+// 路径不能超出 fsys 的根目录。
+type FSLoader struct {
+	FS fs.FS
+}
+
+// NewFSLoader FSLoader 的构造函数
+func NewFSLoader(fsys fs.FS) *FSLoader {
+	return &FSLoader{FS: fsys}
+}
+
+// Resolve 返回清理之后的路径
+func (l *FSLoader) Resolve(name string, from string) (string, error) {
+	if from != "" && !path.IsAbs(name) {
+		if relative := path.Join(path.Dir(from), name); fs.ValidPath(relative) {
+			if _, err := fs.Stat(l.FS, relative); err == nil {
+				return relative, nil
+			}
+		}
+	}
+	name = path.Clean(name)
+	if !fs.ValidPath(name) {
+		return "", fmt.Errorf("invalid module path %q", name)
+	}
+	if _, err := fs.Stat(l.FS, name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func (l *FSLoader) Load(key string) (string, error) {
+	content, err := fs.ReadFile(l.FS, key)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// MapLoader 从内存中加载模块，键是带扩展名的路径，值是源码。
+// 与 FSLoader 一样，import 的路径先相对于执行 import 的模块所在的目录查找。
+type MapLoader map[string]string
+
+// Resolve 返回清理之后的路径
+func (l MapLoader) Resolve(name string, from string) (string, error) {
+	if from != "" && !path.IsAbs(name) {
+		relative := path.Join(path.Dir(from), name)
+		if _, ok := l[relative]; ok {
+			return relative, nil
+		}
+	}
+	name = path.Clean(name)
+	if _, ok := l[name]; !ok {
+		return "", fs.ErrNotExist
+	}
+	return name, nil
+}
+
+func (l MapLoader) Load(key string) (string, error) {
+	src, ok := l[key]
+	if !ok {
+		return "", fs.ErrNotExist
+	}
+	return src, nil
+}
@@ -0,0 +1,149 @@
+package evaluator
+
+import (
+	"errors"
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/lexer"
+	"github.com/hollykbuck/muskmelon/object"
+	"github.com/hollykbuck/muskmelon/parser"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// MODULE_EXT 模块文件的扩展名，import 的路径没有扩展名时补上
+const MODULE_EXT = ".mk"
+
+// Modules 记录已经加载的模块。同一个模块只加载、运行一次，之后的 import 得到同一个模块。
+type Modules struct {
+	// Loader 查找并读取模块的源码
+	Loader Loader
+	// cache 加载成功的模块，键是 Loader.Resolve 返回的 key
+	cache map[string]*object.Module
+	// loading 正在加载的模块，用于检测循环导入
+	loading []loadingModule
+	// loaded 解析成功、运行过的模块，按开始运行的顺序排列
+	loaded []*LoadedModule
+}
+
+// LoadedModule 运行过的模块的源码和语法树，用于在运行之后分析模块，例如统计覆盖率
+type LoadedModule struct {
+	// Key Loader.Resolve 返回的 key，OSLoader 加载的模块是文件的绝对路径
+	Key string
+	// Name 补上扩展名之后的 import 路径
+	Name string
+	// Src 模块的源码，Program 是从 Src 解析出的、实际运行的语法树
+	Src     string
+	Program *ast.Program
+}
+
+// loadingModule 正在加载的模块的 key 和 import 路径
+type loadingModule struct {
+	key  string
+	name string
+}
+
+// NewModules Modules 的构造函数，模块的源码由 loader 读取
+func NewModules(loader Loader) *Modules {
+	return &Modules{Loader: loader, cache: make(map[string]*object.Module)}
+}
+
+// Reset 清空已经加载的模块，之后的 import 重新读取源码
+func (m *Modules) Reset() {
+	m.cache = make(map[string]*object.Module)
+	m.loading = nil
+	m.loaded = nil
+}
+
+// Loaded 按开始运行的顺序返回运行过的模块，包括运行出错的模块
+func (m *Modules) Loaded() []*LoadedModule {
+	return append([]*LoadedModule(nil), m.loaded...)
+}
+
+// modulePath 补上扩展名之后的 import 路径
+func modulePath(path string) string {
+	if filepath.Ext(path) == "" {
+		return path + MODULE_EXT
+	}
+	return path
+}
+
+// evalImportExpression 加载模块并返回 *object.Module，错误的位置是 import 表达式的位置
+func (in *Interpreter) evalImportExpression(ie *ast.ImportExpression) object.Object {
+	if in.Modules == nil {
+		return &object.Error{Message: "import is not supported", Pos: ie.Token.Pos}
+	}
+	result := in.importModule(ie.Path.Value)
+	if errObj, ok := result.(*object.Error); ok {
+		return &object.Error{Message: ie.String() + ": " + errObj.Message, Pos: ie.Token.Pos}
+	}
+	return result
+}
+
+// importModule 通过 Loader 找到模块，返回缓存的模块，没有缓存时读取源码并在新的 environment 中运行。
+// 在模块中 import 时，相对路径先在当前模块所在的目录中查找
+func (in *Interpreter) importModule(path string) object.Object {
+	m := in.Modules
+	name := modulePath(path)
+	var from string
+	if len(m.loading) > 0 {
+		from = m.loading[len(m.loading)-1].key
+	}
+	key, err := m.Loader.Resolve(name, from)
+	if errors.Is(err, fs.ErrNotExist) {
+		return newError("cannot find module %s", name)
+	}
+	if err != nil {
+		return newError("%s", err)
+	}
+	if module, ok := m.cache[key]; ok {
+		return module
+	}
+	for i, loading := range m.loading {
+		if loading.key == key {
+			cycle := make([]string, 0, len(m.loading)-i+1)
+			for _, l := range m.loading[i:] {
+				cycle = append(cycle, l.name)
+			}
+			return newError("import cycle: %s", strings.Join(append(cycle, name), " -> "))
+		}
+	}
+	src, err := m.Loader.Load(key)
+	if err != nil {
+		return newError("%s: %s", name, err)
+	}
+	p := parser.New(lexer.New(src))
+	p.SetTracer(in.Tracer)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		messages := make([]string, 0, len(p.Errors()))
+		for _, e := range p.ErrorList() {
+			messages = append(messages, e.Error())
+		}
+		return newError("%s: %s", name, strings.Join(messages, "; "))
+	}
+	m.loading = append(m.loading, loadingModule{key: key, name: name})
+	m.loaded = append(m.loaded, &LoadedModule{Key: key, Name: name, Src: src, Program: program})
+	env := object.NewEnvironment()
+	file := in.File
+	in.File = key
+	evaluated := in.Eval(program, env)
+	in.File = file
+	m.loading = m.loading[:len(m.loading)-1]
+	if errObj, ok := evaluated.(*object.Error); ok {
+		if errObj.Pos.IsValid() {
+			return newError("%s:%s: %s", name, errObj.Pos, errObj.Message)
+		}
+		return newError("%s: %s", name, errObj.Message)
+	}
+	module := &object.Module{Name: path, Exports: make(map[string]object.Object)}
+	for _, statement := range program.Statements {
+		if let, ok := statement.(*ast.LetStatement); ok && let.Exported {
+			if value, ok := env.Get(let.Name.Value); ok {
+				module.Exports[let.Name.Value] = value
+			}
+		}
+	}
+	m.cache[key] = module
+	return module
+}
@@ -0,0 +1,201 @@
+package evaluator
+
+import (
+	"github.com/hollykbuck/muskmelon/lexer"
+	"github.com/hollykbuck/muskmelon/object"
+	"github.com/hollykbuck/muskmelon/parser"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// writeModules 在临时目录中写入模块文件，返回目录
+func writeModules(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func evalModules(in *Interpreter, input string) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	return in.Eval(program, object.NewEnvironment())
+}
+
+func TestImport(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"lib/math.mk": `let square = fn(x) { x * x };
+export let add = fn(a, b) { a + b };
+export let nine = square(3);
+puts("loaded");`,
+		"broken.mk":  "export let x = 1 + true;",
+		"invalid.mk": "export let = 1;",
+		"a.mk":       `export let b = import "b";`,
+		"b.mk":       `export let a = import "a";`,
+	})
+	in := New()
+	in.Modules = NewModules(NewOSLoader(dir))
+	loads := 0
+	in.Builtins.Set("puts", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		loads++
+		return NULL
+	}})
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let m = import "lib/math"; m["add"](m["nine"], 1)`, 10},
+		{`import "lib/math.mk"["nine"]`, 9},
+		{`let m = import "lib/math"; m["square"]`, `module "lib/math" has no export "square"`},
+		{`import "lib/math"[0]`, "index operator not supported: MODULE"},
+		{`import "missing"`, `import "missing": cannot find module missing.mk`},
+		{`import "broken"`, `import "broken": broken.mk: type mismatch: INTEGER + BOOLEAN`},
+		{`import "invalid"`, `import "invalid": invalid.mk: 1:12: expectedBool next token to be IDENT, got = instead; 1:12: no prefix parse function for = found`},
+		{`import "a"`, `import "a": a.mk:1:16: import "b": b.mk:1:16: import "a": import cycle: a.mk -> b.mk -> a.mk`},
+	}
+	for _, tt := range tests {
+		evaluated := evalModules(in, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%s: no error object returned. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("%s: wrong error message. got=%q, want=%q", tt.input, errObj.Message, expected)
+			}
+		}
+	}
+	// 模块只运行一次，路径带不带扩展名都是同一个模块
+	if loads != 1 {
+		t.Errorf("module evaluated %d times, want 1", loads)
+	}
+	if inspect := evalModules(in, `import "lib/math"`).Inspect(); inspect != `module "lib/math"` {
+		t.Errorf("module Inspect wrong. got=%q", inspect)
+	}
+}
+
+func TestImportWithoutModules(t *testing.T) {
+	evaluated := evalModules(New(), `import "m"`)
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "import is not supported" {
+		t.Errorf("expected import to be unsupported by default, got %s", evaluated.Inspect())
+	}
+}
+
+func TestLoaders(t *testing.T) {
+	first := writeModules(t, map[string]string{"a.mk": "export let x = 1;"})
+	second := writeModules(t, map[string]string{"a.mk": "export let x = 2;", "b.mk": "export let x = 3;"})
+	nested := writeModules(t, map[string]string{
+		"lib/a.mk": `export let x = import "b"["x"];`,
+		"lib/b.mk": "export let x = 6;",
+		"lib/c.mk": `export let x = import "b"["x"] + import "top"["x"];`,
+		"b.mk":     "export let x = 7;",
+		"top.mk":   "export let x = 10;",
+	})
+	relative := map[string]string{
+		"lib/a.mk": `export let x = import "b"["x"] + import "../b"["x"];`,
+		"lib/b.mk": "export let x = 6;",
+		"b.mk":     "export let x = 7;",
+	}
+	relativeFS := fstest.MapFS{}
+	for name, src := range relative {
+		relativeFS[name] = &fstest.MapFile{Data: []byte(src)}
+	}
+	tests := []struct {
+		name     string
+		loader   Loader
+		input    string
+		expected interface{}
+	}{
+		{"os first", NewOSLoader(first, second), `import "a"["x"]`, 1},
+		{"os fallback", NewOSLoader(first, second), `import "b"["x"]`, 3},
+		{"os absolute", NewOSLoader(first), `import "` + filepath.ToSlash(filepath.Join(second, "b")) + `"["x"]`, 3},
+		{"os missing", NewOSLoader(first), `import "b"`, `import "b": cannot find module b.mk`},
+		{"os relative", NewOSLoader(nested), `import "lib/a"["x"]`, 6},
+		{"os relative fallback", NewOSLoader(nested), `import "lib/c"["x"]`, 16},
+		{"os entry", NewOSLoader(nested), `import "b"["x"]`, 7},
+		{"fs", NewFSLoader(fstest.MapFS{"lib/m.mk": {Data: []byte("export let x = 4;")}}), `import "lib/m"["x"]`, 4},
+		{"fs clean", NewFSLoader(fstest.MapFS{"lib/m.mk": {Data: []byte("export let x = 4;")}}), `import "lib/../lib/m"["x"]`, 4},
+		{"fs invalid", NewFSLoader(fstest.MapFS{}), `import "../m"`, `import "../m": invalid module path "../m.mk"`},
+		{"fs missing", NewFSLoader(fstest.MapFS{}), `import "m"`, `import "m": cannot find module m.mk`},
+		{"fs relative", NewFSLoader(relativeFS), `import "lib/a"["x"]`, 13},
+		{"map", MapLoader{"m.mk": `export let y = import "n"["x"] + 1;`, "n.mk": "export let x = 5;"}, `import "m"["y"]`, 6},
+		{"map missing", MapLoader{}, `import "m"`, `import "m": cannot find module m.mk`},
+		{"map relative", MapLoader(relative), `import "lib/a"["x"]`, 13},
+	}
+	for _, tt := range tests {
+		in := New()
+		in.Modules = NewModules(tt.loader)
+		evaluated := evalModules(in, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			if !testIntegerObject(t, evaluated, int64(expected)) {
+				t.Errorf("%s: wrong result for %s", tt.name, tt.input)
+			}
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != expected {
+				t.Errorf("%s: wrong result for %s. got=%s, want error %q", tt.name, tt.input, evaluated.Inspect(), expected)
+			}
+		}
+	}
+}
+
+// countingLoader 记录 Load 的调用次数
+type countingLoader struct {
+	MapLoader
+	loads int
+}
+
+func (l *countingLoader) Load(key string) (string, error) {
+	l.loads++
+	return l.MapLoader.Load(key)
+}
+
+func TestModulesResolveBeforeLoad(t *testing.T) {
+	loader := &countingLoader{MapLoader: MapLoader{"m.mk": "export let x = 1;"}}
+	in := New()
+	in.Modules = NewModules(loader)
+	evaluated := evalModules(in, `import "m"["x"] + import "./m"["x"] + import "m.mk"["x"]`)
+	testIntegerObject(t, evaluated, 3)
+	// 缓存按 Resolve 返回的 key 查找，已经加载的模块不会再读取源码
+	if loader.loads != 1 {
+		t.Errorf("module source read %d times, want 1", loader.loads)
+	}
+}
+
+func TestModulesCacheByKey(t *testing.T) {
+	loads := 0
+	in := New()
+	in.Modules = NewModules(MapLoader{"m.mk": "puts(1); export let x = 1;"})
+	in.Builtins.Set("puts", &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		loads++
+		return NULL
+	}})
+	evalModules(in, `import "m"; import "./m.mk"; import "m.mk"`)
+	if loads != 1 {
+		t.Errorf("module evaluated %d times, want 1", loads)
+	}
+	if loaded := in.Modules.Loaded(); len(loaded) != 1 || loaded[0].Key != "m.mk" || loaded[0].Name != "m.mk" || loaded[0].Program == nil {
+		t.Errorf("Loaded wrong. got=%+v", loaded)
+	}
+	in.Modules.Reset()
+	if loaded := in.Modules.Loaded(); len(loaded) != 0 {
+		t.Errorf("Loaded not cleared by Reset. got=%+v", loaded)
+	}
+	evalModules(in, `import "m"`)
+	if loads != 2 {
+		t.Errorf("module not evaluated again after Reset. got=%d", loads)
+	}
+}
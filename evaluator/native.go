@@ -0,0 +1,100 @@
+package evaluator
+
+import (
+	"fmt"
+	"github.com/hollykbuck/muskmelon/object"
+	"reflect"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// RegisterBuiltin 通过反射把任意 Go 函数注册为包级别 Eval 使用的内置函数。
+// 需要隔离的场景应当使用 Interpreter.Builtins.Register。
+// 参数和返回值通过 object.ToGoType 和 object.FromGoValue 自动转换，
+// 如果函数的最后一个返回值是 error，非 nil 的 error 会被转换为 object.Error。
+func RegisterBuiltin(name string, fn interface{}) error {
+	err := builtins.Register(name, fn)
+	if err != nil {
+		return fmt.Errorf("注册内置函数 %s 失败: %w", name, err)
+	}
+	return nil
+}
+
+// NewNativeBuiltin 将 Go 函数包装为 object.Builtin
+func NewNativeBuiltin(fn interface{}) (*object.Builtin, error) {
+	fnValue := reflect.ValueOf(fn)
+	if fnValue.Kind() != reflect.Func {
+		return nil, fmt.Errorf("expected a function, got %T", fn)
+	}
+	if fnValue.IsNil() {
+		return nil, fmt.Errorf("function is nil")
+	}
+	fnType := fnValue.Type()
+	// 最多允许两个返回值，两个返回值时第二个必须是 error
+	switch fnType.NumOut() {
+	case 0, 1:
+	case 2:
+		if fnType.Out(1) != errorType {
+			return nil, fmt.Errorf("second return value must be error, got %s", fnType.Out(1))
+		}
+	default:
+		return nil, fmt.Errorf("too many return values: %d", fnType.NumOut())
+	}
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			in, errObj := nativeArguments(fnType, args)
+			if errObj != nil {
+				return errObj
+			}
+			return nativeResults(fnType, fnValue.Call(in))
+		},
+	}, nil
+}
+
+// nativeArguments 按照函数签名把 object 参数转换为 Go 参数
+func nativeArguments(fnType reflect.Type, args []object.Object) ([]reflect.Value, *object.Error) {
+	numIn := fnType.NumIn()
+	if fnType.IsVariadic() {
+		if len(args) < numIn-1 {
+			return nil, newError("wrong number of arguments. got=%d, want>=%d",
+				len(args), numIn-1)
+		}
+	} else if len(args) != numIn {
+		return nil, newError("wrong number of arguments. got=%d, want=%d",
+			len(args), numIn)
+	}
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var paramType reflect.Type
+		if fnType.IsVariadic() && i >= numIn-1 {
+			paramType = fnType.In(numIn - 1).Elem()
+		} else {
+			paramType = fnType.In(i)
+		}
+		value, err := object.ToGoType(arg, paramType)
+		if err != nil {
+			return nil, newError("argument %d: %s", i+1, err)
+		}
+		in[i] = value
+	}
+	return in, nil
+}
+
+// nativeResults 把 Go 函数的返回值转换为 object
+func nativeResults(fnType reflect.Type, out []reflect.Value) object.Object {
+	if len(out) > 0 && fnType.Out(len(out)-1) == errorType {
+		last := out[len(out)-1]
+		if !last.IsNil() {
+			return newError("%s", last.Interface().(error).Error())
+		}
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return NULL
+	}
+	result, err := object.FromGoValue(out[0])
+	if err != nil {
+		return newError("%s", err)
+	}
+	return result
+}
@@ -0,0 +1,101 @@
+package evaluator
+
+import (
+	"errors"
+	"github.com/hollykbuck/muskmelon/object"
+	"strings"
+	"testing"
+)
+
+// TestRegisterBuiltin 测试通过反射注册的 Go 函数
+func TestRegisterBuiltin(t *testing.T) {
+	natives := map[string]interface{}{
+		"repeat": func(s string, n int) (string, error) {
+			if n < 0 {
+				return "", errors.New("negative count")
+			}
+			return strings.Repeat(s, n), nil
+		},
+		"sum": func(nums ...int64) int64 {
+			var total int64
+			for _, n := range nums {
+				total += n
+			}
+			return total
+		},
+		"not":      func(b bool) bool { return !b },
+		"typeName": func(obj object.Object) string { return string(obj.Type()) },
+		"noop":     func() {},
+		"small":    func(n int8) int8 { return n },
+		"split":    func(s, sep string) []string { return strings.Split(s, sep) },
+		"join":     func(parts []string, sep string) string { return strings.Join(parts, sep) },
+	}
+	for name, fn := range natives {
+		if err := RegisterBuiltin(name, fn); err != nil {
+			t.Fatalf("RegisterBuiltin(%q) failed: %s", name, err)
+		}
+	}
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("ab", -1)`, errors.New("negative count")},
+		{`repeat("ab")`, errors.New("wrong number of arguments. got=1, want=2")},
+		{`repeat(1, 2)`, errors.New("argument 1: cannot use INTEGER as string")},
+		{`sum()`, 0},
+		{`sum(1, 2, 3)`, 6},
+		{`not(true)`, false},
+		{`typeName("x")`, "STRING"},
+		{`noop()`, nil},
+		{`small(1000)`, errors.New("argument 1: 1000 overflows int8")},
+		{`len(split("a,b,c", ","))`, 3},
+		{`split("a,b,c", ",")[1]`, "b"},
+		{`join(split("a,b,c", ","), "-")`, "a-b-c"},
+		{`join([1], "-")`, errors.New("argument 1: index 0: cannot use INTEGER as string")},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. got=%q, want=%q", str.Value, expected)
+			}
+		case error:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected.Error() {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected.Error(), errObj.Message)
+			}
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestRegisterBuiltinRejectsInvalidFunctions(t *testing.T) {
+	invalid := []interface{}{
+		nil,
+		42,
+		func() (int, int) { return 0, 0 },
+		func() (int, string, error) { return 0, "", nil },
+	}
+	for _, fn := range invalid {
+		if _, err := NewNativeBuiltin(fn); err == nil {
+			t.Errorf("expected error for %T", fn)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package evaluator
+
+import (
+	"compress/gzip"
+	"io"
+	"strings"
+)
+
+// pprof 格式是 gzip 压缩的 protobuf 消息，定义见
+// https://github.com/google/pprof/blob/main/proto/profile.proto 。
+// 这里只编码用到的字段。
+
+// Profile 消息的字段编号
+const (
+	fieldSampleType        = 1
+	fieldSample            = 2
+	fieldLocation          = 4
+	fieldFunction          = 5
+	fieldStringTable       = 6
+	fieldTimeNanos         = 9
+	fieldDurationNanos     = 10
+	fieldDefaultSampleType = 14
+)
+
+// protoBuffer 按 protobuf wire format 编码消息
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protoBuffer) key(field int, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+// uint64 编码 varint 字段，零值省略
+func (b *protoBuffer) uint64(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.key(field, 0)
+	b.varint(x)
+}
+
+func (b *protoBuffer) int64(field int, x int64) {
+	b.uint64(field, uint64(x))
+}
+
+// bytes 编码长度前缀的字段，空值也会写入
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.key(field, 2)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+// packed 编码 packed repeated 的 varint 字段
+func (b *protoBuffer) packed(field int, xs []uint64) {
+	if len(xs) == 0 {
+		return
+	}
+	var inner protoBuffer
+	for _, x := range xs {
+		inner.varint(x)
+	}
+	b.bytes(field, inner.data)
+}
+
+// message 编码嵌套的消息
+func (b *protoBuffer) message(field int, encode func(m *protoBuffer)) {
+	var inner protoBuffer
+	encode(&inner)
+	b.bytes(field, inner.data)
+}
+
+// WritePprof 写出 pprof 格式的 profile，可以用 go tool pprof 查看。
+// 每个样本有两个值：调用次数和纳秒为单位的时间，默认显示时间。
+func (p *Profiler) WritePprof(w io.Writer) error {
+	table := []string{""}
+	index := map[string]int{"": 0}
+	str := func(s string) uint64 {
+		if i, ok := index[s]; ok {
+			return uint64(i)
+		}
+		index[s] = len(table)
+		table = append(table, s)
+		return uint64(index[s])
+	}
+	var b protoBuffer
+	valueType := func(typ string, unit string) func(m *protoBuffer) {
+		return func(m *protoBuffer) {
+			m.uint64(1, str(typ))
+			m.uint64(2, str(unit))
+		}
+	}
+	b.message(fieldSampleType, valueType("calls", "count"))
+	b.message(fieldSampleType, valueType("time", "nanoseconds"))
+
+	functions := make(map[ProfileFunction]uint64)
+	type location struct {
+		fn   ProfileFunction
+		line int
+	}
+	locations := make(map[location]uint64)
+	var functionOrder []ProfileFunction
+	var locationOrder []location
+	for _, s := range p.samples() {
+		ids := make([]uint64, len(s.stack))
+		for i, frame := range s.stack {
+			if _, ok := functions[frame.fn]; !ok {
+				functions[frame.fn] = uint64(len(functions) + 1)
+				functionOrder = append(functionOrder, frame.fn)
+			}
+			loc := location{frame.fn, frame.line}
+			if _, ok := locations[loc]; !ok {
+				locations[loc] = uint64(len(locations) + 1)
+				locationOrder = append(locationOrder, loc)
+			}
+			ids[i] = locations[loc]
+		}
+		b.message(fieldSample, func(m *protoBuffer) {
+			m.packed(1, ids)
+			m.packed(2, []uint64{uint64(s.calls), uint64(s.time)})
+		})
+	}
+	for _, loc := range locationOrder {
+		loc := loc
+		b.message(fieldLocation, func(m *protoBuffer) {
+			m.uint64(1, locations[loc])
+			m.message(4, func(line *protoBuffer) {
+				line.uint64(1, functions[loc.fn])
+				line.int64(2, int64(loc.line))
+			})
+		})
+	}
+	for _, fn := range functionOrder {
+		fn := fn
+		file := p.file(fn)
+		// pprof 显示函数名时会去掉尖括号中的内容，<main> 会变成空的名字
+		name := strings.Trim(fn.Name, "<>")
+		b.message(fieldFunction, func(m *protoBuffer) {
+			m.uint64(1, functions[fn])
+			m.uint64(2, str(name))
+			m.uint64(3, str(name))
+			m.uint64(4, str(file))
+			m.int64(5, int64(fn.Line))
+		})
+	}
+	b.int64(fieldTimeNanos, p.start.UnixNano())
+	b.int64(fieldDurationNanos, int64(p.Duration()))
+	b.uint64(fieldDefaultSampleType, str("time"))
+	for _, s := range table {
+		b.bytes(fieldStringTable, []byte(s))
+	}
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(b.data); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,317 @@
+package evaluator
+
+import (
+	"fmt"
+	"github.com/hollykbuck/muskmelon/ast"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// BUILTIN_FILE 内置函数在报告中的文件名
+const BUILTIN_FILE = "<builtin>"
+
+// Profiler 把运行时间和调用次数归属到 Monkey 的函数和源码行。
+// 每条语句开始执行、函数调用和返回时，把距离上一次记录经过的时间计入当前的调用栈，
+// 相当于在每个语句边界上采样一次。设置到 Interpreter.Profiler 之后生效。
+type Profiler struct {
+	// File 脚本的文件名，写入报告和 pprof。没有记录文件的函数属于这个文件。
+	File string
+	// now 读取当前时间，测试时替换
+	now   func() time.Time
+	start time.Time
+	last  time.Time
+	// root 调用树的根，每个节点对应一个调用栈
+	root *profileNode
+	// stack 当前调用栈每一层对应的节点
+	stack []*profileNode
+}
+
+// ProfileFunction 被调用的函数，按名字、定义所在的文件和行区分
+type ProfileFunction struct {
+	Name string
+	// File 函数定义所在的文件，即 Interpreter.File 或者模块的 key，为空时是 Profiler.File
+	File string
+	// Line 函数定义所在的行，内置函数为 0
+	Line int
+}
+
+// profileFrame 调用栈中的一帧，line 是正在执行的语句所在的行
+type profileFrame struct {
+	fn   ProfileFunction
+	line int
+}
+
+// profileNode 调用树的节点，记录从根到这个节点的调用栈上累计的时间和调用次数
+type profileNode struct {
+	parent   *profileNode
+	frame    profileFrame
+	children map[profileFrame]*profileNode
+	calls    int64
+	time     time.Duration
+}
+
+// child 返回 frame 对应的子节点，不存在时创建
+func (n *profileNode) child(frame profileFrame) *profileNode {
+	if c, ok := n.children[frame]; ok {
+		return c
+	}
+	if n.children == nil {
+		n.children = make(map[profileFrame]*profileNode)
+	}
+	c := &profileNode{parent: n, frame: frame}
+	n.children[frame] = c
+	return c
+}
+
+// profileSample 一个调用栈上累计的时间和调用次数，stack 的最内层在前
+type profileSample struct {
+	stack []profileFrame
+	calls int64
+	time  time.Duration
+}
+
+// FunctionProfile 一个函数的统计。Flat 是函数自身的时间，Cum 包括被调用的函数的时间。
+type FunctionProfile struct {
+	ProfileFunction
+	Calls int64
+	Flat  time.Duration
+	Cum   time.Duration
+}
+
+// LineProfile 一行源码的统计
+type LineProfile struct {
+	Function ProfileFunction
+	Line     int
+	Flat     time.Duration
+	Cum      time.Duration
+}
+
+// NewProfiler Profiler 的构造函数，file 是脚本的文件名
+func NewProfiler(file string) *Profiler {
+	return &Profiler{File: file, now: time.Now, root: &profileNode{}}
+}
+
+// Reset 清空统计结果
+func (p *Profiler) Reset() {
+	p.start = time.Time{}
+	p.root = &profileNode{}
+	p.stack = nil
+}
+
+// Duration 第一次到最后一次记录之间的时间
+func (p *Profiler) Duration() time.Duration {
+	return p.last.Sub(p.start)
+}
+
+// flush 把上一次记录之后经过的时间计入当前的调用栈
+func (p *Profiler) flush() {
+	now := p.now()
+	if p.start.IsZero() {
+		p.start, p.last = now, now
+	}
+	if len(p.stack) > 0 {
+		p.stack[len(p.stack)-1].time += now.Sub(p.last)
+	}
+	p.last = now
+}
+
+// top 当前调用栈最内层的节点，调用栈为空时是根
+func (p *Profiler) top() *profileNode {
+	if len(p.stack) == 0 {
+		return p.root
+	}
+	return p.stack[len(p.stack)-1]
+}
+
+// enter 进入函数，调用次数计入以这个函数为最内层的调用栈
+func (p *Profiler) enter(fn ProfileFunction) {
+	p.flush()
+	node := p.top().child(profileFrame{fn: fn, line: fn.Line})
+	node.calls++
+	p.stack = append(p.stack, node)
+}
+
+// exit 从函数返回
+func (p *Profiler) exit() {
+	p.flush()
+	p.stack = p.stack[:len(p.stack)-1]
+}
+
+// statement 在语句执行之前调用
+func (p *Profiler) statement(statement ast.Statement) {
+	p.flush()
+	if len(p.stack) == 0 {
+		// 直接 Eval 语句或者块时没有经过 evalProgram
+		p.stack = append(p.stack, p.root.child(profileFrame{fn: ProfileFunction{Name: MAIN_FRAME, Line: 1}, line: 1}))
+	}
+	node := p.stack[len(p.stack)-1]
+	if line := ast.StatementPos(statement).Line; line > 0 && line != node.frame.line {
+		p.stack[len(p.stack)-1] = node.parent.child(profileFrame{fn: node.frame.fn, line: line})
+	}
+}
+
+// samples 调用树中有数据的节点对应的样本，按调用栈排序，保证输出稳定
+func (p *Profiler) samples() []*profileSample {
+	var samples []*profileSample
+	var walk func(n *profileNode, stack []profileFrame)
+	walk = func(n *profileNode, stack []profileFrame) {
+		if n != p.root {
+			stack = append([]profileFrame{n.frame}, stack...)
+			if n.calls != 0 || n.time != 0 {
+				samples = append(samples, &profileSample{stack: stack, calls: n.calls, time: n.time})
+			}
+		}
+		frames := make([]profileFrame, 0, len(n.children))
+		for frame := range n.children {
+			frames = append(frames, frame)
+		}
+		sort.Slice(frames, func(i, j int) bool {
+			a, b := frames[i], frames[j]
+			if a.fn.File != b.fn.File {
+				return a.fn.File < b.fn.File
+			}
+			if a.fn.Line != b.fn.Line {
+				return a.fn.Line < b.fn.Line
+			}
+			if a.fn.Name != b.fn.Name {
+				return a.fn.Name < b.fn.Name
+			}
+			return a.line < b.line
+		})
+		for _, frame := range frames {
+			walk(n.children[frame], stack)
+		}
+	}
+	walk(p.root, nil)
+	return samples
+}
+
+// Functions 每个函数的统计，按 Flat 从大到小排序
+func (p *Profiler) Functions() []FunctionProfile {
+	stats := make(map[ProfileFunction]*FunctionProfile)
+	get := func(fn ProfileFunction) *FunctionProfile {
+		if _, ok := stats[fn]; !ok {
+			stats[fn] = &FunctionProfile{ProfileFunction: fn}
+		}
+		return stats[fn]
+	}
+	for _, s := range p.samples() {
+		leaf := get(s.stack[0].fn)
+		leaf.Calls += s.calls
+		leaf.Flat += s.time
+		// 递归调用时同一个函数只计一次 Cum
+		seen := make(map[ProfileFunction]bool)
+		for _, frame := range s.stack {
+			if !seen[frame.fn] {
+				seen[frame.fn] = true
+				get(frame.fn).Cum += s.time
+			}
+		}
+	}
+	result := make([]FunctionProfile, 0, len(stats))
+	for _, stat := range stats {
+		result = append(result, *stat)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Flat != result[j].Flat {
+			return result[i].Flat > result[j].Flat
+		}
+		if result[i].Cum != result[j].Cum {
+			return result[i].Cum > result[j].Cum
+		}
+		if result[i].File != result[j].File {
+			return result[i].File < result[j].File
+		}
+		return result[i].Line < result[j].Line || result[i].Line == result[j].Line && result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Lines 每行源码的统计，按行号排序，不包括内置函数
+func (p *Profiler) Lines() []LineProfile {
+	type lineKey struct {
+		fn   ProfileFunction
+		line int
+	}
+	stats := make(map[lineKey]*LineProfile)
+	for _, s := range p.samples() {
+		seen := make(map[lineKey]bool)
+		for i, frame := range s.stack {
+			key := lineKey{frame.fn, frame.line}
+			if frame.fn.Line == 0 || seen[key] {
+				continue
+			}
+			seen[key] = true
+			stat, ok := stats[key]
+			if !ok {
+				stat = &LineProfile{Function: frame.fn, Line: frame.line}
+				stats[key] = stat
+			}
+			stat.Cum += s.time
+			if i == 0 {
+				stat.Flat += s.time
+			}
+		}
+	}
+	result := make([]LineProfile, 0, len(stats))
+	for _, stat := range stats {
+		result = append(result, *stat)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Function.File != result[j].Function.File {
+			return result[i].Function.File < result[j].Function.File
+		}
+		if result[i].Line != result[j].Line {
+			return result[i].Line < result[j].Line
+		}
+		return result[i].Function.Name < result[j].Function.Name
+	})
+	return result
+}
+
+// file 函数所在的文件在报告中的名字
+func (p *Profiler) file(fn ProfileFunction) string {
+	switch {
+	case fn.Line == 0:
+		return BUILTIN_FILE
+	case fn.File != "":
+		return fn.File
+	}
+	return p.File
+}
+
+// location 函数在报告中的位置
+func (p *Profiler) location(fn ProfileFunction) string {
+	if fn.Line == 0 {
+		return BUILTIN_FILE
+	}
+	return fmt.Sprintf("%s:%d", p.file(fn), fn.Line)
+}
+
+// WriteReport 写出文本报告：先是每个函数的统计，然后是每行的统计
+func (p *Profiler) WriteReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "total %s\n", p.Duration())
+	fmt.Fprintf(tw, "flat\tflat%%\tcum\tcum%%\tcalls\t  function\n")
+	total := p.Duration()
+	for _, fn := range p.Functions() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t  %s (%s)\n",
+			fn.Flat, percent(fn.Flat, total), fn.Cum, percent(fn.Cum, total), fn.Calls, fn.Name, p.location(fn.ProfileFunction))
+	}
+	fmt.Fprintf(tw, "\nflat\tflat%%\tcum\tcum%%\t  line\n")
+	for _, line := range p.Lines() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t  %s:%d (%s)\n",
+			line.Flat, percent(line.Flat, total), line.Cum, percent(line.Cum, total), p.file(line.Function), line.Line, line.Function.Name)
+	}
+	return tw.Flush()
+}
+
+// percent d 占 total 的百分比
+func percent(d time.Duration, total time.Duration) string {
+	if total <= 0 {
+		return "0.00%"
+	}
+	return fmt.Sprintf("%.2f%%", float64(d)*100/float64(total))
+}
@@ -0,0 +1,218 @@
+package evaluator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const profileInput = `let add = fn(a, b) {
+	a + b
+};
+let twice = fn(x) {
+	add(x, x)
+};
+twice(len([1, 2]));
+twice(3)`
+
+// profileRun 运行 profileInput，每次读取时间时时钟前进 1ms
+func profileRun(t *testing.T) *Profiler {
+	t.Helper()
+	p := NewProfiler("test.mk")
+	clock := time.Unix(0, 0)
+	p.now = func() time.Time {
+		clock = clock.Add(time.Millisecond)
+		return clock
+	}
+	in := New()
+	in.Profiler = p
+	testIntegerObject(t, testEvalWith(in, profileInput), 6)
+	return p
+}
+
+func TestProfilerFunctions(t *testing.T) {
+	p := profileRun(t)
+	var got []string
+	for _, fn := range p.Functions() {
+		got = append(got, fmt.Sprintf("%s:%d calls=%d flat=%s cum=%s", fn.Name, fn.Line, fn.Calls, fn.Flat, fn.Cum))
+	}
+	expected := []string{
+		"<main>:1 calls=1 flat=8ms cum=19ms",
+		"twice:4 calls=2 flat=6ms cum=10ms",
+		"add:1 calls=2 flat=4ms cum=4ms",
+		"len:0 calls=1 flat=1ms cum=1ms",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("functions wrong.\ngot=%q\nwant=%q", got, expected)
+	}
+	if p.Duration() != 19*time.Millisecond {
+		t.Errorf("duration wrong. got=%s", p.Duration())
+	}
+}
+
+func TestProfilerLines(t *testing.T) {
+	p := profileRun(t)
+	var got []string
+	for _, line := range p.Lines() {
+		got = append(got, fmt.Sprintf("%d %s flat=%s cum=%s", line.Line, line.Function.Name, line.Flat, line.Cum))
+	}
+	expected := []string{
+		"1 <main> flat=2ms cum=2ms",
+		"1 add flat=2ms cum=2ms",
+		"2 add flat=2ms cum=2ms",
+		"4 <main> flat=1ms cum=1ms",
+		"4 twice flat=2ms cum=2ms",
+		"5 twice flat=4ms cum=8ms",
+		"7 <main> flat=3ms cum=9ms",
+		"8 <main> flat=2ms cum=7ms",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("lines wrong.\ngot=%q\nwant=%q", got, expected)
+	}
+	var report bytes.Buffer
+	if err := p.WriteReport(&report); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(report.String(), "twice (test.mk:4)") || !strings.Contains(report.String(), "test.mk:5 (twice)") {
+		t.Errorf("report missing entries:\n%s", report.String())
+	}
+}
+
+// readVarint 读取 protobuf 的 varint
+func readVarint(data []byte) (uint64, []byte) {
+	var x uint64
+	for shift := 0; ; shift += 7 {
+		b := data[0]
+		data = data[1:]
+		x |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return x, data
+		}
+	}
+}
+
+// readFields 解析 protobuf 消息的顶层字段，只支持 varint 和长度前缀两种类型
+func readFields(t *testing.T, data []byte) map[int][][]byte {
+	t.Helper()
+	fields := make(map[int][][]byte)
+	for len(data) > 0 {
+		var key, n uint64
+		key, data = readVarint(data)
+		switch key & 7 {
+		case 0:
+			before := data
+			_, data = readVarint(data)
+			fields[int(key>>3)] = append(fields[int(key>>3)], before[:len(before)-len(data)])
+		case 2:
+			n, data = readVarint(data)
+			fields[int(key>>3)] = append(fields[int(key>>3)], data[:n])
+			data = data[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+func TestProfilerPprof(t *testing.T) {
+	p := profileRun(t)
+	var buf bytes.Buffer
+	if err := p.WritePprof(&buf); err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := readFields(t, data)
+	var table []string
+	for _, s := range fields[fieldStringTable] {
+		table = append(table, string(s))
+	}
+	for _, name := range []string{"", "calls", "time", "main", "twice", "add", "len", "test.mk", BUILTIN_FILE} {
+		found := false
+		for _, s := range table {
+			found = found || s == name
+		}
+		if !found {
+			t.Errorf("string table missing %q: %q", name, table)
+		}
+	}
+	if table[0] != "" {
+		t.Errorf("string table must start with empty string")
+	}
+	if len(fields[fieldSampleType]) != 2 || len(fields[fieldSample]) != len(p.samples()) || len(fields[fieldFunction]) != 4 {
+		t.Errorf("wrong number of messages: %d sample types, %d samples, %d functions",
+			len(fields[fieldSampleType]), len(fields[fieldSample]), len(fields[fieldFunction]))
+	}
+	// 所有样本的时间之和等于总时间
+	var total uint64
+	for _, sample := range fields[fieldSample] {
+		values := readFields(t, sample)[2][0]
+		_, values = readVarint(values)
+		nanos, _ := readVarint(values)
+		total += nanos
+	}
+	if time.Duration(total) != p.Duration() {
+		t.Errorf("sample total wrong. got=%s want=%s", time.Duration(total), p.Duration())
+	}
+}
+
+func TestProfilerModules(t *testing.T) {
+	p := NewProfiler("main.mk")
+	clock := time.Unix(0, 0)
+	p.now = func() time.Time {
+		clock = clock.Add(time.Millisecond)
+		return clock
+	}
+	in := New()
+	in.Profiler = p
+	in.Modules = NewModules(MapLoader{"lib.mk": "let one = 1;\nexport let work = fn(x) {\n\tx + one\n};"})
+	testIntegerObject(t, testEvalWith(in, "let work = import \"lib\"[\"work\"];\nwork(1)"), 2)
+	var got []string
+	for _, fn := range p.Functions() {
+		got = append(got, fmt.Sprintf("%s (%s) calls=%d", fn.Name, p.location(fn.ProfileFunction), fn.Calls))
+	}
+	// 模块的顶层代码和模块中定义的函数记录在模块的文件中
+	expected := []string{"<main> (main.mk:1) calls=1", "<main> (lib.mk:1) calls=1", "work (lib.mk:2) calls=1"}
+	for _, e := range expected {
+		found := false
+		for _, g := range got {
+			found = found || g == e
+		}
+		if !found {
+			t.Errorf("functions missing %q. got=%q", e, got)
+		}
+	}
+	var report bytes.Buffer
+	if err := p.WriteReport(&report); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(report.String(), "lib.mk:3 (work)") || strings.Contains(report.String(), "main.mk:3") {
+		t.Errorf("line report wrong:\n%s", report.String())
+	}
+	var pprof bytes.Buffer
+	if err := p.WritePprof(&pprof); err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(&pprof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("lib.mk")) {
+		t.Errorf("pprof string table missing lib.mk")
+	}
+}
@@ -0,0 +1,74 @@
+package evaluator
+
+import (
+	"fmt"
+	"github.com/hollykbuck/muskmelon/trace"
+	"reflect"
+	"testing"
+)
+
+// traceLines 把事件转换成 "深度 类型 名字 值" 的形式，便于比较
+func traceLines(events []trace.Event) []string {
+	var lines []string
+	for _, e := range events {
+		line := fmt.Sprintf("%d %s %s", e.Depth, e.Kind, e.Name)
+		switch {
+		case e.Err != "":
+			line += " ! " + e.Err
+		case e.Value != nil:
+			line += " = " + e.Value.Inspect()
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestTracer(t *testing.T) {
+	recorder := &trace.Recorder{}
+	in := New()
+	in.Tracer = recorder
+	testIntegerObject(t, testEvalWith(in, "1 + 2"), 3)
+	expected := []string{
+		"0 enter Program",
+		"1 enter ExpressionStatement",
+		"2 enter InfixExpression",
+		"3 enter IntegerLiteral",
+		"3 exit IntegerLiteral = 1",
+		"3 enter IntegerLiteral",
+		"3 exit IntegerLiteral = 2",
+		"2 exit InfixExpression = 3",
+		"1 exit ExpressionStatement = 3",
+		"0 exit Program = 3",
+	}
+	if got := traceLines(recorder.Events()); !reflect.DeepEqual(got, expected) {
+		t.Errorf("events wrong.\ngot=%q\nwant=%q", got, expected)
+	}
+}
+
+func TestTracerErrors(t *testing.T) {
+	recorder := &trace.Recorder{}
+	in := New()
+	in.Tracer = recorder
+	testEvalWith(in, "let f = fn(x) { x + y };\nf(1)")
+	var errors []string
+	for _, e := range recorder.Events() {
+		if e.Err != "" {
+			errors = append(errors, fmt.Sprintf("%s %s %s", e.Pos, e.Name, e.Err))
+		}
+	}
+	expected := []string{
+		"1:21 Identifier identifier not found: y",
+		"1:19 InfixExpression identifier not found: y",
+		"1:17 ExpressionStatement identifier not found: y",
+		"1:15 BlockStatement identifier not found: y",
+		"2:2 CallExpression identifier not found: y",
+		"2:1 ExpressionStatement identifier not found: y",
+		"1:1 Program identifier not found: y",
+	}
+	if !reflect.DeepEqual(errors, expected) {
+		t.Errorf("error events wrong.\ngot=%q\nwant=%q", errors, expected)
+	}
+	if in.traceDepth != 0 {
+		t.Errorf("traceDepth not restored: %d", in.traceDepth)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/hollykbuck/muskmelon/format"
+	"github.com/hollykbuck/muskmelon/source"
+	"io"
+	"os"
+)
+
+// 进程退出码
+const (
+	exitOK          = 0
+	exitUnformatted = 1
+	exitError       = 2
+)
+
+const usage = `usage: muskfmt [-w | -check] [path ...]
+  没有参数时格式化 stdin 并输出到 stdout，目录会被递归遍历，只处理 *.mk 文件，跳过 .git 等隐藏目录。
+`
+
+// formatter 一次运行的配置和结果
+type formatter struct {
+	write  bool
+	check  bool
+	stdout io.Writer
+	stderr io.Writer
+	// unformatted 是否发现了没有格式化的文件
+	unformatted bool
+	// failed 是否出现了错误
+	failed bool
+}
+
+// run 解析命令行参数并格式化文件，返回进程退出码
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("muskfmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	f := &formatter{stdout: stdout, stderr: stderr}
+	flags.BoolVar(&f.write, "w", false, "将结果写回源文件")
+	flags.BoolVar(&f.check, "check", false, "只列出没有格式化的文件，存在这样的文件时以非零状态退出")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if f.write && f.check {
+		fmt.Fprintln(stderr, "-w 和 -check 不能同时使用")
+		return exitError
+	}
+	if flags.NArg() == 0 {
+		if f.write {
+			fmt.Fprintln(stderr, "不能对 stdin 使用 -w")
+			return exitError
+		}
+		src, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "读取 stdin 失败: %s\n", err)
+			return exitError
+		}
+		f.process("<stdin>", src)
+	}
+	for _, path := range flags.Args() {
+		f.walk(path)
+	}
+	switch {
+	case f.failed:
+		return exitError
+	case f.unformatted:
+		return exitUnformatted
+	default:
+		return exitOK
+	}
+}
+
+// walk 格式化文件，或者递归格式化目录中的源文件
+func (f *formatter) walk(root string) {
+	err := source.Walk(root, source.IsSource, func(path string) error {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		f.process(path, src)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(f.stderr, err)
+		f.failed = true
+	}
+}
+
+// process 格式化一个文件，按模式输出结果
+func (f *formatter) process(name string, src []byte) {
+	formatted, err := format.Source(src)
+	if err != nil {
+		fmt.Fprintf(f.stderr, "%s: %s\n", name, err)
+		f.failed = true
+		return
+	}
+	changed := !bytes.Equal(src, formatted)
+	switch {
+	case f.check:
+		if changed {
+			fmt.Fprintln(f.stdout, name)
+			f.unformatted = true
+		}
+	case f.write:
+		if changed {
+			if err := writeFile(name, formatted); err != nil {
+				fmt.Fprintln(f.stderr, err)
+				f.failed = true
+			}
+		}
+	default:
+		_, _ = f.stdout.Write(formatted)
+	}
+}
+
+// writeFile 写回源文件，保留原来的权限，例如 #! 脚本的可执行位
+func writeFile(name string, data []byte) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, info.Mode().Perm())
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
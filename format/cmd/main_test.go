@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"ok.mk":         "let x = 1;\n",
+		"messy.mk":      "let x=1\n",
+		"broken.mk":     "let = 1\n",
+		"sub/nested.mk": "puts( 1 )\n",
+		"sub/skip.txt":  "not source",
+		"sub/.git/x.mk": "let y=2\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(dir, filepath.FromSlash(name)) }
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  string
+		code   int
+		stdout string
+	}{
+		{"stdin", nil, "let x=1", exitOK, "let x = 1;\n"},
+		{"file", []string{path("messy.mk")}, "", exitOK, "let x = 1;\n"},
+		{"check clean", []string{"-check", path("ok.mk")}, "", exitOK, ""},
+		{"check dir", []string{"-check", path("sub")}, "", exitUnformatted, path("sub/nested.mk") + "\n"},
+		{"parse error", []string{path("broken.mk")}, "", exitError, ""},
+		{"missing", []string{path("missing.mk")}, "", exitError, ""},
+		{"w and check", []string{"-w", "-check", path("ok.mk")}, "", exitError, ""},
+		{"w stdin", []string{"-w"}, "", exitError, ""},
+		{"unknown flag", []string{"-nope"}, "", exitError, ""},
+	}
+	for _, tt := range tests {
+		var stdout, stderr strings.Builder
+		if code := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr); code != tt.code {
+			t.Errorf("%s: exit code wrong. got=%d, want=%d (stderr=%q)", tt.name, code, tt.code, stderr.String())
+		}
+		if stdout.String() != tt.stdout {
+			t.Errorf("%s: stdout wrong. got=%q, want=%q", tt.name, stdout.String(), tt.stdout)
+		}
+	}
+}
+
+// TestWriteKeepsMode 测试 -w 保留 #! 脚本的可执行位
+func TestWriteKeepsMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.mk")
+	if err := os.WriteFile(path, []byte("#!/usr/bin/env muskmelon\nputs( 1 )\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr strings.Builder
+	if code := run([]string{"-w", path}, strings.NewReader(""), &stdout, &stderr); code != exitOK {
+		t.Fatalf("exit code wrong. got=%d (stderr=%q)", code, stderr.String())
+	}
+	content, _ := os.ReadFile(path)
+	if string(content) != "#!/usr/bin/env muskmelon\nputs(1);\n" {
+		t.Errorf("file not formatted. got=%q", content)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o755 {
+		t.Errorf("file mode changed. got=%v", info.Mode().Perm())
+	}
+}
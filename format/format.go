@@ -0,0 +1,342 @@
+// Package format 将源码格式化为统一的风格。
+// 使用 tab 缩进，按照 parser 的运算符优先级只保留必要的括号，并保留注释和语句之间的单个空行。
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/lexer"
+	"github.com/hollykbuck/muskmelon/parser"
+	"github.com/hollykbuck/muskmelon/token"
+	"sort"
+	"strings"
+)
+
+// primary 字面量、标识符等不需要括号的表达式的优先级
+const primary = parser.INDEX + 1
+
+// Source 格式化一段源码。源码有语法错误时返回错误。
+func Source(src []byte) ([]byte, error) {
+	l := lexer.New(string(src))
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parser errors:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+	}
+	pr := newPrinter(string(src), l.Comments())
+	pr.statements(program.Statements, len(src), false)
+	return pr.out.Bytes(), nil
+}
+
+// printer 格式化的状态
+type printer struct {
+	out bytes.Buffer
+	// indent 当前的缩进层数
+	indent int
+	// comments 源码中所有的注释，next 是下一条还没有输出的注释
+	comments []token.Token
+	next     int
+	// tokens 源码中除注释外所有的 token，用于计算语句的结束位置
+	tokens []token.Token
+	// closing 每个 `{` 的偏移对应的 `}` 的偏移
+	closing map[int]int
+	// lastLine 上一个输出的语句或注释在源码中的结束行，0 表示不需要插入空行
+	lastLine int
+}
+
+// newPrinter 重新扫描源码，记录 token 和括号的配对关系
+func newPrinter(src string, comments []token.Token) *printer {
+	p := &printer{comments: comments, closing: make(map[int]int)}
+	l := lexer.New(src)
+	var open []int
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		p.tokens = append(p.tokens, tok)
+		switch tok.Type {
+		case token.LBRACE:
+			open = append(open, tok.Pos.Offset)
+		case token.RBRACE:
+			if len(open) > 0 {
+				p.closing[open[len(open)-1]] = tok.Pos.Offset
+				open = open[:len(open)-1]
+			}
+		}
+	}
+	return p
+}
+
+// statements 输出一组语句。end 是这组语句之后的边界（`}` 或者文件末尾）的偏移。
+// inBlock 为 true 时最后一条表达式语句作为块的值，不加分号。
+func (p *printer) statements(statements []ast.Statement, end int, inBlock bool) {
+	for i, statement := range statements {
+		start := statementToken(statement).Pos.Offset
+		boundary := end
+		var next ast.Statement
+		if i+1 < len(statements) {
+			next = statements[i+1]
+			boundary = statementToken(next).Pos.Offset
+		}
+		p.flushComments(start)
+		p.blankLine(statementToken(statement).Pos.Line)
+		p.writeIndent()
+		p.statement(statement, inBlock && next == nil, next)
+		last := p.lastTokenBefore(boundary)
+		p.lastLine = endLine(last)
+		// 与语句结束在同一行的注释跟在语句后面
+		if p.next < len(p.comments) {
+			comment := p.comments[p.next]
+			before := p.lastTokenBefore(comment.Pos.Offset)
+			if comment.Pos.Offset < boundary && before.Pos.Offset >= start && comment.Pos.Line == endLine(before) {
+				p.out.WriteString(" " + comment.Literal)
+				p.next++
+			}
+		}
+		p.out.WriteString("\n")
+	}
+	p.flushComments(end)
+}
+
+// flushComments 输出偏移小于 offset 的注释，每条注释单独一行
+func (p *printer) flushComments(offset int) {
+	for p.next < len(p.comments) && p.comments[p.next].Pos.Offset < offset {
+		comment := p.comments[p.next]
+		p.blankLine(comment.Pos.Line)
+		p.writeIndent()
+		p.out.WriteString(comment.Literal + "\n")
+		p.lastLine = comment.Pos.Line
+		p.next++
+	}
+}
+
+// blankLine 源码中上一个元素和 line 之间有空行时输出一个空行
+func (p *printer) blankLine(line int) {
+	if p.lastLine > 0 && line > p.lastLine+1 {
+		p.out.WriteString("\n")
+	}
+}
+
+func (p *printer) writeIndent() {
+	p.out.WriteString(strings.Repeat("\t", p.indent))
+}
+
+// statement 输出一条语句，不包含换行符
+func (p *printer) statement(statement ast.Statement, last bool, next ast.Statement) {
+	switch s := statement.(type) {
+	case *ast.LetStatement:
+		if s.Exported {
+			p.out.WriteString("export ")
+		}
+		p.out.WriteString("let " + s.Name.Value)
+		if s.Type != nil {
+			p.out.WriteString(": " + s.Type.String())
+		}
+		p.out.WriteString(" = ")
+		p.expression(s.Value)
+		p.out.WriteString(";")
+	case *ast.ReturnStatement:
+		p.out.WriteString("return")
+		if s.ReturnValue != nil {
+			p.out.WriteString(" ")
+			p.expression(s.ReturnValue)
+		}
+		p.out.WriteString(";")
+	case *ast.ExpressionStatement:
+		p.expression(s.Expression)
+		if !last && needsSemicolon(s, next) {
+			p.out.WriteString(";")
+		}
+	}
+}
+
+// needsSemicolon 判断表达式语句后面是否需要分号。
+// if 表达式后面一般不加分号，除非下一条语句可能被当作 if 表达式的后缀。
+func needsSemicolon(s *ast.ExpressionStatement, next ast.Statement) bool {
+	if _, ok := s.Expression.(*ast.IfExpression); !ok {
+		return true
+	}
+	nextExpression, ok := next.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+	switch leadingToken(nextExpression.Expression) {
+	case token.LPAREN, token.LBRACKET, token.MINUS:
+		return true
+	}
+	return false
+}
+
+// leadingToken 表达式格式化之后的第一个 token 的类型
+func leadingToken(e ast.Expression) token.TokenType {
+	var left ast.Expression
+	min := 0
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		left, min = e.Left, parser.Precedence(e.Token.Type)
+	case *ast.CallExpression:
+		left, min = e.Function, parser.CALL
+	case *ast.IndexExpression:
+		left, min = e.Left, parser.CALL
+	case *ast.PrefixExpression:
+		return e.Token.Type
+	case *ast.ArrayLiteral:
+		return token.LBRACKET
+	default:
+		// 其他表达式以标识符、字面量或者关键字开头，不会被当作上一条语句的后缀
+		return token.IDENT
+	}
+	if precedenceOf(left) < min {
+		return token.LPAREN
+	}
+	return leadingToken(left)
+}
+
+// expression 输出表达式
+func (p *printer) expression(e ast.Expression) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.out.WriteString(e.Value)
+	case *ast.IntegerLiteral:
+		p.out.WriteString(e.Token.Literal)
+	case *ast.Boolean:
+		p.out.WriteString(fmt.Sprintf("%t", e.Value))
+	case *ast.StringLiteral:
+		p.out.WriteString(`"` + e.Value + `"`)
+	case *ast.PrefixExpression:
+		p.out.WriteString(e.Operator)
+		p.operand(e.Right, parser.PREFIX)
+	case *ast.InfixExpression:
+		precedence := parser.Precedence(e.Token.Type)
+		p.operand(e.Left, precedence)
+		p.out.WriteString(" " + e.Operator + " ")
+		// 中缀运算符都是左结合的，右边同优先级的表达式需要括号
+		p.operand(e.Right, precedence+1)
+	case *ast.CallExpression:
+		p.operand(e.Function, parser.CALL)
+		p.out.WriteString("(")
+		p.expressionList(e.Arguments)
+		p.out.WriteString(")")
+	case *ast.IndexExpression:
+		p.operand(e.Left, parser.CALL)
+		p.out.WriteString("[")
+		p.expression(e.Index)
+		p.out.WriteString("]")
+	case *ast.ArrayLiteral:
+		p.out.WriteString("[")
+		p.expressionList(e.Elements)
+		p.out.WriteString("]")
+	case *ast.ImportExpression:
+		p.out.WriteString(`import "` + e.Path.Value + `"`)
+	case *ast.IfExpression:
+		p.out.WriteString("if (")
+		p.expression(e.Condition)
+		p.out.WriteString(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.out.WriteString(" else ")
+			p.block(e.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		p.out.WriteString("fn(")
+		for i, param := range e.Parameters {
+			if i > 0 {
+				p.out.WriteString(", ")
+			}
+			p.out.WriteString(param.Value)
+			if i < len(e.ParameterTypes) && e.ParameterTypes[i] != nil {
+				p.out.WriteString(": " + e.ParameterTypes[i].String())
+			}
+		}
+		p.out.WriteString(")")
+		if e.ReturnType != nil {
+			p.out.WriteString(": " + e.ReturnType.String())
+		}
+		p.out.WriteString(" ")
+		p.block(e.Body)
+	}
+}
+
+// operand 输出运算数，优先级低于 min 时加上括号
+func (p *printer) operand(e ast.Expression, min int) {
+	if precedenceOf(e) < min {
+		p.out.WriteString("(")
+		p.expression(e)
+		p.out.WriteString(")")
+		return
+	}
+	p.expression(e)
+}
+
+func (p *printer) expressionList(list []ast.Expression) {
+	for i, e := range list {
+		if i > 0 {
+			p.out.WriteString(", ")
+		}
+		p.expression(e)
+	}
+}
+
+// block 输出 { ... }，块中的语句各占一行并缩进
+func (p *printer) block(b *ast.BlockStatement) {
+	// 语法正确的源码中每个 `{` 都有对应的 `}`
+	end := p.closing[b.Token.Pos.Offset]
+	hasComments := p.next < len(p.comments) && p.comments[p.next].Pos.Offset < end
+	if len(b.Statements) == 0 && !hasComments {
+		p.out.WriteString("{}")
+		return
+	}
+	p.out.WriteString("{\n")
+	p.indent++
+	// 块的第一行之前不插入空行
+	p.lastLine = 0
+	p.statements(b.Statements, end, true)
+	p.indent--
+	p.writeIndent()
+	p.out.WriteString("}")
+}
+
+// precedenceOf 表达式作为运算数时的优先级
+func precedenceOf(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(e.Token.Type)
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.CallExpression:
+		return parser.CALL
+	case *ast.IndexExpression:
+		return parser.INDEX
+	default:
+		return primary
+	}
+}
+
+// lastTokenBefore 查找偏移小于 offset 的最后一个 token
+func (p *printer) lastTokenBefore(offset int) token.Token {
+	i := sort.Search(len(p.tokens), func(i int) bool {
+		return p.tokens[i].Pos.Offset >= offset
+	})
+	if i == 0 {
+		return token.Token{}
+	}
+	return p.tokens[i-1]
+}
+
+// endLine token 最后一个字符所在的行，字符串字面量可以跨越多行
+func endLine(tok token.Token) int {
+	return tok.Pos.Line + strings.Count(tok.Literal, "\n")
+}
+
+// statementToken 语句的第一个 token
+func statementToken(statement ast.Statement) token.Token {
+	switch s := statement.(type) {
+	case *ast.LetStatement:
+		return s.Token
+	case *ast.ReturnStatement:
+		return s.Token
+	case *ast.ExpressionStatement:
+		return s.Token
+	case *ast.BlockStatement:
+		return s.Token
+	}
+	return token.Token{}
+}
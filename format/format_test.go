@@ -0,0 +1,60 @@
+package format
+
+import "testing"
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=1", "let x = 1;\n"},
+		{"let x = (1 + 2) * 3; let y = 1 + (2 * 3);", "let x = (1 + 2) * 3;\nlet y = 1 + 2 * 3;\n"},
+		{"a - (b - c); (a - b) - c", "a - (b - c);\na - b - c;\n"},
+		{"-(a + b); !(-a); (-a) * b", "-(a + b);\n!-a;\n-a * b;\n"},
+		{"(a + b)(c); (f(x))[0]; ((a))[1]", "(a + b)(c);\nf(x)[0];\na[1];\n"},
+		{"a < b == (c > d)", "a < b == c > d;\n"},
+		{"[1,2 ,3][0]", "[1, 2, 3][0];\n"},
+		{`puts( "a b" )`, "puts(\"a b\");\n"},
+		{"let add = fn(a,b){ return a+b; }", "let add = fn(a, b) {\n\treturn a + b;\n};\n"},
+		{"let f = fn() {}", "let f = fn() {};\n"},
+		{"let x:int=1", "let x: int = 1;\n"},
+		{"#!/usr/bin/env muskmelon\nlet x=1", "#!/usr/bin/env muskmelon\nlet x = 1;\n"},
+		{`export  let m=import   "lib/m"`, "export let m = import \"lib/m\";\n"},
+		{"let f = fn(a:string,b , c :[ [int] ]):bool{ true }", "let f = fn(a: string, b, c: [[int]]): bool {\n\ttrue\n};\n"},
+		{"if (x) { 1 } else { if (y) { 2 } }", "if (x) {\n\t1\n} else {\n\tif (y) {\n\t\t2\n\t}\n}\n"},
+		{"if (x) { a; b }", "if (x) {\n\ta;\n\tb\n}\n"},
+		{"if (x) { 1 }; (y)", "if (x) {\n\t1\n}\ny;\n"},
+		{"if (x) { 1 }; (y + 1) * 2", "if (x) {\n\t1\n};\n(y + 1) * 2;\n"},
+		{"if (x) { 1 }; -y", "if (x) {\n\t1\n};\n-y;\n"},
+		{"if (x) { 1 }; [y]", "if (x) {\n\t1\n};\n[y];\n"},
+		{"if (x) { 1 } let y = 2;", "if (x) {\n\t1\n}\nlet y = 2;\n"},
+		{"a\n\n\n\nb", "a;\n\nb;\n"},
+		{"fn() {\n\n  a\n\n  b\n\n}", "fn() {\n\ta;\n\n\tb\n};\n"},
+		{"// header\n\nlet x = 1; // one\n// two\nlet y = 2;\n// tail\n", "// header\n\nlet x = 1; // one\n// two\nlet y = 2;\n// tail\n"},
+		{"let f = fn() {\n// only\n}", "let f = fn() {\n\t// only\n};\n"},
+		{"if (x) {\n  a // after a\n  // before end\n}", "if (x) {\n\ta // after a\n\t// before end\n}\n"},
+		{"let s = \"multi\nline\"; // c\nlet t = 1;", "let s = \"multi\nline\"; // c\nlet t = 1;\n"},
+	}
+	for _, tt := range tests {
+		got, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("Source(%q) returned error: %s", tt.input, err)
+			continue
+		}
+		if string(got) != tt.expected {
+			t.Errorf("Source(%q) wrong.\ngot=%q\nwant=%q", tt.input, got, tt.expected)
+			continue
+		}
+		// 格式化的结果再次格式化不应该发生变化
+		again, err := Source(got)
+		if err != nil || string(again) != string(got) {
+			t.Errorf("Source is not idempotent for %q. got=%q (%v)", tt.input, again, err)
+		}
+	}
+}
+
+func TestSourceParseError(t *testing.T) {
+	if _, err := Source([]byte("let = 1")); err == nil {
+		t.Errorf("expected parse error")
+	}
+}
@@ -0,0 +1,70 @@
+// Package framing 读写以 Content-Length 头部分隔的消息，LSP 和 DAP 都使用这种格式。
+package framing
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// MAX_LENGTH 一条消息的最大字节数，避免按照错误的头部分配过大的内存
+const MAX_LENGTH = 64 << 20
+
+// Reader 从连接中逐条读取消息的内容
+type Reader struct {
+	r *textproto.Reader
+}
+
+// NewReader 创建从 r 读取消息的 Reader
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: textproto.NewReader(bufio.NewReader(r))}
+}
+
+// Read 读取一条消息的内容。连接关闭时返回 io.EOF。
+// 头部错误或者长度超过 MAX_LENGTH 时无法找到下一条消息的开头，调用者应当关闭连接。
+func (r *Reader) Read() ([]byte, error) {
+	header, err := r.r.ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	if length > MAX_LENGTH {
+		return nil, fmt.Errorf("Content-Length %d exceeds %d", length, MAX_LENGTH)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r.r.R, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// Writer 向连接写入消息，可以在多个 goroutine 中使用
+type Writer struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// NewWriter 创建向 w 写入消息的 Writer
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write 写入头部和 body
+func (w *Writer) Write(body []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := fmt.Fprintf(w.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err := w.w.Write(body)
+	return err
+}
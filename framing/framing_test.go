@@ -0,0 +1,49 @@
+package framing
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadWrite(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, body := range []string{`{"a":1}`, "", "中文"} {
+		if err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := NewReader(&buf)
+	for _, expected := range []string{`{"a":1}`, "", "中文"} {
+		body, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != expected {
+			t.Errorf("body wrong. got=%q, want=%q", body, expected)
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Content-Type: text\r\n\r\n{}", `invalid Content-Length ""`},
+		{"Content-Length: -1\r\n\r\n", `invalid Content-Length "-1"`},
+		{"Content-Length: 99999999999\r\n\r\n", "Content-Length 99999999999 exceeds 67108864"},
+		{"Content-Length: 10\r\n\r\n{}", "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		_, err := NewReader(strings.NewReader(tt.input)).Read()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expected, err)
+		}
+	}
+}
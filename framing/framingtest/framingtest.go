@@ -0,0 +1,94 @@
+// Package framingtest 提供测试用的客户端，在同一个进程中通过管道与 LSP、DAP 等服务器通信。
+package framingtest
+
+import (
+	"encoding/json"
+	"github.com/hollykbuck/muskmelon/framing"
+	"io"
+	"testing"
+	"time"
+)
+
+// TIMEOUT 等待一条消息的最长时间
+const TIMEOUT = 5 * time.Second
+
+// Client 通过管道与在单独的 goroutine 中运行的服务器通信
+type Client struct {
+	t testing.TB
+	w *framing.Writer
+	// incoming 后台读取到的消息。管道没有缓冲，客户端必须一直读取，服务器才不会阻塞在写入上。
+	incoming chan []byte
+	done     chan error
+}
+
+// NewClient 在新的 goroutine 中运行 serve，serve 从 in 读取请求、向 out 写入响应。
+// serve 返回时关闭 out，测试结束时关闭 in。
+func NewClient(t testing.TB, serve func(in io.Reader, out io.Writer) error) *Client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &Client{t: t, w: framing.NewWriter(clientOut), incoming: make(chan []byte, 100), done: make(chan error, 1)}
+	go func() {
+		err := serve(serverIn, serverOut)
+		serverOut.Close()
+		c.done <- err
+	}()
+	go func() {
+		defer close(c.incoming)
+		r := framing.NewReader(clientIn)
+		for {
+			data, err := r.Read()
+			if err != nil {
+				return
+			}
+			c.incoming <- data
+		}
+	}()
+	t.Cleanup(func() { clientOut.Close() })
+	return c
+}
+
+// Write 发送一条消息，body 原样写入
+func (c *Client) Write(body []byte) {
+	c.t.Helper()
+	if err := c.w.Write(body); err != nil {
+		c.t.Fatalf("write: %s", err)
+	}
+}
+
+// Send 把 v 编码为 JSON 发送
+func (c *Client) Send(v interface{}) {
+	c.t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.Write(data)
+}
+
+// Next 读取下一条消息并解码到 v，连接关闭或者超时时测试失败
+func (c *Client) Next(v interface{}) {
+	c.t.Helper()
+	select {
+	case data, ok := <-c.incoming:
+		if !ok {
+			c.t.Fatalf("connection closed")
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			c.t.Fatalf("decode %s: %s", data, err)
+		}
+	case <-time.After(TIMEOUT):
+		c.t.Fatalf("timeout waiting for message")
+	}
+}
+
+// Wait 等待 serve 返回，返回它的错误
+func (c *Client) Wait() error {
+	c.t.Helper()
+	select {
+	case err := <-c.done:
+		return err
+	case <-time.After(TIMEOUT):
+		c.t.Fatalf("timeout waiting for server to return")
+	}
+	return nil
+}
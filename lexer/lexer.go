@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"github.com/hollykbuck/muskmelon/token"
+	"strings"
 	"unicode/utf8"
 )
 
@@ -14,11 +15,16 @@ type Lexer struct {
 	readPosition int
 	// 当前的字符
 	ch rune
+	// 当前字符所在的行号和列号
+	line   int
+	column int
+	// comments 跳过的注释，按出现的顺序记录
+	comments []token.Token
 }
 
 // New Lexer 的构造函数
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	// 初始化 lexer
 	l.readChar()
 	return l
@@ -29,6 +35,13 @@ func New(input string) *Lexer {
 //
 // mutable
 func (l *Lexer) readChar() {
+	// 越过换行符时换到下一行
+	if l.ch == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
 	step := 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
@@ -47,6 +60,7 @@ func (l *Lexer) readChar() {
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 	l.skipWhitespace()
+	pos := token.Position{Offset: l.position, Line: l.line, Column: l.column}
 	switch l.ch {
 	case '=':
 		char, _ := l.peekChar()
@@ -60,6 +74,8 @@ func (l *Lexer) NextToken() token.Token {
 		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -107,16 +123,19 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Type = token.INT
 			tok.Literal = l.readNumber()
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
 	}
 	l.readChar()
+	tok.Pos = pos
 	return tok
 }
 
@@ -132,10 +151,37 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
+// skipWhitespace 跳过空白和注释
 func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+	for {
+		next, _ := l.peekChar()
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r':
+			l.readChar()
+		case l.ch == '/' && next == '/':
+			l.readComment()
+		case l.position == 0 && l.ch == '#' && next == '!':
+			// 脚本第一行的 #! 解释器声明也作为注释
+			l.readComment()
+		default:
+			return
+		}
+	}
+}
+
+// readComment 读取一行注释并记录下来，不包含行尾的换行符
+func (l *Lexer) readComment() {
+	pos := token.Position{Offset: l.position, Line: l.line, Column: l.column}
+	for l.ch != '\n' && l.ch != 0 {
 		l.readChar()
 	}
+	literal := strings.TrimRight(l.input[pos.Offset:l.position], "\r")
+	l.comments = append(l.comments, token.Token{Type: token.COMMENT, Literal: literal, Pos: pos})
+}
+
+// Comments 返回到目前为止跳过的注释
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
 }
 
 func isLetter(ch rune) bool {
@@ -176,3 +222,16 @@ func (l *Lexer) readString() string {
 	}
 	return l.input[position:l.position]
 }
+
+// Input 返回被扫描的源码
+func (l *Lexer) Input() string {
+	return l.input
+}
+
+// Offset 返回上一个 token 结束位置的偏移
+func (l *Lexer) Offset() int {
+	if l.position > len(l.input) {
+		return len(l.input)
+	}
+	return l.position
+}
@@ -275,3 +275,80 @@ if (5 < 10) {
 		}
 	}
 }
+
+// TestTokenPositions 测试 token 的行号、列号和偏移
+func TestTokenPositions(t *testing.T) {
+	input := "let x = \"héllo\";\n  x == 10\n"
+	tests := []struct {
+		expectedType token.TokenType
+		expectedPos  token.Position
+	}{
+		{token.LET, token.Position{Offset: 0, Line: 1, Column: 1}},
+		{token.IDENT, token.Position{Offset: 4, Line: 1, Column: 5}},
+		{token.ASSIGN, token.Position{Offset: 6, Line: 1, Column: 7}},
+		{token.STRING, token.Position{Offset: 8, Line: 1, Column: 9}},
+		{token.SEMICOLON, token.Position{Offset: 16, Line: 1, Column: 16}},
+		{token.IDENT, token.Position{Offset: 20, Line: 2, Column: 3}},
+		{token.EQ, token.Position{Offset: 22, Line: 2, Column: 5}},
+		{token.INT, token.Position{Offset: 25, Line: 2, Column: 8}},
+		{token.EOF, token.Position{Offset: 28, Line: 3, Column: 1}},
+	}
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Pos != tt.expectedPos {
+			t.Errorf("tests[%d] - position wrong. expected=%+v, got=%+v", i, tt.expectedPos, tok.Pos)
+		}
+	}
+}
+
+// TestComments 测试注释被跳过并记录下来
+func TestComments(t *testing.T) {
+	input := "// header\nlet x = 10 / 2; // half\r\n// end"
+	l := New(input)
+	var types []token.TokenType
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		types = append(types, tok.Type)
+	}
+	expectedTypes := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT, token.SLASH, token.INT, token.SEMICOLON}
+	if len(types) != len(expectedTypes) {
+		t.Fatalf("wrong tokens. got=%v", types)
+	}
+	for i := range types {
+		if types[i] != expectedTypes[i] {
+			t.Errorf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, expectedTypes[i], types[i])
+		}
+	}
+	expected := []token.Token{
+		{Type: token.COMMENT, Literal: "// header", Pos: token.Position{Offset: 0, Line: 1, Column: 1}},
+		{Type: token.COMMENT, Literal: "// half", Pos: token.Position{Offset: 26, Line: 2, Column: 17}},
+		{Type: token.COMMENT, Literal: "// end", Pos: token.Position{Offset: 35, Line: 3, Column: 1}},
+	}
+	comments := l.Comments()
+	if len(comments) != len(expected) {
+		t.Fatalf("wrong number of comments. got=%v", comments)
+	}
+	for i := range expected {
+		if comments[i] != expected[i] {
+			t.Errorf("comments[%d] wrong. expected=%+v, got=%+v", i, expected[i], comments[i])
+		}
+	}
+}
+
+// TestShebang 测试源码开头的 #! 行作为注释，其他位置的 # 仍然是非法字符
+func TestShebang(t *testing.T) {
+	l := New("#!/usr/bin/env muskmelon\nx #!")
+	expected := []token.TokenType{token.IDENT, token.ILLEGAL, token.BANG, token.EOF}
+	for i, want := range expected {
+		if tok := l.NextToken(); tok.Type != want {
+			t.Errorf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, want, tok.Type)
+		}
+	}
+	comments := l.Comments()
+	if len(comments) != 1 || comments[0].Literal != "#!/usr/bin/env muskmelon" || comments[0].Pos.Line != 1 {
+		t.Errorf("shebang comment wrong. got=%+v", comments)
+	}
+}
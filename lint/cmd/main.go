@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/hollykbuck/muskmelon/lint"
+	"github.com/hollykbuck/muskmelon/source"
+	"io"
+	"os"
+	"strings"
+)
+
+// 进程退出码
+const (
+	exitOK       = 0
+	exitProblems = 1
+	exitError    = 2
+)
+
+const usage = `usage: musklint [-config file] [-disable rules] [-enable rules] [-rules] [path ...]
+  没有参数时检查 stdin，目录会被递归遍历，只处理 *.mk 文件，跳过 .git 等隐藏目录。
+  输出格式为 file:line:column: message (rule)。
+`
+
+// linter 一次运行的配置和结果
+type linter struct {
+	config lint.Config
+	stdout io.Writer
+	stderr io.Writer
+	// problems 是否发现了问题
+	problems bool
+	// failed 是否出现了错误
+	failed bool
+}
+
+// run 解析命令行参数并检查文件，返回进程退出码
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("musklint", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	configPath := flags.String("config", "", "JSON 格式的配置文件，例如 {\"rules\": {\"unused-binding\": false}}")
+	disable := flags.String("disable", "", "逗号分隔的要关闭的规则")
+	enable := flags.String("enable", "", "逗号分隔的要开启的规则，优先于配置文件")
+	list := flags.Bool("rules", false, "列出所有规则")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if *list {
+		for _, rule := range lint.Rules {
+			fmt.Fprintf(stdout, "%-16s %s\n", rule.ID, rule.Description)
+		}
+		return exitOK
+	}
+	l := &linter{config: lint.Config{Rules: make(map[string]bool)}, stdout: stdout, stderr: stderr}
+	if *configPath != "" {
+		data, err := os.ReadFile(*configPath)
+		if err == nil {
+			err = json.Unmarshal(data, &l.config)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "读取配置失败: %s\n", err)
+			return exitError
+		}
+		if l.config.Rules == nil {
+			l.config.Rules = make(map[string]bool)
+		}
+	}
+	for _, setting := range []struct {
+		rules   string
+		enabled bool
+	}{{*disable, false}, {*enable, true}} {
+		if setting.rules == "" {
+			continue
+		}
+		for _, rule := range strings.Split(setting.rules, ",") {
+			if !knownRule(rule) {
+				fmt.Fprintf(stderr, "未知的规则 %q\n", rule)
+				return exitError
+			}
+			l.config.Rules[rule] = setting.enabled
+		}
+	}
+	if flags.NArg() == 0 {
+		src, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "读取 stdin 失败: %s\n", err)
+			return exitError
+		}
+		l.process("<stdin>", src)
+	}
+	for _, path := range flags.Args() {
+		l.walk(path)
+	}
+	switch {
+	case l.failed:
+		return exitError
+	case l.problems:
+		return exitProblems
+	default:
+		return exitOK
+	}
+}
+
+func knownRule(id string) bool {
+	for _, rule := range lint.Rules {
+		if rule.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// walk 检查文件，或者递归检查目录中的源文件
+func (l *linter) walk(root string) {
+	err := source.Walk(root, source.IsSource, func(path string) error {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		l.process(path, src)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(l.stderr, err)
+		l.failed = true
+	}
+}
+
+// process 检查一个文件并输出诊断
+func (l *linter) process(name string, src []byte) {
+	diagnostics, err := lint.Source(src, l.config)
+	if err != nil {
+		fmt.Fprintf(l.stderr, "%s: %s\n", name, err)
+		l.failed = true
+		return
+	}
+	for _, d := range diagnostics {
+		fmt.Fprintf(l.stdout, "%s:%s\n", name, d)
+		l.problems = true
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"clean.mk":      "#!/usr/bin/env muskmelon\nlet x = 1;\nputs(x);\n",
+		"unused.mk":     "let x = 1;\n",
+		"broken.mk":     "let = 1\n",
+		"config.json":   `{"rules": {"unused-binding": false}}`,
+		"sub/a.mk":      "let y = 2;\n",
+		"sub/skip.txt":  "let z = 3;\n",
+		"sub/.git/b.mk": "let w = 4;\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(dir, filepath.FromSlash(name)) }
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  string
+		code   int
+		stdout string
+	}{
+		{"clean", []string{path("clean.mk")}, "", exitOK, ""},
+		{"problems", []string{path("unused.mk")}, "", exitProblems, path("unused.mk") + ":1:5: x is bound but never used (unused-binding)\n"},
+		{"dir", []string{path("sub")}, "", exitProblems, path("sub/a.mk") + ":1:5: y is bound but never used (unused-binding)\n"},
+		{"stdin", nil, "let s = 1;", exitProblems, "<stdin>:1:5: s is bound but never used (unused-binding)\n"},
+		{"disable", []string{"-disable", "unused-binding", path("unused.mk")}, "", exitOK, ""},
+		{"config", []string{"-config", path("config.json"), path("unused.mk")}, "", exitOK, ""},
+		{"enable over config", []string{"-config", path("config.json"), "-enable", "unused-binding", path("unused.mk")}, "", exitProblems, path("unused.mk") + ":1:5: x is bound but never used (unused-binding)\n"},
+		{"unknown rule", []string{"-disable", "nope", path("unused.mk")}, "", exitError, ""},
+		{"parse error", []string{path("broken.mk")}, "", exitError, ""},
+		{"missing", []string{path("missing.mk")}, "", exitError, ""},
+		{"unknown flag", []string{"-nope"}, "", exitError, ""},
+	}
+	for _, tt := range tests {
+		var stdout, stderr strings.Builder
+		if code := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr); code != tt.code {
+			t.Errorf("%s: exit code wrong. got=%d, want=%d (stderr=%q)", tt.name, code, tt.code, stderr.String())
+		}
+		if stdout.String() != tt.stdout {
+			t.Errorf("%s: stdout wrong. got=%q, want=%q", tt.name, stdout.String(), tt.stdout)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+// Package lint 检查源码中常见的错误。
+// 每条诊断都带有位置和规则 ID，规则可以通过 Config 单独关闭，
+// 也可以用 `// lint:ignore 规则ID` 注释屏蔽诊断：跟在代码后面的注释作用于所在的行，单独一行的注释作用于下一行。
+package lint
+
+import (
+	"fmt"
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/lexer"
+	"github.com/hollykbuck/muskmelon/parser"
+	"github.com/hollykbuck/muskmelon/token"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// 规则 ID
+const (
+	RuleUnusedBinding = "unused-binding"
+	RuleShadowedParam = "shadowed-param"
+	RuleUnreachable   = "unreachable"
+	RuleWrongArity    = "wrong-arity"
+	RuleSelfCompare   = "self-compare"
+)
+
+// Rule 规则的 ID 和说明
+type Rule struct {
+	ID          string
+	Description string
+}
+
+// Rules 所有的规则
+var Rules = []Rule{
+	{RuleUnusedBinding, "let 绑定的名字没有被使用"},
+	{RuleShadowedParam, "函数参数遮蔽了外层的名字，或者函数体中的 let 重新绑定了参数"},
+	{RuleUnreachable, "return 之后的语句不会被执行"},
+	{RuleWrongArity, "调用已知函数时参数个数不对"},
+	{RuleSelfCompare, "比较运算的两边是同一个表达式"},
+}
+
+// IGNORE_DIRECTIVE 屏蔽诊断的注释前缀，后面跟逗号分隔的规则 ID，不写规则 ID 时屏蔽所有规则
+const IGNORE_DIRECTIVE = "lint:ignore"
+
+// variadic 可变参数函数的参数个数
+const variadic = -1
+
+// unknownArity 无法确定参数个数
+const unknownArity = -2
+
+// Builtins 内置函数的参数个数，-1 表示可变参数。
+// 名字与 evaluator.DefaultBuiltins 一致，增加内置函数时需要同时修改这里。
+var Builtins = map[string]int{
+	"len":  1,
+	"puts": variadic,
+	// 断言的说明参数是可选的
+	"assert":      variadic,
+	"assertEq":    variadic,
+	"assertError": variadic,
+}
+
+// Diagnostic 一条诊断
+type Diagnostic struct {
+	Pos     token.Position
+	Rule    string
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s (%s)", d.Pos, d.Message, d.Rule)
+}
+
+// Config 规则的开关。没有列出的规则默认开启。
+type Config struct {
+	Rules map[string]bool `json:"rules"`
+}
+
+// Enabled 判断规则是否开启
+func (c Config) Enabled(rule string) bool {
+	enabled, ok := c.Rules[rule]
+	return !ok || enabled
+}
+
+// Source 解析并检查一段源码。源码有语法错误时返回错误。
+func Source(src []byte, config Config) ([]Diagnostic, error) {
+	l := lexer.New(string(src))
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parser errors:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+	}
+	return Program(program, l.Comments(), config), nil
+}
+
+// Program 检查 AST。comments 是源码中的注释，用于识别屏蔽诊断的注释，可以为 nil。
+// 返回的诊断按位置排序。
+func Program(program *ast.Program, comments []token.Token, config Config) []Diagnostic {
+	c := &checker{}
+	sc := newScope(nil)
+	c.declare(sc, program)
+	c.statements(sc, program.Statements)
+	c.unused(sc)
+
+	ignored := ignoredLines(comments, tokenLines(program))
+	var diagnostics []Diagnostic
+	for _, d := range c.diagnostics {
+		if !config.Enabled(d.Rule) || ignored.covers(d) {
+			continue
+		}
+		diagnostics = append(diagnostics, d)
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Pos.Offset < diagnostics[j].Pos.Offset
+	})
+	return diagnostics
+}
+
+// binding 作用域中的一个名字
+type binding struct {
+	name  *ast.Identifier
+	used  bool
+	param bool
+	// arity 绑定的函数的参数个数，不是函数或者被多次绑定时为 unknownArity
+	arity int
+}
+
+// scope 程序和每个函数体各是一个作用域，if 的块与外层共享作用域
+type scope struct {
+	outer    *scope
+	bindings map[string]*binding
+	// order 绑定的顺序，保证诊断的输出稳定
+	order []*binding
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, bindings: make(map[string]*binding)}
+}
+
+func (s *scope) add(b *binding) {
+	s.bindings[b.name.Value] = b
+	s.order = append(s.order, b)
+}
+
+// lookup 从内到外查找名字
+func (s *scope) lookup(name string) *binding {
+	for ; s != nil; s = s.outer {
+		if b, ok := s.bindings[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+type checker struct {
+	diagnostics []Diagnostic
+}
+
+func (c *checker) report(pos token.Position, rule string, format string, args ...interface{}) {
+	c.diagnostics = append(c.diagnostics, Diagnostic{Pos: pos, Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+// declare 先收集作用域中所有的 let，函数可以引用在它之后才绑定的名字
+func (c *checker) declare(sc *scope, node ast.Node) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FunctionLiteral:
+			return n == node
+		case *ast.LetStatement:
+			if existing, ok := sc.bindings[n.Name.Value]; ok {
+				if existing.param {
+					c.report(n.Name.Token.Pos, RuleShadowedParam, "let %s redeclares parameter %s", n.Name.Value, n.Name.Value)
+				}
+				existing.arity = unknownArity
+				return true
+			}
+			// 导出的绑定由导入它的模块使用
+			b := &binding{name: n.Name, arity: unknownArity, used: n.Exported}
+			if fn, ok := n.Value.(*ast.FunctionLiteral); ok {
+				b.arity = len(fn.Parameters)
+			}
+			sc.add(b)
+		}
+		return true
+	})
+}
+
+// statements 检查一组语句，return 之后的第一条语句是不可达的
+func (c *checker) statements(sc *scope, statements []ast.Statement) {
+	for i, statement := range statements {
+		c.node(sc, statement)
+		if _, ok := statement.(*ast.ReturnStatement); ok && i+1 < len(statements) {
+			c.report(ast.StatementPos(statements[i+1]), RuleUnreachable, "unreachable code after return")
+		}
+	}
+}
+
+// node 检查一个节点和它的子节点
+func (c *checker) node(sc *scope, node ast.Node) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BlockStatement:
+			c.statements(sc, n.Statements)
+			return false
+		case *ast.LetStatement:
+			// 绑定的名字不是引用
+			if n.Value != nil {
+				c.node(sc, n.Value)
+			}
+			return false
+		case *ast.Identifier:
+			if b := sc.lookup(n.Value); b != nil {
+				b.used = true
+			}
+		case *ast.FunctionLiteral:
+			c.function(sc, n)
+			return false
+		case *ast.CallExpression:
+			c.call(sc, n)
+		case *ast.InfixExpression:
+			c.compare(n)
+		}
+		return true
+	})
+}
+
+// function 在新的作用域中检查函数体
+func (c *checker) function(outer *scope, fn *ast.FunctionLiteral) {
+	sc := newScope(outer)
+	for _, param := range fn.Parameters {
+		if outer.lookup(param.Value) != nil {
+			c.report(param.Token.Pos, RuleShadowedParam, "parameter %s shadows an outer binding", param.Value)
+		} else if _, ok := Builtins[param.Value]; ok {
+			c.report(param.Token.Pos, RuleShadowedParam, "parameter %s shadows builtin %s", param.Value, param.Value)
+		}
+		sc.add(&binding{name: param, param: true, arity: unknownArity})
+	}
+	c.declare(sc, fn)
+	c.statements(sc, fn.Body.Statements)
+	c.unused(sc)
+}
+
+// call 检查调用已知函数时的参数个数
+func (c *checker) call(sc *scope, call *ast.CallExpression) {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return
+	}
+	arity := unknownArity
+	if b := sc.lookup(ident.Value); b != nil {
+		arity = b.arity
+	} else if builtin, ok := Builtins[ident.Value]; ok {
+		arity = builtin
+	}
+	if arity >= 0 && len(call.Arguments) != arity {
+		c.report(ident.Token.Pos, RuleWrongArity, "%s called with %d arguments, want %d", ident.Value, len(call.Arguments), arity)
+	}
+}
+
+// compare 检查两边相同的比较运算。包含调用的表达式每次求值的结果可能不同，不做检查。
+func (c *checker) compare(infix *ast.InfixExpression) {
+	switch infix.Operator {
+	case "==", "!=", "<", ">":
+	default:
+		return
+	}
+	if infix.Left == nil || infix.Right == nil || hasCall(infix.Left) {
+		return
+	}
+	if infix.Left.String() == infix.Right.String() {
+		c.report(infix.Token.Pos, RuleSelfCompare, "comparison of %s with itself", infix.Left.String())
+	}
+}
+
+// unused 报告作用域中没有被使用的 let 绑定
+func (c *checker) unused(sc *scope) {
+	for _, b := range sc.order {
+		if !b.used && !b.param {
+			c.report(b.name.Token.Pos, RuleUnusedBinding, "%s is bound but never used", b.name.Value)
+		}
+	}
+}
+
+func hasCall(node ast.Node) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if _, ok := n.(*ast.CallExpression); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// ignoreSet 每一行被屏蔽的规则，nil 表示屏蔽所有规则
+type ignoreSet map[int]map[string]bool
+
+// tokenLines 记录每一行第一个 AST 节点 token 的列号，用于判断注释前面有没有代码
+func tokenLines(program *ast.Program) map[int]int {
+	lines := make(map[int]int)
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		field := reflect.Indirect(reflect.ValueOf(n)).FieldByName("Token")
+		if !field.IsValid() {
+			return true
+		}
+		if tok, ok := field.Interface().(token.Token); ok {
+			if column, seen := lines[tok.Pos.Line]; !seen || tok.Pos.Column < column {
+				lines[tok.Pos.Line] = tok.Pos.Column
+			}
+		}
+		return true
+	})
+	return lines
+}
+
+// ignoredLines 解析屏蔽诊断的注释。
+// 跟在代码后面的注释屏蔽它所在的行，单独一行的注释屏蔽下一行。
+func ignoredLines(comments []token.Token, codeLines map[int]int) ignoreSet {
+	ignored := make(ignoreSet)
+	for _, comment := range comments {
+		text := strings.TrimSpace(strings.TrimPrefix(comment.Literal, "//"))
+		if !strings.HasPrefix(text, IGNORE_DIRECTIVE) {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(text, IGNORE_DIRECTIVE))
+		var rules map[string]bool
+		if len(fields) > 0 {
+			rules = make(map[string]bool)
+			for _, rule := range strings.Split(fields[0], ",") {
+				rules[rule] = true
+			}
+		}
+		line := comment.Pos.Line + 1
+		if column, ok := codeLines[comment.Pos.Line]; ok && column < comment.Pos.Column {
+			line = comment.Pos.Line
+		}
+		existing, ok := ignored[line]
+		switch {
+		case !ok:
+			ignored[line] = rules
+		case existing == nil || rules == nil:
+			ignored[line] = nil
+		default:
+			for rule := range rules {
+				existing[rule] = true
+			}
+		}
+	}
+	return ignored
+}
+
+// covers 判断诊断是否被屏蔽
+func (s ignoreSet) covers(d Diagnostic) bool {
+	rules, ok := s[d.Pos.Line]
+	return ok && (rules == nil || rules[d.Rule])
+}
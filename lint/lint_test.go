@@ -0,0 +1,95 @@
+package lint
+
+import (
+	"github.com/hollykbuck/muskmelon/evaluator"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func lintSource(t *testing.T, input string, config Config) []string {
+	diagnostics, err := Source([]byte(input), config)
+	if err != nil {
+		t.Fatalf("Source(%q) error: %s", input, err)
+	}
+	var got []string
+	for _, d := range diagnostics {
+		got = append(got, d.String())
+	}
+	return got
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; puts(x);", nil},
+		{"let x = 1;", []string{"1:5: x is bound but never used (unused-binding)"}},
+		{"let f = fn(a) { let b = a; a }; f(1);", []string{"1:21: b is bound but never used (unused-binding)"}},
+		{"let f = fn() { g() }; let g = fn() { 1 }; f();", nil},
+		{"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(3);", nil},
+		{"let x = 1; let f = fn(x) { x }; f(x);", []string{"1:23: parameter x shadows an outer binding (shadowed-param)"}},
+		{"let f = fn(len) { len }; f(1);", []string{"1:12: parameter len shadows builtin len (shadowed-param)"}},
+		{"let f = fn(a) { let a = 2; a }; f(1);", []string{"1:21: let a redeclares parameter a (shadowed-param)"}},
+		{"let f = fn() { return 1; puts(2); puts(3) }; f();", []string{"1:26: unreachable code after return (unreachable)"}},
+		{"if (true) { return 1; let y = 2; y }", []string{"1:23: unreachable code after return (unreachable)"}},
+		{"let f = fn(a, b) { a + b }; f(1);", []string{"1:29: f called with 1 arguments, want 2 (wrong-arity)"}},
+		{`len("a", "b"); puts(1, 2, 3);`, []string{"1:1: len called with 2 arguments, want 1 (wrong-arity)"}},
+		{"let f = fn(a) { a }; let f = 1; f(1, 2);", nil},
+		{"let x = 1; x == x; x < x + 0; x != 1;", []string{"1:14: comparison of x with itself (self-compare)"}},
+		{"let a = [1]; a[0] > a[0];", []string{"1:19: comparison of (a[0]) with itself (self-compare)"}},
+		{"let f = fn() { 1 }; f() == f();", nil},
+		{"export let x = 1;", nil},
+		{"#!/usr/bin/env muskmelon\nlet x = 1;", []string{"2:5: x is bound but never used (unused-binding)"}},
+	}
+	for _, tt := range tests {
+		got := lintSource(t, tt.input, Config{})
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("lint %q wrong.\ngot=%q\nwant=%q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	input := "let x = 1; 1 == 1;"
+	got := lintSource(t, input, Config{Rules: map[string]bool{RuleUnusedBinding: false}})
+	expected := []string{"1:14: comparison of 1 with itself (self-compare)"}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("lint with config wrong.\ngot=%q\nwant=%q", got, expected)
+	}
+}
+
+func TestIgnoreComments(t *testing.T) {
+	input := `// lint:ignore unused-binding
+let a = 1;
+let b = 2; // lint:ignore
+let c = 3; // lint:ignore self-compare
+// lint:ignore self-compare,unused-binding
+let d = d == d;
+`
+	got := lintSource(t, input, Config{})
+	expected := []string{"4:5: c is bound but never used (unused-binding)"}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("lint with ignore comments wrong.\ngot=%q\nwant=%q", got, expected)
+	}
+}
+
+func TestSourceParseError(t *testing.T) {
+	if _, err := Source([]byte("let = 1;"), Config{}); err == nil {
+		t.Errorf("expected parse error")
+	}
+}
+
+// TestBuiltinsMatchEvaluator 检查 Builtins 与 evaluator 中的内置函数一致
+func TestBuiltinsMatchEvaluator(t *testing.T) {
+	var names []string
+	for name := range Builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if expected := evaluator.DefaultBuiltins().Names(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Builtins wrong. got=%v, want=%v", names, expected)
+	}
+}
@@ -0,0 +1,327 @@
+package lsp
+
+import (
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/cst"
+	"github.com/hollykbuck/muskmelon/lexer"
+	"github.com/hollykbuck/muskmelon/parser"
+	"github.com/hollykbuck/muskmelon/types"
+	"reflect"
+	"sort"
+	"unicode/utf8"
+)
+
+// bindingKind 名字的来源
+type bindingKind int
+
+const (
+	bindingLet bindingKind = iota
+	bindingParam
+	bindingBuiltin
+)
+
+// binding 一个名字的声明
+type binding struct {
+	kind bindingKind
+	// name 声明处的标识符，内置函数为 nil
+	name *ast.Identifier
+	// let 声明这个名字的 let 语句
+	let *ast.LetStatement
+	// fn 和 index 声明这个参数的函数和参数的下标
+	fn    *ast.FunctionLiteral
+	index int
+}
+
+// document 打开的文档和分析的结果，每次修改都重新分析
+type document struct {
+	uri     string
+	version int
+	text    string
+	// lines 每一行开头的偏移量
+	lines   []int
+	program *ast.Program
+	errors  []parser.Error
+	// syntax 每个 AST 节点对应的语法树节点，用于计算节点的区间
+	syntax map[ast.Node]*cst.Node
+	// refs 每个标识符（包括声明处的标识符）对应的声明
+	refs map[*ast.Identifier]*binding
+	// idents 按位置排序的标识符
+	idents []*ast.Identifier
+	// types 类型推导的结果，有语法错误时为 nil
+	types *types.Result
+}
+
+// newDocument 解析并分析文档，builtins 是可以直接使用的内置函数的名字
+func newDocument(uri string, version int, text string, builtins []string) *document {
+	d := &document{uri: uri, version: version, text: text, lines: []int{0}}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			d.lines = append(d.lines, i+1)
+		}
+	}
+	p := parser.NewLossless(lexer.New(text))
+	d.program = p.ParseProgram()
+	d.errors = p.ErrorList()
+	d.syntax = make(map[ast.Node]*cst.Node)
+	d.index(p.SyntaxTree())
+	r := &resolver{refs: make(map[*ast.Identifier]*binding), builtins: make(map[string]*binding)}
+	for _, name := range builtins {
+		r.builtins[name] = &binding{kind: bindingBuiltin}
+	}
+	r.resolve(d.program)
+	d.refs = r.refs
+	for ident := range d.refs {
+		d.idents = append(d.idents, ident)
+	}
+	sort.Slice(d.idents, func(i, j int) bool {
+		return d.idents[i].Token.Pos.Offset < d.idents[j].Token.Pos.Offset
+	})
+	// 有语法错误的 AST 可能不完整，只在没有语法错误时推导类型
+	if len(d.errors) == 0 {
+		d.types = types.Check(d.program, nil)
+	}
+	return d
+}
+
+func (d *document) index(node *cst.Node) {
+	if _, ok := d.syntax[node.AST]; !ok {
+		d.syntax[node.AST] = node
+	}
+	for _, child := range node.Children {
+		if child, ok := child.(*cst.Node); ok {
+			d.index(child)
+		}
+	}
+}
+
+// position 将字节偏移量转换为 LSP 的位置
+func (d *document) position(offset int) Position {
+	if offset > len(d.text) {
+		offset = len(d.text)
+	}
+	line := sort.Search(len(d.lines), func(i int) bool { return d.lines[i] > offset }) - 1
+	character := 0
+	for _, r := range d.text[d.lines[line]:offset] {
+		character += utf16Len(r)
+	}
+	return Position{Line: line, Character: character}
+}
+
+// offset 将 LSP 的位置转换为字节偏移量，超出行尾的位置被限制在行尾
+func (d *document) offset(pos Position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(d.lines) {
+		return len(d.text)
+	}
+	offset := d.lines[pos.Line]
+	for character := 0; offset < len(d.text) && d.text[offset] != '\n'; {
+		r, size := utf8.DecodeRuneInString(d.text[offset:])
+		character += utf16Len(r)
+		if character > pos.Character {
+			break
+		}
+		offset += size
+	}
+	return offset
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// rangeOf 返回节点在源码中的区间
+func (d *document) rangeOf(node ast.Node) Range {
+	if syntax, ok := d.syntax[node]; ok {
+		if tokens := syntax.Tokens(); len(tokens) > 0 {
+			first, last := tokens[0], tokens[len(tokens)-1]
+			return Range{
+				Start: d.position(first.Pos.Offset),
+				End:   d.position(last.Pos.Offset + len(last.Text)),
+			}
+		}
+	}
+	// 不在语法树中的节点只有 token 的区间
+	if ident, ok := node.(*ast.Identifier); ok {
+		return d.identRange(ident)
+	}
+	pos := d.position(tokenOffset(node))
+	return Range{Start: pos, End: pos}
+}
+
+func (d *document) identRange(ident *ast.Identifier) Range {
+	start := ident.Token.Pos.Offset
+	return Range{Start: d.position(start), End: d.position(start + len(ident.Value))}
+}
+
+// tokenOffset 节点的 token 的偏移量
+func tokenOffset(node ast.Node) int {
+	field := reflect.Indirect(reflect.ValueOf(node)).FieldByName("Token")
+	if !field.IsValid() {
+		return 0
+	}
+	return field.FieldByName("Pos").FieldByName("Offset").Interface().(int)
+}
+
+// identAt 返回覆盖 offset 的标识符，光标在标识符末尾时也算
+func (d *document) identAt(offset int) *ast.Identifier {
+	i := sort.Search(len(d.idents), func(i int) bool {
+		return d.idents[i].Token.Pos.Offset+len(d.idents[i].Value) >= offset
+	})
+	if i < len(d.idents) && d.idents[i].Token.Pos.Offset <= offset {
+		return d.idents[i]
+	}
+	return nil
+}
+
+// diagnostics 语法错误的诊断，区间覆盖出错的 token
+func (d *document) diagnostics() []Diagnostic {
+	diagnostics := []Diagnostic{}
+	var tokens []*cst.Token
+	if root := d.syntax[d.program]; root != nil {
+		tokens = root.Tokens()
+	}
+	for _, err := range d.errors {
+		r := Range{Start: d.position(err.Pos.Offset), End: d.position(err.Pos.Offset)}
+		i := sort.Search(len(tokens), func(i int) bool { return tokens[i].Pos.Offset >= err.Pos.Offset })
+		if i < len(tokens) && tokens[i].Pos.Offset == err.Pos.Offset {
+			r.End = d.position(err.Pos.Offset + len(tokens[i].Text))
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    r,
+			Severity: SeverityError,
+			Source:   "muskmelon",
+			Message:  err.Msg,
+		})
+	}
+	return diagnostics
+}
+
+// typeOf 返回声明的类型，无法推导时返回空字符串
+func (d *document) typeOf(ident *ast.Identifier, b *binding) string {
+	if d.types == nil {
+		return ""
+	}
+	var t types.Type
+	switch {
+	case ident != b.name:
+		t = d.types.TypeOf(ident)
+	case b.kind == bindingLet:
+		t = d.types.TypeOf(b.let.Value)
+	case b.kind == bindingParam:
+		if fn, ok := d.types.TypeOf(b.fn).(*types.Con); ok && b.index < len(fn.Args) {
+			t = fn.Args[b.index]
+		}
+	}
+	if t == nil {
+		return ""
+	}
+	return types.Format(t)
+}
+
+// scope 函数体或者顶层的作用域。if 的块与外层共享作用域，与 evaluator 一致。
+type scope struct {
+	outer *scope
+	names map[string]*binding
+}
+
+func (s *scope) lookup(name string) *binding {
+	for ; s != nil; s = s.outer {
+		if b, ok := s.names[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// pendingRef 声明之前出现的标识符
+type pendingRef struct {
+	ident *ast.Identifier
+	scope *scope
+}
+
+// resolver 找出每个标识符对应的声明
+type resolver struct {
+	refs     map[*ast.Identifier]*binding
+	builtins map[string]*binding
+	scope    *scope
+	pending  []pendingRef
+}
+
+func (r *resolver) resolve(program *ast.Program) {
+	r.scope = &scope{names: make(map[string]*binding)}
+	r.visit(program)
+	// 函数体可以引用之后才声明的名字，只要调用发生在声明之后。
+	// 所有声明都处理完之后再查找一次。
+	for _, ref := range r.pending {
+		if b := ref.scope.lookup(ref.ident.Value); b != nil {
+			r.refs[ref.ident] = b
+		} else if b, ok := r.builtins[ref.ident.Value]; ok {
+			r.refs[ref.ident] = b
+		}
+	}
+}
+
+func (r *resolver) visit(node ast.Node) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			r.let(n)
+			return false
+		case *ast.FunctionLiteral:
+			r.function(n)
+			return false
+		case *ast.Identifier:
+			r.use(n)
+			return false
+		case *ast.TypeAnnotation:
+			return false
+		}
+		return true
+	})
+}
+
+// let 函数可以递归调用自己，名字在值之前声明，其他的值在名字之后声明
+func (r *resolver) let(n *ast.LetStatement) {
+	if n.Name == nil {
+		r.visit(n.Value)
+		return
+	}
+	b := &binding{kind: bindingLet, name: n.Name, let: n}
+	if _, ok := n.Value.(*ast.FunctionLiteral); ok {
+		r.declare(b)
+		r.visit(n.Value)
+		return
+	}
+	r.visit(n.Value)
+	r.declare(b)
+}
+
+func (r *resolver) function(n *ast.FunctionLiteral) {
+	r.scope = &scope{outer: r.scope, names: make(map[string]*binding)}
+	for i, param := range n.Parameters {
+		r.declare(&binding{kind: bindingParam, name: param, fn: n, index: i})
+	}
+	r.visit(n.Body)
+	r.scope = r.scope.outer
+}
+
+func (r *resolver) declare(b *binding) {
+	r.scope.names[b.name.Value] = b
+	r.refs[b.name] = b
+}
+
+func (r *resolver) use(ident *ast.Identifier) {
+	if b := r.scope.lookup(ident.Value); b != nil {
+		r.refs[ident] = b
+		return
+	}
+	r.pending = append(r.pending, pendingRef{ident: ident, scope: r.scope})
+}
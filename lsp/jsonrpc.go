@@ -0,0 +1,100 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hollykbuck/muskmelon/framing"
+	"io"
+)
+
+// JSON-RPC 的错误码
+const (
+	ParseError           = -32700
+	InvalidRequest       = -32600
+	MethodNotFound       = -32601
+	InvalidParams        = -32602
+	InternalError        = -32603
+	ServerNotInitialized = -32002
+)
+
+// Message JSON-RPC 2.0 的消息。
+// 请求有 ID 和 Method，通知只有 Method，响应有 ID 和 Result 或者 Error。
+type Message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *ResponseError   `json:"error,omitempty"`
+}
+
+// IsRequest 判断消息是否是需要响应的请求
+func (m *Message) IsRequest() bool {
+	return m.Method != "" && m.ID != nil
+}
+
+// ResponseError 响应中的错误
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// Conn 以 LSP 的 Content-Length 头部分隔消息的 JSON-RPC 连接。
+// 可以同时读写，写入是并发安全的。
+type Conn struct {
+	r *framing.Reader
+	w *framing.Writer
+}
+
+// NewConn 从 r 读取消息，向 w 写入消息
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	return &Conn{r: framing.NewReader(r), w: framing.NewWriter(w)}
+}
+
+// Read 读取一条消息。连接关闭时返回 io.EOF。
+func (c *Conn) Read() (*Message, error) {
+	body, err := c.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	m := &Message{}
+	if err := json.Unmarshal(body, m); err != nil {
+		return nil, &ResponseError{Code: ParseError, Message: err.Error()}
+	}
+	return m, nil
+}
+
+// Write 写入一条消息
+func (c *Conn) Write(m *Message) error {
+	m.JSONRPC = "2.0"
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return c.w.Write(body)
+}
+
+// Notify 发送通知
+func (c *Conn) Notify(method string, params interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return c.Write(&Message{Method: method, Params: data})
+}
+
+// Reply 发送请求的响应，err 不为 nil 时发送错误
+func (c *Conn) Reply(id *json.RawMessage, result interface{}, err *ResponseError) error {
+	if err != nil {
+		return c.Write(&Message{ID: id, Error: err})
+	}
+	data, marshalErr := json.Marshal(result)
+	if marshalErr != nil {
+		return c.Write(&Message{ID: id, Error: &ResponseError{Code: InternalError, Message: marshalErr.Error()}})
+	}
+	return c.Write(&Message{ID: id, Result: data})
+}
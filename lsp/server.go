@@ -0,0 +1,294 @@
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/evaluator"
+	"github.com/hollykbuck/muskmelon/token"
+	"io"
+	"sort"
+)
+
+// ErrExitWithoutShutdown 客户端没有发送 shutdown 就发送了 exit，或者连接意外关闭
+var ErrExitWithoutShutdown = errors.New("exit without shutdown")
+
+// handler 处理一个请求或者通知，通知的返回值被忽略，错误只在不是 *ResponseError 时返回给 Serve
+type handler func(s *Server, params json.RawMessage) (interface{}, error)
+
+var handlers = map[string]handler{
+	"initialize":                  (*Server).initialize,
+	"initialized":                 func(*Server, json.RawMessage) (interface{}, error) { return nil, nil },
+	"shutdown":                    (*Server).shutdown,
+	"textDocument/didOpen":        (*Server).didOpen,
+	"textDocument/didChange":      (*Server).didChange,
+	"textDocument/didClose":       (*Server).didClose,
+	"textDocument/documentSymbol": (*Server).documentSymbol,
+	"textDocument/definition":     (*Server).definition,
+	"textDocument/hover":          (*Server).hover,
+	"textDocument/completion":     (*Server).completion,
+}
+
+// Server 通过 stdio 等连接提供 .mk 文件的语言服务
+type Server struct {
+	conn *Conn
+	docs map[string]*document
+	// builtins 补全和解析标识符时使用的内置函数名
+	builtins    []string
+	initialized bool
+	// shuttingDown 收到 shutdown 之后只接受 exit
+	shuttingDown bool
+}
+
+// New 创建从 in 读取请求、向 out 写入响应的 Server
+func New(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		conn:     NewConn(in, out),
+		docs:     make(map[string]*document),
+		builtins: evaluator.DefaultBuiltins().Names(),
+	}
+}
+
+// Serve 处理消息直到收到 exit。
+// 在 shutdown 之后收到 exit 时返回 nil，否则返回 ErrExitWithoutShutdown 或者读写错误。
+func (s *Server) Serve() error {
+	for {
+		m, err := s.conn.Read()
+		if err == io.EOF {
+			return ErrExitWithoutShutdown
+		}
+		var rpcErr *ResponseError
+		if errors.As(err, &rpcErr) {
+			if err := s.conn.Reply(nil, nil, rpcErr); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if m.Method == "exit" {
+			if s.shuttingDown {
+				return nil
+			}
+			return ErrExitWithoutShutdown
+		}
+		if err := s.handle(m); err != nil {
+			return err
+		}
+	}
+}
+
+// handle 处理一条消息，只有写入失败时返回错误
+func (s *Server) handle(m *Message) error {
+	h, ok := handlers[m.Method]
+	if !m.IsRequest() {
+		// 未知的通知和响应直接忽略。通知无法回复错误，参数错误等 *ResponseError 被忽略，
+		// 其余的错误（例如发布诊断时写入失败）返回给调用者
+		if ok && s.initialized && !s.shuttingDown {
+			var rpcErr *ResponseError
+			if _, err := h(s, m.Params); err != nil && !errors.As(err, &rpcErr) {
+				return err
+			}
+		}
+		return nil
+	}
+	switch {
+	case !ok:
+		return s.conn.Reply(m.ID, nil, &ResponseError{Code: MethodNotFound, Message: "method not found: " + m.Method})
+	case !s.initialized && m.Method != "initialize":
+		return s.conn.Reply(m.ID, nil, &ResponseError{Code: ServerNotInitialized, Message: "server not initialized"})
+	case s.shuttingDown:
+		return s.conn.Reply(m.ID, nil, &ResponseError{Code: InvalidRequest, Message: "server is shutting down"})
+	}
+	result, err := h(s, m.Params)
+	if err != nil {
+		var rpcErr *ResponseError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &ResponseError{Code: InternalError, Message: err.Error()}
+		}
+		return s.conn.Reply(m.ID, nil, rpcErr)
+	}
+	return s.conn.Reply(m.ID, result, nil)
+}
+
+// decode 解码请求的参数
+func decode(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &ResponseError{Code: InvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// document 返回打开的文档，文档没有打开时返回错误
+func (s *Server) document(uri string) (*document, error) {
+	d, ok := s.docs[uri]
+	if !ok {
+		return nil, &ResponseError{Code: InvalidParams, Message: fmt.Sprintf("document %s is not open", uri)}
+	}
+	return d, nil
+}
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	if s.initialized {
+		return nil, &ResponseError{Code: InvalidRequest, Message: "server already initialized"}
+	}
+	s.initialized = true
+	result := InitializeResult{ServerInfo: ServerInfo{Name: "musklsp"}}
+	result.Capabilities.TextDocumentSync = TextDocumentSyncKindFull
+	result.Capabilities.DocumentSymbolProvider = true
+	result.Capabilities.DefinitionProvider = true
+	result.Capabilities.HoverProvider = true
+	return result, nil
+}
+
+func (s *Server) shutdown(params json.RawMessage) (interface{}, error) {
+	s.shuttingDown = true
+	return nil, nil
+}
+
+func (s *Server) didOpen(params json.RawMessage) (interface{}, error) {
+	var p DidOpenTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	return nil, s.update(p.TextDocument.URI, p.TextDocument.Version, p.TextDocument.Text)
+}
+
+func (s *Server) didChange(params json.RawMessage) (interface{}, error) {
+	var p DidChangeTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if len(p.ContentChanges) == 0 {
+		return nil, nil
+	}
+	// 全量同步时最后一次修改就是完整的文档
+	text := p.ContentChanges[len(p.ContentChanges)-1].Text
+	return nil, s.update(p.TextDocument.URI, p.TextDocument.Version, text)
+}
+
+func (s *Server) didClose(params json.RawMessage) (interface{}, error) {
+	var p DidCloseTextDocumentParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	delete(s.docs, p.TextDocument.URI)
+	// 清空已经关闭的文档的诊断
+	return nil, s.conn.Notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         p.TextDocument.URI,
+		Diagnostics: []Diagnostic{},
+	})
+}
+
+// update 重新分析文档并发布诊断
+func (s *Server) update(uri string, version int, text string) error {
+	d := newDocument(uri, version, text, s.builtins)
+	s.docs[uri] = d
+	return s.conn.Notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Version:     version,
+		Diagnostics: d.diagnostics(),
+	})
+}
+
+// documentSymbol 列出顶层的 let 绑定
+func (s *Server) documentSymbol(params json.RawMessage) (interface{}, error) {
+	var p DocumentSymbolParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	symbols := []DocumentSymbol{}
+	for _, statement := range d.program.Statements {
+		let, ok := statement.(*ast.LetStatement)
+		if !ok || let.Name == nil {
+			continue
+		}
+		kind := SymbolKindVariable
+		if _, ok := let.Value.(*ast.FunctionLiteral); ok {
+			kind = SymbolKindFunction
+		}
+		symbols = append(symbols, DocumentSymbol{
+			Name:           let.Name.Value,
+			Detail:         d.typeOf(let.Name, d.refs[let.Name]),
+			Kind:           kind,
+			Range:          d.rangeOf(let),
+			SelectionRange: d.identRange(let.Name),
+		})
+	}
+	return symbols, nil
+}
+
+// lookup 找到光标处的标识符和它的声明
+func (s *Server) lookup(params json.RawMessage) (*document, *ast.Identifier, *binding, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, nil, nil, err
+	}
+	d, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ident := d.identAt(d.offset(p.Position))
+	if ident == nil {
+		return d, nil, nil, nil
+	}
+	return d, ident, d.refs[ident], nil
+}
+
+// definition 跳转到标识符的声明，内置函数和找不到声明的名字返回 null
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	d, _, b, err := s.lookup(params)
+	if err != nil || b == nil || b.name == nil {
+		return nil, err
+	}
+	return Location{URI: d.uri, Range: d.identRange(b.name)}, nil
+}
+
+// hover 显示标识符的种类和推导出的类型
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+	d, ident, b, err := s.lookup(params)
+	if err != nil || ident == nil {
+		return nil, err
+	}
+	var text string
+	switch {
+	case b == nil:
+		text = "unknown " + ident.Value
+	case b.kind == bindingBuiltin:
+		text = "builtin " + ident.Value
+	case b.kind == bindingParam:
+		text = "param " + ident.Value
+	default:
+		text = "let " + ident.Value
+	}
+	if b != nil {
+		if t := d.typeOf(ident, b); t != "" {
+			text += ": " + t
+		}
+	}
+	r := d.identRange(ident)
+	return Hover{Contents: MarkupContent{Kind: "plaintext", Value: text}, Range: &r}, nil
+}
+
+// completion 补全关键字和内置函数，由客户端按已经输入的前缀过滤
+func (s *Server) completion(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	items := []CompletionItem{}
+	for _, keyword := range token.Keywords() {
+		items = append(items, CompletionItem{Label: keyword, Kind: CompletionItemKindKeyword})
+	}
+	for _, name := range s.builtins {
+		items = append(items, CompletionItem{Label: name, Kind: CompletionItemKindFunction, Detail: "builtin"})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items, nil
+}
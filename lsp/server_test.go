@@ -0,0 +1,331 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/hollykbuck/muskmelon/framing/framingtest"
+	"io"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// client 在同一个进程中通过管道与 Server 通信的 JSON-RPC 客户端
+type client struct {
+	*framingtest.Client
+	t      *testing.T
+	nextID int
+	// notifications 等待响应时收到的通知
+	notifications []*Message
+}
+
+func newClient(t *testing.T) *client {
+	return &client{Client: framingtest.NewClient(t, func(in io.Reader, out io.Writer) error {
+		return New(in, out).Serve()
+	}), t: t}
+}
+
+// next 读取下一条消息
+func (c *client) next() *Message {
+	c.t.Helper()
+	m := &Message{}
+	c.Next(m)
+	return m
+}
+
+// call 发送请求并等待响应，响应是错误时返回错误
+func (c *client) call(method string, params interface{}, result interface{}) *ResponseError {
+	c.t.Helper()
+	c.nextID++
+	id := json.RawMessage(strconv.Itoa(c.nextID))
+	c.Send(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+	for {
+		m := c.next()
+		if m.ID == nil {
+			c.notifications = append(c.notifications, m)
+			continue
+		}
+		if string(*m.ID) != string(id) {
+			c.t.Fatalf("response id wrong. got=%s, want=%s", *m.ID, id)
+		}
+		if m.Error != nil {
+			return m.Error
+		}
+		if result != nil {
+			if err := json.Unmarshal(m.Result, result); err != nil {
+				c.t.Fatalf("decode result of %s: %s", method, err)
+			}
+		}
+		return nil
+	}
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.t.Helper()
+	c.Send(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// diagnostics 等待服务器发布诊断
+func (c *client) diagnostics() PublishDiagnosticsParams {
+	c.t.Helper()
+	var m *Message
+	if len(c.notifications) > 0 {
+		m, c.notifications = c.notifications[0], c.notifications[1:]
+	} else {
+		m = c.next()
+	}
+	if m.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("expected publishDiagnostics, got %q", m.Method)
+	}
+	var params PublishDiagnosticsParams
+	if err := json.Unmarshal(m.Params, &params); err != nil {
+		c.t.Fatal(err)
+	}
+	return params
+}
+
+const testURI = "file:///test.mk"
+
+// open 初始化服务器并打开文档
+func (c *client) open(text string) {
+	c.t.Helper()
+	if err := c.call("initialize", map[string]interface{}{}, nil); err != nil {
+		c.t.Fatalf("initialize: %s", err)
+	}
+	c.notify("initialized", map[string]interface{}{})
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: testURI, LanguageID: "muskmelon", Version: 1, Text: text},
+	})
+}
+
+func at(line int, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+		Position:     Position{Line: line, Character: character},
+	}
+}
+
+func span(line int, start int, end int) Range {
+	return Range{Start: Position{Line: line, Character: start}, End: Position{Line: line, Character: end}}
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := newClient(t)
+	c.open("let x = 1;\nlet = 2;")
+	params := c.diagnostics()
+	if params.URI != testURI || params.Version != 1 {
+		t.Errorf("wrong document. got=%s version %d", params.URI, params.Version)
+	}
+	if len(params.Diagnostics) == 0 {
+		t.Fatalf("expected diagnostics")
+	}
+	d := params.Diagnostics[0]
+	if d.Range != span(1, 4, 5) || d.Severity != SeverityError {
+		t.Errorf("wrong diagnostic %+v", d)
+	}
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: testURI, Version: 2},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "let x = 1;\nlet y = 2;"}},
+	})
+	if params := c.diagnostics(); params.Version != 2 || len(params.Diagnostics) != 0 {
+		t.Errorf("expected no diagnostics after fix, got %+v", params)
+	}
+	c.notify("textDocument/didClose", DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: testURI}})
+	if params := c.diagnostics(); len(params.Diagnostics) != 0 {
+		t.Errorf("expected diagnostics to be cleared, got %+v", params)
+	}
+}
+
+// TestDiagnosticsShebang 测试 #! 脚本没有语法错误
+func TestDiagnosticsShebang(t *testing.T) {
+	c := newClient(t)
+	c.open("#!/usr/bin/env muskmelon\nputs(1);")
+	if params := c.diagnostics(); len(params.Diagnostics) != 0 {
+		t.Errorf("expected no diagnostics, got %+v", params.Diagnostics)
+	}
+}
+
+const testSource = `let add = fn(a, b) { a + b };
+let n = add(1, 2);
+let s = "ä😀"; let m = len(s);
+if (n > 2) { let inner = 1; }
+`
+
+func TestDocumentSymbol(t *testing.T) {
+	c := newClient(t)
+	c.open(testSource)
+	var symbols []DocumentSymbol
+	if err := c.call("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: testURI}}, &symbols); err != nil {
+		t.Fatal(err)
+	}
+	expected := []DocumentSymbol{
+		{Name: "add", Detail: "fn(a, a) -> a", Kind: SymbolKindFunction, Range: span(0, 0, 29), SelectionRange: span(0, 4, 7)},
+		{Name: "n", Detail: "int", Kind: SymbolKindVariable, Range: span(1, 0, 18), SelectionRange: span(1, 4, 5)},
+		{Name: "s", Detail: "string", Kind: SymbolKindVariable, Range: span(2, 0, 14), SelectionRange: span(2, 4, 5)},
+		{Name: "m", Detail: "int", Kind: SymbolKindVariable, Range: span(2, 15, 30), SelectionRange: span(2, 19, 20)},
+	}
+	if !reflect.DeepEqual(symbols, expected) {
+		t.Errorf("symbols wrong.\ngot=%+v\nwant=%+v", symbols, expected)
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	tests := []struct {
+		pos      TextDocumentPositionParams
+		expected *Location
+	}{
+		// 函数体中的参数
+		{at(0, 21), &Location{URI: testURI, Range: span(0, 13, 14)}},
+		// 光标在标识符末尾
+		{at(0, 26), &Location{URI: testURI, Range: span(0, 16, 17)}},
+		{at(1, 9), &Location{URI: testURI, Range: span(0, 4, 7)}},
+		// 声明处跳转到自己
+		{at(1, 4), &Location{URI: testURI, Range: span(1, 4, 5)}},
+		// 字符串中的 😀 占两个 UTF-16 编码单元
+		{at(2, 28), &Location{URI: testURI, Range: span(2, 4, 5)}},
+		// 内置函数没有声明的位置
+		{at(2, 24), nil},
+		{at(0, 0), nil},
+	}
+	c := newClient(t)
+	c.open(testSource)
+	for _, tt := range tests {
+		var location *Location
+		if err := c.call("textDocument/definition", tt.pos, &location); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(location, tt.expected) {
+			t.Errorf("definition at %+v wrong. got=%+v, want=%+v", tt.pos.Position, location, tt.expected)
+		}
+	}
+}
+
+func TestDefinitionBeforeDeclaration(t *testing.T) {
+	c := newClient(t)
+	c.open("let f = fn() { g() };\nlet g = fn() { 1 };")
+	var location *Location
+	if err := c.call("textDocument/definition", at(0, 15), &location); err != nil {
+		t.Fatal(err)
+	}
+	if location == nil || location.Range != span(1, 4, 5) {
+		t.Errorf("definition wrong. got=%+v", location)
+	}
+}
+
+func TestHover(t *testing.T) {
+	tests := []struct {
+		pos      TextDocumentPositionParams
+		expected string
+	}{
+		{at(0, 5), "let add: fn(a, a) -> a"},
+		{at(1, 9), "let add: fn(int, int) -> int"},
+		{at(0, 13), "param a: a"},
+		{at(2, 24), "builtin len: fn(any) -> int"},
+		{at(3, 18), "let inner: int"},
+		{at(3, 0), ""},
+	}
+	c := newClient(t)
+	c.open(testSource)
+	for _, tt := range tests {
+		var hover *Hover
+		if err := c.call("textDocument/hover", tt.pos, &hover); err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if hover != nil {
+			got = hover.Contents.Value
+		}
+		if got != tt.expected {
+			t.Errorf("hover at %+v wrong. got=%q, want=%q", tt.pos.Position, got, tt.expected)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	c := newClient(t)
+	c.open("")
+	var items []CompletionItem
+	if err := c.call("textDocument/completion", at(0, 0), &items); err != nil {
+		t.Fatal(err)
+	}
+	labels := make(map[string]CompletionItemKind)
+	for _, item := range items {
+		labels[item.Label] = item.Kind
+	}
+	for label, kind := range map[string]CompletionItemKind{
+		"let":  CompletionItemKindKeyword,
+		"fn":   CompletionItemKindKeyword,
+		"len":  CompletionItemKindFunction,
+		"puts": CompletionItemKindFunction,
+	} {
+		if labels[label] != kind {
+			t.Errorf("completion %q wrong. got kind %d, want %d", label, labels[label], kind)
+		}
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	c := newClient(t)
+	if err := c.call("textDocument/hover", at(0, 0), nil); err == nil || err.Code != ServerNotInitialized {
+		t.Errorf("expected ServerNotInitialized, got %v", err)
+	}
+	c.open("")
+	if err := c.call("textDocument/unknown", nil, nil); err == nil || err.Code != MethodNotFound {
+		t.Errorf("expected MethodNotFound, got %v", err)
+	}
+	if err := c.call("textDocument/hover", TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: "file:///other.mk"}}, nil); err == nil || err.Code != InvalidParams {
+		t.Errorf("expected InvalidParams, got %v", err)
+	}
+	if err := c.call("shutdown", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	c.notify("exit", nil)
+	if err := c.Wait(); err != nil {
+		t.Errorf("Serve returned %v after shutdown", err)
+	}
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	c := newClient(t)
+	c.notify("exit", nil)
+	if err := c.Wait(); err != ErrExitWithoutShutdown {
+		t.Errorf("expected ErrExitWithoutShutdown, got %v", err)
+	}
+}
+
+// failingWriter 前 n 次写入成功，之后的写入返回 err。Conn 写入一条消息需要两次写入。
+type failingWriter struct {
+	n   int
+	err error
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, w.err
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestNotificationWriteError(t *testing.T) {
+	var in bytes.Buffer
+	conn := NewConn(nil, &in)
+	id := json.RawMessage("1")
+	if err := conn.Write(&Message{ID: &id, Method: "initialize", Params: json.RawMessage("{}")}); err != nil {
+		t.Fatal(err)
+	}
+	// 参数错误无法回复，被忽略
+	if err := conn.Notify("textDocument/didOpen", "not params"); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: testURI, LanguageID: "muskmelon", Version: 1, Text: "let x = 1;"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	out := &failingWriter{n: 2, err: errors.New("broken pipe")}
+	if err := New(&in, out).Serve(); err != out.err {
+		t.Errorf("expected write error from publishDiagnostics, got %v", err)
+	}
+}
@@ -0,0 +1,381 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// StructTag 结构体字段使用的 tag 名。
+// `muskmelon:"name"` 重命名字段，`muskmelon:"-"` 忽略字段。
+const StructTag = "muskmelon"
+
+var objectType = reflect.TypeOf((*Object)(nil)).Elem()
+
+// FromGo 将 Go 值转换为对象。
+// 支持整型、bool、string、slice、array、map、struct、指针和 nil，
+// 已经是 Object 的值原样返回。函数、channel、浮点数等类型会返回错误。
+func FromGo(v any) (Object, error) {
+	if v == nil {
+		return NULL, nil
+	}
+	return FromGoValue(reflect.ValueOf(v))
+}
+
+// FromGoValue 与 FromGo 相同，但接收 reflect.Value。
+// 通过指针、map 或者 slice 引用自身的值无法转换，返回错误。
+func FromGoValue(value reflect.Value) (Object, error) {
+	c := &converter{visiting: make(map[visitKey]bool)}
+	return c.fromGo(value)
+}
+
+// visitKey 标识一个指针、map 或者 slice 引用的值，slice 还需要长度才能区分
+type visitKey struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// converter 记录正在转换的值，用于检测循环引用。
+// 只记录当前路径上的值，多次引用同一个值但没有形成环时可以正常转换。
+type converter struct {
+	visiting map[visitKey]bool
+}
+
+// enter 标记开始转换 key 引用的值，形成环时返回错误
+func (c *converter) enter(key visitKey) error {
+	if c.visiting[key] {
+		return fmt.Errorf("cycle detected at %s", key.typ)
+	}
+	c.visiting[key] = true
+	return nil
+}
+
+func (c *converter) fromGo(value reflect.Value) (Object, error) {
+	if !value.IsValid() {
+		return NULL, nil
+	}
+	if value.Type().Implements(objectType) {
+		if isNilValue(value) {
+			return NULL, nil
+		}
+		return value.Interface().(Object), nil
+	}
+	switch value.Kind() {
+	case reflect.Interface:
+		if value.IsNil() {
+			return NULL, nil
+		}
+		return c.fromGo(value.Elem())
+	case reflect.Pointer:
+		if value.IsNil() {
+			return NULL, nil
+		}
+		visit := visitKey{ptr: value.Pointer(), typ: value.Type()}
+		if err := c.enter(visit); err != nil {
+			return nil, err
+		}
+		defer delete(c.visiting, visit)
+		return c.fromGo(value.Elem())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: value.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if value.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%d overflows %s", value.Uint(), INTEGER_OBJ)
+		}
+		return &Integer{Value: int64(value.Uint())}, nil
+	case reflect.Bool:
+		if value.Bool() {
+			return TRUE, nil
+		}
+		return FALSE, nil
+	case reflect.String:
+		return &String{Value: value.String()}, nil
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice {
+			if value.IsNil() {
+				return NULL, nil
+			}
+			visit := visitKey{ptr: value.Pointer(), typ: value.Type(), len: value.Len()}
+			if err := c.enter(visit); err != nil {
+				return nil, err
+			}
+			defer delete(c.visiting, visit)
+		}
+		elements := make([]Object, value.Len())
+		for i := range elements {
+			element, err := c.fromGo(value.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			elements[i] = element
+		}
+		return &Array{Elements: elements}, nil
+	case reflect.Map:
+		if value.IsNil() {
+			return NULL, nil
+		}
+		visit := visitKey{ptr: value.Pointer(), typ: value.Type()}
+		if err := c.enter(visit); err != nil {
+			return nil, err
+		}
+		defer delete(c.visiting, visit)
+		pairs := make(map[HashKey]HashPair, value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			key, err := c.fromGo(iter.Key())
+			if err != nil {
+				return nil, fmt.Errorf("map key: %w", err)
+			}
+			hashable, ok := key.(Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			val, err := c.fromGo(iter.Value())
+			if err != nil {
+				return nil, fmt.Errorf("map value %s: %w", key.Inspect(), err)
+			}
+			pairs[hashable.HashKey()] = HashPair{Key: key, Value: val}
+		}
+		return &Hash{Pairs: pairs}, nil
+	case reflect.Struct:
+		pairs := make(map[HashKey]HashPair)
+		for i := 0; i < value.NumField(); i++ {
+			name, ok := structFieldName(value.Type().Field(i))
+			if !ok {
+				continue
+			}
+			val, err := c.fromGo(value.Field(i))
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", name, err)
+			}
+			key := &String{Value: name}
+			pairs[key.HashKey()] = HashPair{Key: key, Value: val}
+		}
+		return &Hash{Pairs: pairs}, nil
+	}
+	return nil, fmt.Errorf("unsupported Go type %s", value.Type())
+}
+
+// ToGo 将对象转换为 Go 值。
+// INTEGER 转换为 int64，BOOLEAN 转换为 bool，STRING 转换为 string，NULL 转换为 nil，
+// ARRAY 转换为 []any。HASH 的键全部是字符串时转换为 map[string]any，否则转换为 map[any]any。
+// 函数、错误等对象没有对应的 Go 值，会返回错误。
+func ToGo(obj Object) (any, error) {
+	switch objActual := obj.(type) {
+	case nil, *Null:
+		return nil, nil
+	case *Integer:
+		return objActual.Value, nil
+	case *Boolean:
+		return objActual.Value, nil
+	case *String:
+		return objActual.Value, nil
+	case *Array:
+		elements := make([]any, len(objActual.Elements))
+		for i, e := range objActual.Elements {
+			element, err := ToGo(e)
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			elements[i] = element
+		}
+		return elements, nil
+	case *Hash:
+		stringKeys := true
+		for _, pair := range objActual.Pairs {
+			if pair.Key.Type() != STRING_OBJ {
+				stringKeys = false
+				break
+			}
+		}
+		if stringKeys {
+			m := make(map[string]any, len(objActual.Pairs))
+			for _, pair := range objActual.Pairs {
+				val, err := ToGo(pair.Value)
+				if err != nil {
+					return nil, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+				}
+				m[pair.Key.(*String).Value] = val
+			}
+			return m, nil
+		}
+		m := make(map[any]any, len(objActual.Pairs))
+		for _, pair := range objActual.Pairs {
+			key, err := ToGo(pair.Key)
+			if err != nil {
+				return nil, err
+			}
+			val, err := ToGo(pair.Value)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			m[key] = val
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("cannot convert %s to a Go value", obj.Type())
+}
+
+// ToGoType 将对象转换为指定类型的 Go 值。
+// 除了 ToGo 支持的转换之外，还可以转换为具体的整型、slice、map、struct 和指针类型。
+// 目标类型是 Object 或者对象本身的类型时，对象原样返回。
+func ToGoType(obj Object, t reflect.Type) (reflect.Value, error) {
+	if obj == nil {
+		obj = NULL
+	}
+	if t.Kind() != reflect.Interface || t.NumMethod() != 0 {
+		if reflect.TypeOf(obj).AssignableTo(t) {
+			return reflect.ValueOf(obj).Convert(t), nil
+		}
+	}
+	mismatch := func() (reflect.Value, error) {
+		return reflect.Value{}, fmt.Errorf("cannot use %s as %s", obj.Type(), t)
+	}
+	value := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		integer, ok := obj.(*Integer)
+		if !ok {
+			return mismatch()
+		}
+		if value.OverflowInt(integer.Value) {
+			return reflect.Value{}, fmt.Errorf("%d overflows %s", integer.Value, t)
+		}
+		value.SetInt(integer.Value)
+		return value, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		integer, ok := obj.(*Integer)
+		if !ok {
+			return mismatch()
+		}
+		if integer.Value < 0 || value.OverflowUint(uint64(integer.Value)) {
+			return reflect.Value{}, fmt.Errorf("%d overflows %s", integer.Value, t)
+		}
+		value.SetUint(uint64(integer.Value))
+		return value, nil
+	case reflect.Bool:
+		boolean, ok := obj.(*Boolean)
+		if !ok {
+			return mismatch()
+		}
+		value.SetBool(boolean.Value)
+		return value, nil
+	case reflect.String:
+		str, ok := obj.(*String)
+		if !ok {
+			return mismatch()
+		}
+		value.SetString(str.Value)
+		return value, nil
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			return mismatch()
+		}
+		native, err := ToGo(obj)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if native != nil {
+			value.Set(reflect.ValueOf(native))
+		}
+		return value, nil
+	case reflect.Pointer:
+		if obj.Type() == NULL_OBJ {
+			return value, nil
+		}
+		elem, err := ToGoType(obj, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(elem)
+		return ptr, nil
+	case reflect.Slice:
+		if obj.Type() == NULL_OBJ {
+			return value, nil
+		}
+		array, ok := obj.(*Array)
+		if !ok {
+			return mismatch()
+		}
+		value = reflect.MakeSlice(t, len(array.Elements), len(array.Elements))
+		for i, e := range array.Elements {
+			elem, err := ToGoType(e, t.Elem())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("index %d: %w", i, err)
+			}
+			value.Index(i).Set(elem)
+		}
+		return value, nil
+	case reflect.Map:
+		if obj.Type() == NULL_OBJ {
+			return value, nil
+		}
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return mismatch()
+		}
+		value = reflect.MakeMapWithSize(t, len(hash.Pairs))
+		for _, pair := range hash.Pairs {
+			key, err := ToGoType(pair.Key, t.Key())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			val, err := ToGoType(pair.Value, t.Elem())
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			value.SetMapIndex(key, val)
+		}
+		return value, nil
+	case reflect.Struct:
+		hash, ok := obj.(*Hash)
+		if !ok {
+			return mismatch()
+		}
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := structFieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+			pair, ok := hash.Pairs[(&String{Value: name}).HashKey()]
+			if !ok {
+				continue
+			}
+			field, err := ToGoType(pair.Value, t.Field(i).Type)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("field %s: %w", name, err)
+			}
+			value.Field(i).Set(field)
+		}
+		return value, nil
+	}
+	return reflect.Value{}, fmt.Errorf("unsupported Go type %s", t)
+}
+
+// structFieldName 查询结构体字段在 Hash 中对应的键。
+// 未导出的字段和 tag 为 "-" 的字段会被忽略。
+func structFieldName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+	tag := field.Tag.Get(StructTag)
+	if tag == "-" {
+		return "", false
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name, true
+	}
+	return field.Name, true
+}
+
+// isNilValue 判断可以为 nil 的 reflect.Value 是否为 nil
+func isNilValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return value.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package object
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testPoint struct {
+	X      int `muskmelon:"x"`
+	Y      int `muskmelon:"y"`
+	Label  string
+	Secret string `muskmelon:"-"`
+	hidden int
+}
+
+func TestFromGo(t *testing.T) {
+	tests := []struct {
+		input    any
+		expected string
+	}{
+		{nil, "null"},
+		{42, "42"},
+		{uint8(7), "7"},
+		{true, "true"},
+		{"hello", "hello"},
+		{[]int{1, 2, 3}, "[1, 2, 3]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{map[string]int{"b": 2, "a": 1}, "{a: 1, b: 2}"},
+		{testPoint{X: 1, Y: 2, Label: "p", Secret: "s", hidden: 3}, "{Label: p, x: 1, y: 2}"},
+		{&testPoint{X: 1}, "{Label: , x: 1, y: 0}"},
+		{(*testPoint)(nil), "null"},
+		{[]any{1, "a", nil, []bool{true}}, "[1, a, null, [true]]"},
+		{&String{Value: "obj"}, "obj"},
+	}
+	for _, tt := range tests {
+		obj, err := FromGo(tt.input)
+		if err != nil {
+			t.Errorf("FromGo(%#v) returned error: %s", tt.input, err)
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("FromGo(%#v) wrong. got=%q, want=%q", tt.input, obj.Inspect(), tt.expected)
+		}
+	}
+	if obj, _ := FromGo(true); obj != TRUE {
+		t.Errorf("FromGo(true) is not the TRUE singleton")
+	}
+}
+
+func TestFromGoUnsupported(t *testing.T) {
+	tests := []any{
+		func() {},
+		make(chan int),
+		1.5,
+		[]any{func() {}},
+		map[string]any{"f": make(chan int)},
+		struct{ F func() }{},
+	}
+	for _, input := range tests {
+		if _, err := FromGo(input); err == nil {
+			t.Errorf("FromGo(%T) expected error", input)
+		}
+	}
+}
+
+// node 可以引用自身的链表节点
+type node struct {
+	Value int
+	Next  *node
+}
+
+func TestFromGoCycle(t *testing.T) {
+	loop := &node{Value: 1}
+	loop.Next = &node{Value: 2, Next: loop}
+	hash := map[string]any{}
+	hash["self"] = hash
+	slice := []any{nil}
+	slice[0] = slice
+	tests := []struct {
+		input    any
+		expected string
+	}{
+		{loop, "field Next: field Next: cycle detected at *object.node"},
+		{hash, "map value self: cycle detected at map[string]interface {}"},
+		{slice, "index 0: cycle detected at []interface {}"},
+	}
+	for _, tt := range tests {
+		if _, err := FromGo(tt.input); err == nil || err.Error() != tt.expected {
+			t.Errorf("FromGo(%T) expected error %q, got %v", tt.input, tt.expected, err)
+		}
+	}
+	// 多次引用同一个值但没有形成环时可以转换
+	shared := &node{Value: 3}
+	obj, err := FromGo([]*node{shared, shared})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Inspect() != "[{Next: null, Value: 3}, {Next: null, Value: 3}]" {
+		t.Errorf("shared pointers wrong. got=%q", obj.Inspect())
+	}
+}
+
+func TestToGo(t *testing.T) {
+	hash, err := FromGo(map[string]any{"name": "monkey", "tags": []string{"a"}})
+	if err != nil {
+		t.Fatalf("FromGo failed: %s", err)
+	}
+	tests := []struct {
+		input    Object
+		expected any
+	}{
+		{NULL, nil},
+		{&Integer{Value: 5}, int64(5)},
+		{FALSE, false},
+		{&String{Value: "s"}, "s"},
+		{&Array{Elements: []Object{&Integer{Value: 1}, NULL}}, []any{int64(1), nil}},
+		{hash, map[string]any{"name": "monkey", "tags": []any{"a"}}},
+	}
+	for _, tt := range tests {
+		got, err := ToGo(tt.input)
+		if err != nil {
+			t.Errorf("ToGo(%s) returned error: %s", tt.input.Inspect(), err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("ToGo(%s) wrong. got=%#v, want=%#v", tt.input.Inspect(), got, tt.expected)
+		}
+	}
+	if _, err := ToGo(&Function{}); err == nil {
+		t.Errorf("ToGo(FUNCTION) expected error")
+	}
+}
+
+func TestToGoTypeRoundTrip(t *testing.T) {
+	point := testPoint{X: 3, Y: 4, Label: "corner"}
+	obj, err := FromGo(point)
+	if err != nil {
+		t.Fatalf("FromGo failed: %s", err)
+	}
+	value, err := ToGoType(obj, reflect.TypeOf(testPoint{}))
+	if err != nil {
+		t.Fatalf("ToGoType failed: %s", err)
+	}
+	if got := value.Interface().(testPoint); got != point {
+		t.Errorf("round trip wrong. got=%+v, want=%+v", got, point)
+	}
+	if _, err := ToGoType(&String{Value: "x"}, reflect.TypeOf(0)); err == nil {
+		t.Errorf("ToGoType(STRING, int) expected error")
+	}
+}
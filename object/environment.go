@@ -1,5 +1,7 @@
 package object
 
+import "sort"
+
 // NewEnclosedEnvironment 创建闭包
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
@@ -33,3 +35,18 @@ func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
+
+// Names 返回当前作用域中绑定的名字，按字典序排序，不包含外层作用域
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Outer 返回外层作用域，最外层的 Environment 返回 nil
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/token"
+	"hash/fnv"
+	"sort"
 	"strings"
 )
 
@@ -11,6 +14,9 @@ type ObjectType string
 
 type BuiltinFunction func(args ...Object) Object
 
+// ApplyFunction 调用函数对象，返回函数的返回值
+type ApplyFunction func(fn Object, args ...Object) Object
+
 const (
 	// INTEGER_OBJ 整型类型
 	INTEGER_OBJ = "INTEGER"
@@ -25,6 +31,16 @@ const (
 	FUNCTION_OBJ = "FUNCTION"
 	STRING_OBJ   = "STRING"
 	BUILTIN_OBJ  = "BUILTIN"
+	ARRAY_OBJ    = "ARRAY"
+	HASH_OBJ     = "HASH"
+	MODULE_OBJ   = "MODULE"
+)
+
+// NULL、TRUE 和 FALSE 是全局唯一的对象，evaluator 依赖它们的指针相等性
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
 )
 
 // Object 所有的对象的父类型
@@ -71,6 +87,8 @@ func (r *ReturnValue) Inspect() string {
 
 type Error struct {
 	Message string
+	// Pos 产生错误的调用表达式的位置，没有位置信息时为零值
+	Pos token.Position
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
@@ -78,21 +96,35 @@ func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
 type Function struct {
 	Parameters []*ast.Identifier
+	// ParameterTypes 参数的类型标注，没有任何标注时为 nil
+	ParameterTypes []*ast.TypeAnnotation
+	// ReturnType 返回值的类型标注，没有标注时为 nil
+	ReturnType *ast.TypeAnnotation
 	Body       *ast.BlockStatement
 	Env        *Environment
+	// File 定义函数的文件，用于调试器显示函数的帧的位置
+	File string
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 	var params []string
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
+	for i, p := range f.Parameters {
+		param := p.String()
+		if i < len(f.ParameterTypes) && f.ParameterTypes[i] != nil {
+			param += ": " + f.ParameterTypes[i].String()
+		}
+		params = append(params, param)
 	}
 	out.WriteString("fn")
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") {\n")
+	out.WriteString(")")
+	if f.ReturnType != nil {
+		out.WriteString(": " + f.ReturnType.String())
+	}
+	out.WriteString(" {\n")
 	out.WriteString(f.Body.String())
 	out.WriteString("\n}")
 	return out.String()
@@ -109,9 +141,94 @@ func (s *String) Inspect() string  { return s.Value }
 
 type Builtin struct {
 	Fn BuiltinFunction
+	// HigherOrder 不为 nil 时代替 Fn 调用，可以通过 apply 调用作为参数传入的函数
+	HigherOrder func(apply ApplyFunction, args ...Object) Object
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 
 // Inspect 内置函数无法打印详细内容
 func (b *Builtin) Inspect() string { return "builtin function" }
+
+// Array 数组类型对象
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	var out bytes.Buffer
+	var elements []string
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+	return out.String()
+}
+
+// HashKey 可以作为 Hash 键的对象的摘要
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Hashable 可以作为 Hash 键的对象
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+// HashPair Hash 中保存的键值对，保留原始的键用于打印
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash 哈希表类型对象
+type Hash struct {
+	Pairs map[HashKey]HashPair
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+	var pairs []string
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
+	}
+	// map 的遍历顺序不固定，排序后输出保证结果稳定
+	sort.Strings(pairs)
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+// Module import 得到的模块，Exports 是模块中 export 的绑定
+type Module struct {
+	// Name import 时使用的路径
+	Name    string
+	Exports map[string]Object
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return fmt.Sprintf("module %q", m.Name) }
@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"flag"
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/lexer"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// TestJSONGolden 将 testdata 中每个 .mk 文件的 AST 与同名的 .json 文件比较。
+// 修改 AST 后使用 go test -update 重新生成。
+func TestJSONGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.mk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := New(lexer.New(string(src)))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		data, err := ast.EncodeJSON(program)
+		if err != nil {
+			t.Fatalf("%s: EncodeJSON error: %s", file, err)
+		}
+		golden := strings.TrimSuffix(file, ".mk") + ".json"
+		if *update {
+			if err := os.WriteFile(golden, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		expected, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != string(expected) {
+			t.Errorf("%s: JSON differs from %s.\ngot=%s", file, golden, data)
+		}
+		decoded, err := ast.DecodeJSON(expected)
+		if err != nil {
+			t.Fatalf("%s: DecodeJSON error: %s", golden, err)
+		}
+		if !reflect.DeepEqual(decoded, program) {
+			t.Errorf("%s: decoded AST differs.\ngot=%s\nwant=%s", golden, ast.Dump(decoded), ast.Dump(program))
+		}
+	}
+}
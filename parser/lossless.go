@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/cst"
+	"github.com/hollykbuck/muskmelon/lexer"
+	"reflect"
+)
+
+// syntaxBuilder 在解析的同时记录 token 和节点覆盖的 token 范围，用于构建 cst
+type syntaxBuilder struct {
+	src string
+	// tokens 从 lexer 读到的所有 token，最后一个是 peekToken
+	tokens []*cst.Token
+	// end 上一个 token 结束位置的偏移
+	end int
+	// pending 已经解析完但还没有挂到父节点下的节点，按结束的顺序排列
+	pending []pendingNode
+	root    *cst.Node
+}
+
+type pendingNode struct {
+	node       *cst.Node
+	start, end int
+}
+
+// NewLossless 创建同时构建 cst 的 Parser。
+// 调用 ParseProgram 之后可以通过 SyntaxTree 取得语法树。
+func NewLossless(l *lexer.Lexer) *Parser {
+	p := &Parser{l: l, syntax: &syntaxBuilder{src: l.Input()}}
+	return p.init()
+}
+
+// SyntaxTree 返回 ParseProgram 构建的语法树。
+// 即使源码有语法错误，打印语法树也能还原源码。Parser 不是由 NewLossless 创建时返回 nil。
+func (p *Parser) SyntaxTree() *cst.Node {
+	if p.syntax == nil {
+		return nil
+	}
+	return p.syntax.root
+}
+
+// record 记录 lexer 读到的 token 和它前面的空白
+func (b *syntaxBuilder) record(tok *cst.Token, end int) {
+	// 输入结束之后 lexer 会继续返回 EOF，它们的位置可能超出源码的末尾
+	start := tok.Pos.Offset
+	if start > len(b.src) {
+		start = len(b.src)
+	}
+	tok.Leading = cst.SplitTrivia(b.src[b.end:start])
+	tok.Text = b.src[start:end]
+	b.end = end
+	b.tokens = append(b.tokens, tok)
+}
+
+// mark 返回 curToken 的下标，作为节点的起点
+func (p *Parser) mark() int {
+	if p.syntax == nil {
+		return 0
+	}
+	return len(p.syntax.tokens) - 2
+}
+
+// finish 结束一个从 start 到 curToken 的节点，之前结束的范围内的节点成为它的子节点。
+// 解析失败的节点不会被记录，它的子节点留给外层的节点。
+func (p *Parser) finish(node ast.Node, start int) {
+	if p.syntax == nil || node == nil || reflect.ValueOf(node).IsNil() {
+		return
+	}
+	b := p.syntax
+	end := len(b.tokens) - 2
+	i := len(b.pending)
+	for i > 0 && b.pending[i-1].start >= start {
+		i--
+	}
+	children := b.pending[i:]
+	n := &cst.Node{AST: node}
+	for index := start; index <= end; {
+		if len(children) > 0 && children[0].start == index {
+			child := children[0]
+			if child.node.AST == node {
+				// 括号表达式和它里面的表达式是同一个 AST 节点，合并为一个节点
+				n.Children = append(n.Children, child.node.Children...)
+			} else {
+				n.Children = append(n.Children, child.node)
+			}
+			index = child.end + 1
+			children = children[1:]
+			continue
+		}
+		n.Children = append(n.Children, b.tokens[index])
+		index++
+	}
+	b.pending = append(b.pending[:i], pendingNode{node: n, start: start, end: end})
+	if _, ok := node.(*ast.Program); ok {
+		b.root = n
+	}
+}
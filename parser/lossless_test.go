@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/cst"
+	"github.com/hollykbuck/muskmelon/lexer"
+	"testing"
+)
+
+func parseLossless(t *testing.T, input string) (*ast.Program, *cst.Node) {
+	p := NewLossless(lexer.New(input))
+	program := p.ParseProgram()
+	tree := p.SyntaxTree()
+	if tree == nil {
+		t.Fatalf("SyntaxTree() returned nil for %q", input)
+	}
+	if tree.AST != program {
+		t.Fatalf("root of syntax tree is not the program")
+	}
+	return program, tree
+}
+
+func TestLosslessRoundTrip(t *testing.T) {
+	tests := []string{
+		"",
+		"   \n\n",
+		"let x = 5;",
+		"let  add =fn(a,  b){ a+b } ;\n\n// done\n",
+		"// header\r\nlet s = \"héllo // not a comment\";\r\n",
+		"if ((1 + 2) * 3 > x) { puts(\"a\") } else {\n\t[1, 2][0] // trailing\n}",
+		"return;\n",
+		"let = 5; @ ) \"unterminated",
+		"fn(x { x",
+		"#!/usr/bin/env muskmelon\nputs(1)\n",
+	}
+	for _, input := range tests {
+		_, tree := parseLossless(t, input)
+		if got := tree.String(); got != input {
+			t.Errorf("round trip wrong.\ngot=%q\nwant=%q", got, input)
+		}
+	}
+}
+
+func TestLosslessStructure(t *testing.T) {
+	input := "let x = (1 + 2) * y; // note\n"
+	program, tree := parseLossless(t, input)
+	let := program.Statements[0].(*ast.LetStatement)
+	statement := tree.Find(func(n *cst.Node) bool { return n.AST == let })
+	if statement == nil {
+		t.Fatalf("no syntax node for the let statement")
+	}
+	if statement.Source() != "let x = (1 + 2) * y;" {
+		t.Errorf("let statement source wrong. got=%q", statement.Source())
+	}
+	sum := let.Value.(*ast.InfixExpression).Left
+	grouped := tree.Find(func(n *cst.Node) bool { return n.AST == sum })
+	if grouped == nil || grouped.Source() != " (1 + 2)" {
+		t.Fatalf("grouped expression source wrong. got=%v", grouped)
+	}
+	name := tree.Find(func(n *cst.Node) bool { return n.AST == let.Name })
+	if name == nil || name.Source() != " x" {
+		t.Errorf("let name source wrong. got=%v", name)
+	}
+	tokens := tree.Tokens()
+	eof := tokens[len(tokens)-1]
+	if len(eof.Leading) != 3 || eof.Leading[1].Kind != cst.Comment || eof.Leading[1].Text != "// note" {
+		t.Errorf("trailing trivia wrong. got=%+v", eof.Leading)
+	}
+}
+
+func TestLosslessEdit(t *testing.T) {
+	_, tree := parseLossless(t, "let  x=1 ;\nputs( x ) // print\n")
+	for _, tok := range tree.Tokens() {
+		if tok.Text == "x" {
+			tok.Text = "count"
+		}
+	}
+	expected := "let  count=1 ;\nputs( count ) // print\n"
+	if got := tree.String(); got != expected {
+		t.Errorf("edited source wrong.\ngot=%q\nwant=%q", got, expected)
+	}
+}
+
+func TestSyntaxTreeDisabled(t *testing.T) {
+	p := New(lexer.New("let x = 1;"))
+	p.ParseProgram()
+	if p.SyntaxTree() != nil {
+		t.Errorf("SyntaxTree() should be nil without NewLossless")
+	}
+}
@@ -3,8 +3,10 @@ package parser
 import (
 	"fmt"
 	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/cst"
 	"github.com/hollykbuck/muskmelon/lexer"
 	"github.com/hollykbuck/muskmelon/token"
+	"github.com/hollykbuck/muskmelon/trace"
 	"strconv"
 )
 
@@ -40,9 +42,20 @@ type Parser struct {
 	curToken  token.Token
 	peekToken token.Token
 	// errors 不记录 error 只记录报错信息（字符串）
-	errors         []string
+	errors []string
+	// positions 每条报错信息对应的位置
+	positions      []token.Position
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+	// syntax 不为 nil 时同时构建 cst
+	syntax *syntaxBuilder
+	// tracer 不为 nil 时在解析规则的开始和结束发送事件
+	tracer     trace.Tracer
+	traceDepth int
+	// tracedErrors 已经在事件中报告过的错误个数
+	tracedErrors int
+	// blockDepth 当前所在的块的层数，export 只能出现在顶层
+	blockDepth int
 }
 
 type (
@@ -52,7 +65,13 @@ type (
 
 // New 初始化 Parser 结构
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l}
+	return p.init()
+}
+
+// init 注册解析函数并读入前两个 token
+func (p *Parser) init() *Parser {
+	p.errors = []string{}
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	// Identifier 和 Integer 是终止符。
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
@@ -67,6 +86,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
+	p.registerPrefix(token.IMPORT, p.parseImportExpression)
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	// 中缀表达式没有一个是终结符
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -100,10 +120,14 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	if p.syntax != nil {
+		p.syntax.record(&cst.Token{Token: p.peekToken}, p.l.Offset())
+	}
 }
 
 // ParseProgram 在该函数中实现 parser 的主要逻辑
 func (p *Parser) ParseProgram() *ast.Program {
+	rule := p.trace("ParseProgram")
 	// 创建一个 Program 结构体
 	program := &ast.Program{}
 	// Program 的孩子指向一个 Statement 数组
@@ -116,16 +140,37 @@ func (p *Parser) ParseProgram() *ast.Program {
 		}
 		p.nextToken()
 	}
+	p.finish(program, 0)
+	p.untrace(rule, program)
 	return program
 }
 
 // parseStatement 解析 Statement
 func (p *Parser) parseStatement() ast.Statement {
+	rule := p.trace("parseStatement")
+	start := p.mark()
+	statement := p.parseStatementKind()
+	p.finish(statement, start)
+	p.untrace(rule, statement)
+	return statement
+}
+
+// parseStatementKind 根据第一个 token 选择语句的解析函数
+func (p *Parser) parseStatementKind() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
 		// 以 Let Token 为开头的 statement 是 let statement
 		// 委托给 parseLetStatement 执行解析任务
-		return p.parseLetStatement()
+		// 解析失败时返回 nil 接口，而不是包含 nil 指针的接口
+		if statement := p.parseLetStatement(); statement != nil {
+			return statement
+		}
+		return nil
+	case token.EXPORT:
+		if statement := p.parseExportStatement(); statement != nil {
+			return statement
+		}
+		return nil
 	case token.RETURN:
 		return p.parseReturnStatement()
 	default:
@@ -148,6 +193,15 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		Token: p.curToken,
 		Value: p.curToken.Literal,
 	}
+	p.finish(statement.Name, p.mark())
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		p.nextToken()
+		statement.Type = p.parseTypeAnnotation()
+		if statement.Type == nil {
+			return nil
+		}
+	}
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
@@ -159,6 +213,23 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return statement
 }
 
+// parseExportStatement 解析 export let statement，只允许出现在顶层。
+// 返回 nil 表示解析失败。
+func (p *Parser) parseExportStatement() *ast.LetStatement {
+	if p.blockDepth > 0 {
+		p.errorf(p.curToken.Pos, "export is only allowed at top level")
+	}
+	if !p.expectPeek(token.LET) {
+		return nil
+	}
+	statement := p.parseLetStatement()
+	if statement == nil {
+		return nil
+	}
+	statement.Exported = true
+	return statement
+}
+
 // expectPeek 检查下一个 token 是不是指定的类型。
 // 如果是，让 curToken 指向下一个 token。
 // 如果不是，在 Parser 上记录一个错误。
@@ -190,10 +261,34 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// Error 带有位置的语法错误
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e Error) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
+// ErrorList 返回带有位置的语法错误，顺序与 Errors 相同
+func (p *Parser) ErrorList() []Error {
+	list := make([]Error, len(p.errors))
+	for i, msg := range p.errors {
+		list[i] = Error{Pos: p.positions[i], Msg: msg}
+	}
+	return list
+}
+
+// errorf 在 pos 处记录一个错误
+func (p *Parser) errorf(pos token.Position, format string, args ...interface{}) {
+	p.errors = append(p.errors, fmt.Sprintf(format, args...))
+	p.positions = append(p.positions, pos)
+}
+
 // peekError 添加一个 token 错误到 parser 的错误列表中
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expectedBool next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.errorf(p.peekToken.Pos, "expectedBool next token to be %s, got %s instead", t, p.peekToken.Type)
 }
 
 // parseReturnStatement 解析 return statement
@@ -221,10 +316,9 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 
 // parseExpressionStatement 解析表达式语句
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
-	stmt := &ast.ExpressionStatement{
-		Token:      p.curToken,
-		Expression: p.parseExpression(LOWEST),
-	}
+	// 先记录第一个 token，再解析表达式
+	stmt := &ast.ExpressionStatement{Token: p.curToken}
+	stmt.Expression = p.parseExpression(LOWEST)
 	// statement 的末尾可以是 semicolon，也可以不是
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
@@ -235,14 +329,17 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 // parseExpression 解析表达式。
 // 根据表达式开头的 token 寻找对应的解析函数。
 // 如果查不到 prefix 对应的解析函数会记录错误。
-func (p *Parser) parseExpression(precedence int) ast.Expression {
+func (p *Parser) parseExpression(precedence int) (leftExp ast.Expression) {
+	defer func(rule string) { p.untrace(rule, leftExp) }(p.trace("parseExpression"))
 	// 查找和当前 token 对应的前缀表达式解析
 	prefix, ok := p.prefixParseFns[p.curToken.Type]
 	if !ok {
 		p.noPrefixParseFnError(p.curToken.Type)
 		return nil
 	}
-	leftExp := prefix()
+	start := p.mark()
+	leftExp = prefix()
+	p.finish(leftExp, start)
 	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infix, ok := p.infixParseFns[p.peekToken.Type]
 		if !ok {
@@ -250,6 +347,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		}
 		p.nextToken()
 		leftExp = infix(leftExp)
+		p.finish(leftExp, start)
 	}
 	return leftExp
 }
@@ -270,8 +368,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	parseInt, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	// 如果出错，将错误添加到 parser 的错误列表中
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorf(p.curToken.Pos, "could not parse %q as integer", p.curToken.Literal)
 		return nil
 	}
 	// 将 value 设定为解析出的数字
@@ -293,8 +390,7 @@ func (p *Parser) parseBoolean() ast.Expression {
 
 // noPrefixParseFnError 记录找不到 prefix 对应的解析函数错误
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.errorf(p.curToken.Pos, "no prefix parse function for %s found", t)
 }
 
 // parsePrefixExpression 递归解析前缀表达式
@@ -320,6 +416,14 @@ func (p *Parser) peekPrecedence() int {
 	return LOWEST
 }
 
+// Precedence 查询中缀运算符 token 的优先级，不是中缀运算符时返回 LOWEST
+func Precedence(tokenType token.TokenType) int {
+	if precedence, ok := precedences[tokenType]; ok {
+		return precedence
+	}
+	return LOWEST
+}
+
 // curPrecedence 查询 curToken 的优先级
 func (p *Parser) curPrecedence() int {
 	if p, ok := precedences[p.curToken.Type]; ok {
@@ -376,8 +480,12 @@ func (p *Parser) parseIfExpression() ast.Expression {
 
 // parseBlockStatement 解析块级表达式
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	rule := p.trace("parseBlockStatement")
+	start := p.mark()
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
+	p.blockDepth++
+	defer func() { p.blockDepth-- }()
 	p.nextToken()
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
 		statement := p.parseStatement()
@@ -386,7 +494,8 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.nextToken()
 	}
-
+	p.finish(block, start)
+	p.untrace(rule, block)
 	return block
 }
 
@@ -395,7 +504,15 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
-	lit.Parameters = p.parseFunctionParameters()
+	lit.Parameters, lit.ParameterTypes = p.parseFunctionParameters()
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		p.nextToken()
+		lit.ReturnType = p.parseTypeAnnotation()
+		if lit.ReturnType == nil {
+			return nil
+		}
+	}
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
@@ -404,26 +521,79 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() (identifiers []*ast.Identifier) {
+// parseFunctionParameters 解析参数列表。
+// 没有任何参数带类型标注时 annotations 为 nil，否则与 identifiers 一一对应。
+func (p *Parser) parseFunctionParameters() (identifiers []*ast.Identifier, annotations []*ast.TypeAnnotation) {
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
 		return
 	}
-	p.nextToken()
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
-	for p.peekTokenIs(token.COMMA) {
-		p.nextToken()
+	annotated := false
+	for {
 		p.nextToken()
 		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		p.finish(ident, p.mark())
 		identifiers = append(identifiers, ident)
+		var annotation *ast.TypeAnnotation
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			p.nextToken()
+			if annotation = p.parseTypeAnnotation(); annotation == nil {
+				return nil, nil
+			}
+			annotated = true
+		}
+		annotations = append(annotations, annotation)
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+	if !annotated {
+		annotations = nil
 	}
 	if !p.expectPeek(token.RPAREN) {
-		return nil
+		return nil, nil
 	}
 	return
 }
 
+// typeNames 类型标注中可以使用的类型名
+var typeNames = map[string]bool{
+	"int":    true,
+	"string": true,
+	"bool":   true,
+	"null":   true,
+	"array":  true,
+	"hash":   true,
+	"fn":     true,
+	"any":    true,
+}
+
+// parseTypeAnnotation 解析类型标注，curToken 是类型的第一个 token。
+// 类型是 typeNames 中的名字，或者写成 [T] 的数组类型。返回 nil 表示解析失败。
+func (p *Parser) parseTypeAnnotation() *ast.TypeAnnotation {
+	start := p.mark()
+	annotation := &ast.TypeAnnotation{Token: p.curToken, Name: p.curToken.Literal}
+	switch {
+	case p.curTokenIs(token.LBRACKET):
+		p.nextToken()
+		annotation.Name = "array"
+		if annotation.Elem = p.parseTypeAnnotation(); annotation.Elem == nil {
+			return nil
+		}
+		if !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+	case (p.curTokenIs(token.IDENT) || p.curTokenIs(token.FUNCTION)) && typeNames[p.curToken.Literal]:
+	default:
+		p.errorf(p.curToken.Pos, "unknown type %q", p.curToken.Literal)
+		return nil
+	}
+	p.finish(annotation, start)
+	return annotation
+}
+
 func (p *Parser) parseCallExpression(expression ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: expression}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
@@ -453,6 +623,17 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// parseImportExpression 解析 import "path"，路径必须是字符串字面量
+func (p *Parser) parseImportExpression() ast.Expression {
+	expression := &ast.ImportExpression{Token: p.curToken}
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	expression.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	p.finish(expression.Path, p.mark())
+	return expression
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 	array.Elements = p.parseExpressionList(token.RBRACKET)
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"github.com/hollykbuck/muskmelon/ast"
 	"github.com/hollykbuck/muskmelon/lexer"
+	"github.com/hollykbuck/muskmelon/trace"
+	"reflect"
 	"testing"
 )
 
@@ -666,6 +668,52 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestTypeAnnotationParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: int = 5;", "let x: int = 5;"},
+		{"let xs: [[string]] = [];", "let xs: [[string]] = [];"},
+		{"let f: fn = fn(a: string, b): bool { a };", "let f: fn = fn(a: string,b) : bool a;"},
+		{"fn(a, b) { a }", "fn(a,b) a"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("program.String() wrong. got=%q, want=%q", got, tt.expected)
+		}
+	}
+
+	p := New(lexer.New("fn(a, b: int) { a }"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(function.ParameterTypes) != 2 || function.ParameterTypes[0] != nil || function.ParameterTypes[1].Name != "int" {
+		t.Errorf("parameter types wrong. got=%v", function.ParameterTypes)
+	}
+}
+
+func TestTypeAnnotationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: number = 1;", `unknown type "number"`},
+		{"let x: [int = 1;", "expectedBool next token to be ], got = instead"},
+		{"fn(a: ) {}", `unknown type ")"`},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("parser errors for %q wrong. got=%q, want=%q", tt.input, p.Errors(), tt.expected)
+		}
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 	l := lexer.New(input)
@@ -752,3 +800,118 @@ func TestParsingIndexExpressions(t *testing.T) {
 		return
 	}
 }
+
+func TestImportExport(t *testing.T) {
+	input := `export let answer = 42;
+let math = import "lib/math";`
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	export, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok || !export.Exported || export.Name.Value != "answer" {
+		t.Fatalf("statement 0 is not an exported let. got=%s", program.Statements[0])
+	}
+	let, ok := program.Statements[1].(*ast.LetStatement)
+	if !ok || let.Exported {
+		t.Fatalf("statement 1 is not a plain let. got=%s", program.Statements[1])
+	}
+	importExp, ok := let.Value.(*ast.ImportExpression)
+	if !ok {
+		t.Fatalf("let value not *ast.ImportExpression. got=%T", let.Value)
+	}
+	if importExp.Path.Value != "lib/math" {
+		t.Errorf("import path wrong. got=%q", importExp.Path.Value)
+	}
+	if got := program.String(); got != `export let answer = 42;let math = import "lib/math";` {
+		t.Errorf("program.String() wrong. got=%q", got)
+	}
+}
+
+func TestImportExportErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"import math", "expectedBool next token to be STRING, got IDENT instead"},
+		{"export fn() {}", "expectedBool next token to be LET, got FUNCTION instead"},
+		{"fn() { export let x = 1; }", "export is only allowed at top level"},
+		{"if (true) { export let x = 1; }", "export is only allowed at top level"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("parser errors for %q wrong. got=%q, want=%q", tt.input, p.Errors(), tt.expected)
+		}
+	}
+}
+
+func TestErrorList(t *testing.T) {
+	p := New(lexer.New("let x = 1;\nlet = 2;\nlet y: foo = 3;"))
+	p.ParseProgram()
+	list := p.ErrorList()
+	if len(list) != len(p.Errors()) {
+		t.Fatalf("ErrorList has %d errors, Errors has %d", len(list), len(p.Errors()))
+	}
+	expected := []string{
+		"2:5: expectedBool next token to be IDENT, got = instead",
+		"2:5: no prefix parse function for = found",
+		"3:8: unknown type \"foo\"",
+	}
+	for i, want := range expected {
+		if i >= len(list) {
+			t.Fatalf("missing error %q", want)
+		}
+		if got := list[i].Error(); got != want {
+			t.Errorf("error %d wrong. got=%q, want=%q", i, got, want)
+		}
+	}
+}
+
+func TestTracer(t *testing.T) {
+	recorder := &trace.Recorder{}
+	p := New(lexer.New("let x = -1;\nlet = 2"))
+	p.SetTracer(recorder)
+	program := p.ParseProgram()
+	// 解析失败的 let 语句不会留下 nil 指针
+	if len(program.Statements) != 3 || program.String() != "let x = (-1);2" {
+		t.Errorf("program wrong: %d statements", len(program.Statements))
+	}
+	var got []string
+	for _, e := range recorder.Events() {
+		line := fmt.Sprintf("%d %s %s %s", e.Depth, e.Kind, e.Name, e.Pos)
+		if e.Kind == trace.KindExit && e.Node != nil && e.Name != "ParseProgram" {
+			line += " " + e.Node.String()
+		}
+		if e.Err != "" {
+			line += " ! " + e.Err
+		}
+		got = append(got, line)
+	}
+	expected := []string{
+		"0 enter ParseProgram 1:1",
+		"1 enter parseStatement 1:1",
+		"2 enter parseExpression 1:9",
+		"3 enter parseExpression 1:10",
+		"3 exit parseExpression 1:10 1",
+		"2 exit parseExpression 1:9 (-1)",
+		"1 exit parseStatement 1:1 let x = (-1);",
+		"1 enter parseStatement 2:1",
+		"1 exit parseStatement 2:1 ! expectedBool next token to be IDENT, got = instead",
+		"1 enter parseStatement 2:5",
+		"2 enter parseExpression 2:5",
+		"2 exit parseExpression 2:5 ! no prefix parse function for = found",
+		"1 exit parseStatement 2:5 ",
+		"1 enter parseStatement 2:7",
+		"2 enter parseExpression 2:7",
+		"2 exit parseExpression 2:7 2",
+		"1 exit parseStatement 2:7 2",
+		"0 exit ParseProgram 1:1",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("events wrong.\ngot=%q\nwant=%q", got, expected)
+	}
+}
@@ -1,32 +1,57 @@
 package parser
 
 import (
-	"fmt"
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/trace"
+	"reflect"
 	"strings"
 )
 
-var traceLevel int = 0
-
-const traceIdentPlaceholder string = "\t"
-
-func identLevel() string {
-	return strings.Repeat(traceIdentPlaceholder, traceLevel-1)
+// SetTracer 设置解析时使用的 Tracer，nil 表示不跟踪。需要在 ParseProgram 之前调用。
+func (p *Parser) SetTracer(t trace.Tracer) {
+	p.tracer = t
 }
 
-func tracePrint(fs string) {
-	fmt.Printf("%s%s\n", identLevel(), fs)
-}
-
-func incIdent() { traceLevel = traceLevel + 1 }
-func decIdent() { traceLevel = traceLevel - 1 }
-
-func trace(msg string) string {
-	incIdent()
-	tracePrint("BEGIN " + msg)
-	return msg
+// trace 开始解析规则 rule，返回传给 untrace 的规则名
+func (p *Parser) trace(rule string) string {
+	if p.tracer == nil {
+		return rule
+	}
+	p.tracer.Trace(trace.Event{
+		Phase: trace.PhaseParse,
+		Kind:  trace.KindEnter,
+		Name:  rule,
+		Depth: p.traceDepth,
+		Pos:   p.curToken.Pos,
+	})
+	p.traceDepth++
+	return rule
 }
 
-func untrace(msg string) {
-	tracePrint("END " + msg)
-	decIdent()
+// untrace 规则 rule 解析完成，node 是解析出的节点。
+// 解析这条规则时新记录的语法错误放在事件的 Err 中，外层规则不会重复报告。
+func (p *Parser) untrace(rule string, node ast.Node) {
+	if p.tracer == nil {
+		return
+	}
+	p.traceDepth--
+	if node != nil && reflect.ValueOf(node).IsNil() {
+		node = nil
+	}
+	e := trace.Event{
+		Phase: trace.PhaseParse,
+		Kind:  trace.KindExit,
+		Name:  rule,
+		Depth: p.traceDepth,
+		Pos:   trace.NodePos(node),
+		Node:  node,
+	}
+	if !e.Pos.IsValid() {
+		e.Pos = p.curToken.Pos
+	}
+	if len(p.errors) > p.tracedErrors {
+		e.Err = strings.Join(p.errors[p.tracedErrors:], "; ")
+		p.tracedErrors = len(p.errors)
+	}
+	p.tracer.Trace(e)
 }
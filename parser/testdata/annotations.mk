@@ -0,0 +1,2 @@
+let n: int = 1;
+let join = fn(xs: [string], sep): string { xs[0] + sep };
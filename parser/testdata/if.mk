@@ -0,0 +1,5 @@
+if (x < 10) {
+	puts("small")
+} else {
+	!false
+}
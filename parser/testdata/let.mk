@@ -0,0 +1,3 @@
+let add = fn(a, b) { a + b * 2 };
+let xs = [1, "two", true];
+return add(xs[0], -3);
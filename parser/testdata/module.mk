@@ -0,0 +1,2 @@
+let math = import "lib/math";
+export let double = fn(x) { math["add"](x, x) };
@@ -1,31 +1,234 @@
 package main
 
 import (
+	"bufio"
+	"errors"
+	"flag"
 	"fmt"
+	"github.com/hollykbuck/muskmelon/evaluator"
+	"github.com/hollykbuck/muskmelon/object"
 	"github.com/hollykbuck/muskmelon/repl"
+	"github.com/hollykbuck/muskmelon/trace"
+	"io"
 	"log"
 	"os"
 	"os/user"
+	"path/filepath"
 )
 
-func _main() error {
+// 进程退出码
+const (
+	exitOK           = 0
+	exitRuntimeError = 1
+	exitParseError   = 2
+	exitTypeError    = 3
+	exitUsage        = 64
+)
+
+const usage = `usage:
+  muskmelon [-restore file]      启动交互式 REPL（stdin 不是终端时运行 stdin 中的脚本）
+  muskmelon script.mk [args...]  运行脚本文件，"-" 表示 stdin
+  muskmelon -e 'expr' [args...]  运行一行代码并打印结果
+  muskmelon -typecheck ...       运行之前检查类型，发现类型错误时不运行，警告只打印
+  muskmelon -trace file ...      把解析和运行的跟踪事件以 JSON Lines 写入文件，"-" 表示 stderr
+  muskmelon -profile file ...    运行结束后把每个函数和每行的耗时报告写入文件，"-" 表示 stderr
+  muskmelon -pprof file ...      运行结束后写入 pprof 格式的 profile，用 go tool pprof 查看
+  muskmelon -path dirs ...       import 在脚本所在目录中找不到模块时依次查找的目录，用路径列表分隔符（Unix 上是 ":"）分隔
+  muskmelon test [path ...]      运行 *_test.mk 中的测试，参见 muskmelon test -h
+                                 第一个参数 test 总是表示子命令，名为 test 的脚本需要写成 ./test
+`
+
+// scriptOnlyFlags 只在运行脚本时生效的参数，启动 REPL 时使用会报错
+var scriptOnlyFlags = []string{"typecheck", "trace", "profile", "pprof", "path"}
+
+func _main(options repl.Options) error {
 	current, err := user.Current()
 	if err != nil {
 		return fmt.Errorf("获取当前用户失败: %w", err)
 	}
 	fmt.Printf("Hello %s! This is muskmelon programming language!\n", current.Username)
 	fmt.Printf("feel free to type in commands\n")
-	err = repl.Start(os.Stdin, os.Stdout)
+	err = repl.StartWithOptions(os.Stdin, os.Stdout, options)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func main() {
-	err := _main()
+// run 解析命令行参数，按模式运行脚本，返回进程退出码
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer, interactive bool) (code int) {
+	// test 是保留的子命令名，同名的脚本需要带上目录，例如 ./test
+	if len(args) > 0 && args[0] == "test" {
+		return runTests(args[1:], stdout, stderr)
+	}
+	flags := flag.NewFlagSet("muskmelon", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { fmt.Fprint(stderr, usage) }
+	expr := flags.String("e", "", "运行一行代码并打印结果")
+	restore := flags.String("restore", "", "启动 REPL 时从 :save 保存的会话恢复")
+	typecheck := flags.Bool("typecheck", false, "运行之前检查类型")
+	traceFile := flags.String("trace", "", "把跟踪事件写入文件")
+	profileFile := flags.String("profile", "", "把耗时报告写入文件")
+	pprofFile := flags.String("pprof", "", "把 pprof 格式的 profile 写入文件")
+	modulePath := flags.String("path", "", "查找模块的目录列表")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	rest := flags.Args()
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	exprSet := set["e"]
+	var (
+		name       string
+		src        string
+		scriptArgs []string
+		printValue bool
+	)
+	switch {
+	case exprSet:
+		name, src, scriptArgs, printValue = "-e", *expr, rest, true
+	case len(rest) > 0:
+		name, scriptArgs = rest[0], rest[1:]
+		var content []byte
+		var err error
+		if name == "-" {
+			content, err = io.ReadAll(stdin)
+		} else {
+			content, err = os.ReadFile(name)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "读取脚本失败: %s\n", err)
+			return exitUsage
+		}
+		src = string(content)
+	case !interactive:
+		content, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "读取 stdin 失败: %s\n", err)
+			return exitUsage
+		}
+		name, src = "-", string(content)
+	default:
+		for _, f := range scriptOnlyFlags {
+			if set[f] {
+				fmt.Fprintf(stderr, "-%s 只能在运行脚本时使用\n", f)
+				return exitUsage
+			}
+		}
+		if err := _main(repl.Options{Restore: *restore}); err != nil {
+			log.Println(err)
+			return exitRuntimeError
+		}
+		return exitOK
+	}
+	if set["restore"] {
+		fmt.Fprintln(stderr, "-restore 只能在启动 REPL 时使用")
+		return exitUsage
+	}
+	if *typecheck {
+		warnings, err := repl.Check(src)
+		for _, w := range warnings {
+			fmt.Fprintf(stderr, "%s:%s: warning: %s\n", name, w.Pos, w.Message)
+		}
+		var parseErr *repl.ParseError
+		var typeErr *repl.TypeError
+		switch {
+		case errors.As(err, &parseErr):
+			fmt.Fprintf(stderr, "%s: %s\n", name, parseErr)
+			return exitParseError
+		case errors.As(err, &typeErr):
+			for _, e := range typeErr.Errors {
+				fmt.Fprintf(stderr, "%s:%s\n", name, e)
+			}
+			return exitTypeError
+		}
+	}
+	interpreter := evaluator.New()
+	interpreter.Builtins.Set("puts", evaluator.Puts(stdout))
+	// import 先在脚本所在的目录中查找，然后是 -path 中的目录
+	root := "."
+	if name != "-" && name != "-e" {
+		root = filepath.Dir(name)
+	}
+	searchPath := []string{root}
+	if *modulePath != "" {
+		searchPath = append(searchPath, filepath.SplitList(*modulePath)...)
+	}
+	interpreter.Modules = evaluator.NewModules(evaluator.NewOSLoader(searchPath...))
+	switch *traceFile {
+	case "":
+	case "-":
+		interpreter.Tracer = trace.NewJSONWriter(stderr)
+	default:
+		f, err := os.Create(*traceFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "创建跟踪文件失败: %s\n", err)
+			return exitUsage
+		}
+		defer f.Close()
+		w := bufio.NewWriter(f)
+		defer w.Flush()
+		interpreter.Tracer = trace.NewJSONWriter(w)
+	}
+	if *profileFile != "" || *pprofFile != "" {
+		interpreter.Profiler = evaluator.NewProfiler(name)
+		defer func() {
+			if !writeProfile(*profileFile, stderr, interpreter.Profiler.WriteReport) ||
+				!writeProfile(*pprofFile, stderr, interpreter.Profiler.WritePprof) {
+				code = exitUsage
+			}
+		}()
+	}
+	env := repl.NewScriptEnvironment(scriptArgs)
+	result, err := repl.Execute(interpreter, env, src)
+	var parseErr *repl.ParseError
+	var runtimeErr *repl.RuntimeError
+	switch {
+	case errors.As(err, &parseErr):
+		fmt.Fprintf(stderr, "%s: %s\n", name, parseErr)
+		return exitParseError
+	case errors.As(err, &runtimeErr):
+		fmt.Fprintf(stderr, "%s: %s\n", name, runtimeErr)
+		return exitRuntimeError
+	}
+	if printValue && result != nil && result != object.NULL {
+		fmt.Fprintln(stdout, result.Inspect())
+	}
+	return exitOK
+}
+
+// writeProfile 调用 write 把 profile 写入文件，path 为 "-" 时写入 stderr，为空时什么都不做。
+// 失败时打印错误并返回 false。
+func writeProfile(path string, stderr io.Writer, write func(w io.Writer) error) bool {
+	if path == "" {
+		return true
+	}
+	if path == "-" {
+		return write(stderr) == nil
+	}
+	f, err := os.Create(path)
+	if err == nil {
+		err = write(f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
 	if err != nil {
-		log.Println(err)
-		return
+		fmt.Fprintf(stderr, "写入 profile 失败: %s\n", err)
+		return false
 	}
+	return true
+}
+
+// isTerminal 判断文件是否连接到终端
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr, isTerminal(os.Stdin)))
 }
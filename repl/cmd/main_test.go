@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.mk")
+	if err := os.WriteFile(script, []byte("#!/usr/bin/env muskmelon\nputs(args[0] + args[1]);\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// 名为 test 的脚本带上目录时不是 test 子命令
+	named := filepath.Join(dir, "test")
+	if err := os.WriteFile(named, []byte("puts(\"script\")"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{"expr", []string{"-e", "1 + 2"}, "", exitOK, "3\n", ""},
+		{"expr null", []string{"-e", `puts("hi")`}, "", exitOK, "hi\n", ""},
+		{"expr args", []string{"-e", "args[1]", "a", "b"}, "", exitOK, "b\n", ""},
+		{"script args", []string{script, "x", "y"}, "", exitOK, "xy\n", ""},
+		{"script named test", []string{named}, "", exitOK, "script\n", ""},
+		{"stdin dash", []string{"-", "p", "q"}, "puts(args[1])", exitOK, "q\n", ""},
+		{"stdin", nil, "puts(len(args))", exitOK, "0\n", ""},
+		{"runtime error", []string{"-e", "1 + true"}, "", exitRuntimeError, "", "-e: ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{"division by zero", []string{"-e", "1 / 0"}, "", exitRuntimeError, "", "-e: ERROR: division by zero"},
+		{"parse error", []string{"-e", "let = 1"}, "", exitParseError, "", "-e: parser errors:"},
+		{"type error", []string{"-typecheck", "-e", `1 - "a"`}, "", exitTypeError, "", "-e:1:"},
+		{"typecheck ok", []string{"-typecheck", "-e", "1 - 1"}, "", exitOK, "0\n", ""},
+		{"typecheck warning", []string{"-typecheck", "-e", `let f = fn(x, y) { if (y) { x - 1 } else { x } }; f("a", false)`}, "", exitOK, "a\n", "-e:1:52: warning: argument 1: cannot use string as int"},
+		{"unknown flag", []string{"-nope"}, "", exitUsage, "", "usage:"},
+		{"missing script", []string{filepath.Join(dir, "missing.mk")}, "", exitUsage, "", "读取脚本失败"},
+		{"profile", []string{"-profile", "-", "-e", "1"}, "", exitOK, "1\n", "total"},
+		{"trace", []string{"-trace", "-", "-e", "1"}, "", exitOK, "1\n", `"phase":"parse"`},
+		{"restore script", []string{"-restore", script, "-e", "1"}, "", exitUsage, "", "-restore 只能在启动 REPL 时使用"},
+	}
+	for _, tt := range tests {
+		var stdout, stderr strings.Builder
+		code := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr, false)
+		if code != tt.code {
+			t.Errorf("%s: exit code wrong. got=%d, want=%d (stderr=%q)", tt.name, code, tt.code, stderr.String())
+		}
+		if stdout.String() != tt.stdout {
+			t.Errorf("%s: stdout wrong. got=%q, want=%q", tt.name, stdout.String(), tt.stdout)
+		}
+		if !strings.Contains(stderr.String(), tt.stderr) || tt.stderr == "" && stderr.Len() != 0 {
+			t.Errorf("%s: stderr wrong. got=%q, want %q", tt.name, stderr.String(), tt.stderr)
+		}
+	}
+}
+
+func TestRunREPLFlags(t *testing.T) {
+	tests := []struct {
+		args   []string
+		stderr string
+	}{
+		{[]string{"-typecheck"}, "-typecheck 只能在运行脚本时使用"},
+		{[]string{"-trace", "-"}, "-trace 只能在运行脚本时使用"},
+		{[]string{"-profile", "-"}, "-profile 只能在运行脚本时使用"},
+		{[]string{"-pprof", "out.pprof"}, "-pprof 只能在运行脚本时使用"},
+		{[]string{"-path", "lib"}, "-path 只能在运行脚本时使用"},
+	}
+	for _, tt := range tests {
+		var stdout, stderr strings.Builder
+		if code := run(tt.args, strings.NewReader(""), &stdout, &stderr, true); code != exitUsage {
+			t.Errorf("%v: exit code wrong. got=%d, want=%d", tt.args, code, exitUsage)
+		}
+		if !strings.Contains(stderr.String(), tt.stderr) {
+			t.Errorf("%v: stderr wrong. got=%q, want %q", tt.args, stderr.String(), tt.stderr)
+		}
+	}
+}
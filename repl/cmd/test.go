@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/hollykbuck/muskmelon/evaluator"
+	"github.com/hollykbuck/muskmelon/repl"
+	"github.com/hollykbuck/muskmelon/source"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const testUsage = `usage: muskmelon test [-run regexp] [-v] [path ...]
+  运行测试文件中的测试函数，目录会被递归遍历，只处理 *_test.mk 文件，跳过 .git 等隐藏目录，没有参数时使用当前目录。
+  测试文件顶层的 let testXxx = fn() { ... } 是测试函数，测试函数返回错误时失败，
+  可以使用 assert(cond, [msg])、assertEq(actual, expected, [msg]) 和 assertError(fn, [substring])。
+`
+
+// runTests 运行 muskmelon test 子命令，有测试失败时返回 exitRuntimeError
+func runTests(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("muskmelon test", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, testUsage)
+		flags.PrintDefaults()
+	}
+	pattern := flags.String("run", "", "只运行名字匹配正则表达式的测试")
+	verbose := flags.Bool("v", false, "输出每个测试的结果")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	var match func(name string) bool
+	if *pattern != "" {
+		re, err := regexp.Compile(*pattern)
+		if err != nil {
+			fmt.Fprintf(stderr, "无效的 -run: %s\n", err)
+			return exitUsage
+		}
+		match = re.MatchString
+	}
+	roots := flags.Args()
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	files, err := findTestFiles(roots)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(stdout, "no test files")
+		return exitOK
+	}
+	code := exitOK
+	passed, failed := 0, 0
+	for _, name := range files {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitUsage
+		}
+		interpreter := evaluator.New()
+		interpreter.Builtins.Set("puts", evaluator.Puts(stdout))
+		interpreter.Modules = evaluator.NewModules(evaluator.NewOSLoader(filepath.Dir(name)))
+		start := time.Now()
+		results, err := repl.RunTests(interpreter, string(src), match)
+		elapsed := time.Since(start)
+		var parseErr *repl.ParseError
+		var runtimeErr *repl.RuntimeError
+		switch {
+		case errors.As(err, &parseErr):
+			fmt.Fprintf(stdout, "FAIL\t%s\t%s\n", name, parseErr)
+			code = exitParseError
+			continue
+		case errors.As(err, &runtimeErr):
+			location := name
+			if runtimeErr.Err.Pos.IsValid() {
+				location += ":" + runtimeErr.Err.Pos.String()
+			}
+			fmt.Fprintf(stdout, "FAIL\t%s\t%s\n", location, runtimeErr)
+			if code == exitOK {
+				code = exitRuntimeError
+			}
+			continue
+		}
+		filePassed, fileFailed := 0, 0
+		for _, result := range results {
+			if result.Passed() {
+				filePassed++
+				if *verbose {
+					fmt.Fprintf(stdout, "--- PASS: %s (%.3fs)\n", result.Name, result.Duration.Seconds())
+				}
+				continue
+			}
+			fileFailed++
+			fmt.Fprintf(stdout, "--- FAIL: %s (%.3fs)\n", result.Name, result.Duration.Seconds())
+			fmt.Fprintf(stdout, "    %s:%s: %s\n", name, result.FailurePos(), result.Err.Message)
+		}
+		passed += filePassed
+		failed += fileFailed
+		status := "ok"
+		if fileFailed > 0 {
+			status = "FAIL"
+			if code == exitOK {
+				code = exitRuntimeError
+			}
+		}
+		fmt.Fprintf(stdout, "%s\t%s\t%d passed, %d failed (%.3fs)\n", status, name, filePassed, fileFailed, elapsed.Seconds())
+	}
+	status := "PASS"
+	if code != exitOK {
+		status = "FAIL"
+	}
+	fmt.Fprintf(stdout, "%s: %d passed, %d failed\n", status, passed, failed)
+	return code
+}
+
+func isTestFile(path string) bool {
+	return strings.HasSuffix(path, repl.TEST_FILE_SUFFIX)
+}
+
+// findTestFiles 查找测试文件。直接指定的文件不检查后缀，目录中只查找 *_test.mk。
+func findTestFiles(roots []string) ([]string, error) {
+	var files []string
+	for _, root := range roots {
+		err := source.Walk(root, isTestFile, func(path string) error {
+			files = append(files, path)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
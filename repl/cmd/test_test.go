@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunTests(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"pass/lib.mk":            "export let add = fn(a, b) { a + b };",
+		"pass/math_test.mk":      "let add = import \"lib\"[\"add\"];\nlet testAdd = fn() { assertEq(add(1, 2), 3) };\nlet testZero = fn() { assertEq(add(0, 0), 0) };",
+		"pass/.hidden/x_test.mk": "let testHidden = fn() { assert(false) };",
+		"pass/helper.mk":         "let testHelper = fn() { assert(false) };",
+		"fail/math_test.mk":      "let testOk = fn() { assert(true) };\nlet testBad = fn() {\n\tassertEq(1, 2, \"bad\")\n};",
+		"parse/bad_test.mk":      "let = 1;",
+		"runtime/bad_test.mk":    "let testA = fn() { 1 };\n1 + true;",
+		"runtime/pos_test.mk":    "let testA = fn() { 1 };\nassert(false, \"setup\");",
+		"empty/readme.txt":       "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	at := func(name string) string { return filepath.Join(dir, filepath.FromSlash(name)) }
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		stdout []string
+		absent []string
+	}{
+		{"pass", []string{at("pass")}, exitOK, []string{"ok\t" + at("pass/math_test.mk") + "\t2 passed, 0 failed", "PASS: 2 passed, 0 failed"}, []string{"testHidden", "testHelper", "--- PASS"}},
+		{"verbose", []string{"-v", at("pass")}, exitOK, []string{"--- PASS: testAdd", "--- PASS: testZero"}, nil},
+		{"run", []string{"-v", "-run", "Zero$", at("pass")}, exitOK, []string{"--- PASS: testZero", "PASS: 1 passed, 0 failed"}, []string{"testAdd"}},
+		{"file", []string{at("pass/helper.mk")}, exitRuntimeError, []string{"--- FAIL: testHelper"}, nil},
+		{"fail", []string{at("fail")}, exitRuntimeError, []string{"--- FAIL: testBad", at("fail/math_test.mk") + ":3:2: assertion failed: bad: got 1, want 2", "FAIL: 1 passed, 1 failed"}, nil},
+		{"run skips failure", []string{"-run", "Ok", at("fail")}, exitOK, []string{"PASS: 1 passed, 0 failed"}, nil},
+		{"parse error", []string{at("parse"), at("fail")}, exitParseError, []string{"FAIL\t" + at("parse/bad_test.mk"), "--- FAIL: testBad"}, nil},
+		{"runtime error", []string{at("runtime")}, exitRuntimeError, []string{"FAIL\t" + at("runtime/bad_test.mk") + "\tERROR: type mismatch", "FAIL\t" + at("runtime/pos_test.mk") + ":2:1\tERROR: assertion failed: setup"}, nil},
+		{"no test files", []string{at("empty")}, exitOK, []string{"no test files"}, nil},
+		{"missing", []string{at("missing")}, exitUsage, nil, nil},
+		{"bad pattern", []string{"-run", "(", at("pass")}, exitUsage, nil, nil},
+	}
+	for _, tt := range tests {
+		var stdout, stderr strings.Builder
+		// 通过 run 调用，同时检查 test 子命令的分派
+		code := run(append([]string{"test"}, tt.args...), strings.NewReader(""), &stdout, &stderr, false)
+		if code != tt.code {
+			t.Errorf("%s: exit code wrong. got=%d, want=%d (stdout=%q, stderr=%q)", tt.name, code, tt.code, stdout.String(), stderr.String())
+		}
+		for _, s := range tt.stdout {
+			if !strings.Contains(stdout.String(), s) {
+				t.Errorf("%s: stdout does not contain %q. got=%q", tt.name, s, stdout.String())
+			}
+		}
+		for _, s := range tt.absent {
+			if strings.Contains(stdout.String(), s) {
+				t.Errorf("%s: stdout contains %q. got=%q", tt.name, s, stdout.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/lexer"
+	"github.com/hollykbuck/muskmelon/parser"
+	"github.com/hollykbuck/muskmelon/token"
+	"os"
+	"sort"
+	"strings"
+)
+
+// errQuit 由 :quit 返回，通知 Start 结束会话
+var errQuit = errors.New("quit")
+
+// command REPL 的元命令
+type command struct {
+	usage string
+	help  string
+	run   func(s *session, arg string) error
+}
+
+// commands 所有的元命令，以 ':' 开头的输入会在交给 lexer 之前分发到这里
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"help":    {usage: ":help", help: "列出所有命令", run: (*session).cmdHelp},
+		"env":     {usage: ":env", help: "列出会话中的绑定", run: (*session).cmdEnv},
+		"type":    {usage: ":type expr", help: "打印表达式的值的类型", run: (*session).cmdType},
+		"ast":     {usage: ":ast expr", help: "打印表达式的 AST", run: (*session).cmdAst},
+		"tokens":  {usage: ":tokens expr", help: "打印表达式的 token", run: (*session).cmdTokens},
+		"load":    {usage: ":load file", help: "在当前会话中运行脚本文件", run: (*session).cmdLoad},
+		"reset":   {usage: ":reset", help: "清空会话中的绑定", run: (*session).cmdReset},
+		"save":    {usage: ":save file", help: "把会话保存为可以重放的脚本", run: (*session).cmdSave},
+		"restore": {usage: ":restore file", help: "清空会话并从脚本恢复", run: (*session).cmdRestore},
+		"debug":   {usage: ":debug file", help: "在调试器中运行脚本文件", run: (*session).cmdDebug},
+		"break":   {usage: ":break [line]", help: "设置 :debug 使用的断点，没有参数时列出断点", run: (*session).cmdBreak},
+		"clear":   {usage: ":clear [line]", help: "删除断点，没有参数时删除所有断点", run: (*session).cmdClear},
+		"quit":    {usage: ":quit", help: "退出 REPL", run: (*session).cmdQuit},
+	}
+}
+
+// isCommand 判断输入是否是元命令
+func isCommand(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), ":")
+}
+
+// runCommand 解析并执行元命令
+func (s *session) runCommand(line string) error {
+	name, arg, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(line), ":"), " ")
+	arg = strings.TrimSpace(arg)
+	cmd, ok := commands[name]
+	if !ok {
+		return s.printf("unknown command :%s, type :help for a list of commands\n", name)
+	}
+	return cmd.run(s, arg)
+}
+
+// printf 格式化输出到会话
+func (s *session) printf(format string, a ...interface{}) error {
+	_, err := fmt.Fprintf(s.out, format, a...)
+	return err
+}
+
+func (s *session) cmdHelp(string) error {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd := commands[name]
+		if err := s.printf("  %-14s %s\n", cmd.usage, cmd.help); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *session) cmdEnv(string) error {
+	for _, name := range s.env.Names() {
+		value, _ := s.env.Get(name)
+		if err := s.printf("%s = %s\n", name, value.Inspect()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *session) cmdType(arg string) error {
+	program, ok, err := s.parse(arg)
+	if !ok {
+		return err
+	}
+	evaluated := s.interpreter.Eval(program, s.env)
+	if evaluated == nil {
+		return s.printf("no value\n")
+	}
+	return s.printf("%s\n", evaluated.Type())
+}
+
+func (s *session) cmdAst(arg string) error {
+	program, ok, err := s.parse(arg)
+	if !ok {
+		return err
+	}
+	return s.printf("%s", ast.Dump(program))
+}
+
+func (s *session) cmdTokens(arg string) error {
+	l := lexer.New(arg)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if err := s.printf("%-10s %q\n", tok.Type, tok.Literal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *session) cmdLoad(arg string) error {
+	if arg == "" {
+		return s.printf("usage: %s\n", commands["load"].usage)
+	}
+	if ok, err := s.loadFile(arg); !ok {
+		return err
+	}
+	return s.printf("loaded %s\n", arg)
+}
+
+func (s *session) cmdSave(arg string) error {
+	if arg == "" {
+		return s.printf("usage: %s\n", commands["save"].usage)
+	}
+	var content strings.Builder
+	for _, src := range s.transcript {
+		content.WriteString(src)
+		content.WriteString("\n")
+	}
+	if err := os.WriteFile(arg, []byte(content.String()), 0o644); err != nil {
+		return s.printf("保存会话失败: %s\n", err)
+	}
+	return s.printf("saved %d inputs to %s\n", len(s.transcript), arg)
+}
+
+func (s *session) cmdRestore(arg string) error {
+	if arg == "" {
+		return s.printf("usage: %s\n", commands["restore"].usage)
+	}
+	_, err := s.restore(arg)
+	return err
+}
+
+// restore 清空会话并运行脚本，失败时打印错误、保留原来的会话并返回 false
+func (s *session) restore(path string) (bool, error) {
+	interpreter, env, transcript := s.interpreter, s.env, s.transcript
+	s.reset()
+	if ok, err := s.loadFile(path); !ok {
+		s.interpreter, s.env, s.transcript = interpreter, env, transcript
+		return false, err
+	}
+	return true, s.printf("restored %s\n", path)
+}
+
+// loadFile 在当前会话中运行脚本文件，成功时记录到 transcript。
+// 失败时打印错误并返回 false。
+func (s *session) loadFile(path string) (bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, s.printf("读取脚本失败: %s\n", err)
+	}
+	_, err = Execute(s.interpreter, s.env, string(content))
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		return false, printParserErrors(s.out, parseErr.Errors)
+	}
+	if err != nil {
+		return false, s.printf("%s: %s\n", path, err)
+	}
+	if src := strings.TrimSpace(StripShebang(string(content))); src != "" {
+		s.transcript = append(s.transcript, src)
+	}
+	return true, nil
+}
+
+func (s *session) cmdReset(string) error {
+	s.reset()
+	return s.printf("session reset\n")
+}
+
+func (s *session) cmdQuit(string) error {
+	return errQuit
+}
+
+// parse 解析命令的参数。解析失败时打印错误并返回 false。
+func (s *session) parse(src string) (*ast.Program, bool, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, false, printParserErrors(s.out, p.Errors())
+	}
+	return program, true, nil
+}
@@ -0,0 +1,60 @@
+package repl
+
+import (
+	"github.com/hollykbuck/muskmelon/lexer"
+	"github.com/hollykbuck/muskmelon/token"
+)
+
+const CONTINUATION_PROMPT = ".. "
+
+// danglingTokens 出现在输入末尾时说明语句还没有写完的 token
+var danglingTokens = map[token.TokenType]bool{
+	token.ASSIGN:   true,
+	token.PLUS:     true,
+	token.MINUS:    true,
+	token.BANG:     true,
+	token.ASTERISK: true,
+	token.SLASH:    true,
+	token.LT:       true,
+	token.GT:       true,
+	token.EQ:       true,
+	token.NEQ:      true,
+	token.COLON:    true,
+	token.COMMA:    true,
+	token.FUNCTION: true,
+	token.LET:      true,
+	token.IF:       true,
+	token.ELSE:     true,
+	token.RETURN:   true,
+}
+
+// IsComplete 判断输入是否是完整的语句，不完整时 REPL 继续读取下一行。
+// 括号没有闭合、以运算符结尾或者字符串没有结束的输入被认为是不完整的。
+// 多余的右括号会被当作完整输入，交给 parser 报错。
+func IsComplete(input string) bool {
+	l := lexer.New(input)
+	depth := 0
+	var last token.Token
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.STRING:
+			// 字符串字面量不支持转义，没有遇到结束的引号说明字符串没有结束
+			end := tok.Pos.Offset + 1 + len(tok.Literal)
+			if end >= len(input) || input[end] != '"' {
+				return false
+			}
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+			if depth < 0 {
+				return true
+			}
+		}
+		last = tok
+	}
+	if depth > 0 {
+		return false
+	}
+	return !danglingTokens[last.Type]
+}
@@ -0,0 +1,45 @@
+package repl
+
+import "testing"
+
+func TestIsComplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"", true},
+		{"1 + 2", true},
+		{"let add = fn(x, y) {", false},
+		{"let add = fn(x, y) {\n x + y\n};", true},
+		{"add(1,", false},
+		{"[1, 2", false},
+		{"1 +", false},
+		{"let x =", false},
+		{"let x = 1 ==", false},
+		{`"unterminated`, false},
+		{"\"multi\nline\"", true},
+		{"1 + 2)", true},
+		{"if (x) {\n} else", false},
+	}
+	for _, tt := range tests {
+		if got := IsComplete(tt.input); got != tt.expected {
+			t.Errorf("IsComplete(%q) wrong. got=%t, want=%t", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestIsCompleteComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`let x = 1; // don't "quote`, true},
+		{"let f = fn() { // open {\n", false},
+		{"1 + // more\n", false},
+	}
+	for _, tt := range tests {
+		if got := IsComplete(tt.input); got != tt.expected {
+			t.Errorf("IsComplete(%q) wrong. got=%t, want=%t", tt.input, got, tt.expected)
+		}
+	}
+}
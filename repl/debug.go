@@ -0,0 +1,198 @@
+package repl
+
+import (
+	"fmt"
+	"github.com/hollykbuck/muskmelon/evaluator"
+	"github.com/hollykbuck/muskmelon/lexer"
+	"github.com/hollykbuck/muskmelon/parser"
+	"strconv"
+	"strings"
+)
+
+const DEBUG_PROMPT = "(debug) "
+
+// debugCommand 调试器暂停时可以使用的命令
+type debugCommand struct {
+	usage string
+	help  string
+	// run 返回 true 时结束暂停，按 action 继续执行
+	run    func(s *session, d *evaluator.Debugger, arg string) bool
+	action evaluator.Action
+}
+
+// debugCommands 调试器暂停时的命令，命令前面的 ':' 可以省略
+var debugCommands map[string]debugCommand
+
+// debugAliases 调试命令的简写
+var debugAliases = map[string]string{
+	"s": "step", "n": "next", "o": "out", "c": "continue", "q": "quit", "bt": "stack", "p": "print",
+}
+
+func init() {
+	resume := func(*session, *evaluator.Debugger, string) bool { return true }
+	debugCommands = map[string]debugCommand{
+		"step":     {usage: "step, s", help: "执行到下一条语句，进入被调用的函数", run: resume, action: evaluator.ActionStepIn},
+		"next":     {usage: "next, n", help: "执行到当前函数的下一条语句", run: resume, action: evaluator.ActionStepOver},
+		"out":      {usage: "out, o", help: "执行到调用者的下一条语句", run: resume, action: evaluator.ActionStepOut},
+		"continue": {usage: "continue, c", help: "运行到下一个断点", run: resume, action: evaluator.ActionContinue},
+		"quit":     {usage: "quit, q", help: "停止执行", run: resume, action: evaluator.ActionStop},
+		"stack":    {usage: "stack, bt", help: "打印调用栈", run: (*session).debugStack},
+		"env":      {usage: "env [frame]", help: "打印帧的 environment，包括外层作用域", run: (*session).debugEnv},
+		"print":    {usage: "print, p expr", help: "在当前帧中计算表达式", run: (*session).debugPrint},
+		"break":    {usage: "break [line]", help: "设置断点，没有参数时列出断点", run: (*session).debugBreak},
+		"clear":    {usage: "clear [line]", help: "删除断点，没有参数时删除所有断点", run: (*session).debugClear},
+		"help":     {usage: "help", help: "列出调试命令", run: (*session).debugHelp},
+	}
+}
+
+// onStop 打印暂停的位置，然后读取调试命令直到继续执行。输入结束时停止执行。
+func (s *session) onStop(d *evaluator.Debugger, reason evaluator.StopReason) evaluator.Action {
+	frame := d.Frames()[0]
+	_ = s.printf("stopped at %s (%s): %s\n", frameLocation(frame), reason, frame.Statement)
+	for {
+		line, err := s.reader.ReadLine(DEBUG_PROMPT)
+		if err != nil {
+			return evaluator.ActionStop
+		}
+		name, arg, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(line), ":"), " ")
+		if name == "" {
+			continue
+		}
+		if alias, ok := debugAliases[name]; ok {
+			name = alias
+		}
+		cmd, ok := debugCommands[name]
+		if !ok {
+			_ = s.printf("unknown debug command %s, type help for a list of commands\n", name)
+			continue
+		}
+		if cmd.run(s, d, strings.TrimSpace(arg)) {
+			return cmd.action
+		}
+	}
+}
+
+func (s *session) debugHelp(*evaluator.Debugger, string) bool {
+	for _, name := range []string{"step", "next", "out", "continue", "quit", "stack", "env", "print", "break", "clear", "help"} {
+		cmd := debugCommands[name]
+		_ = s.printf("  %-14s %s\n", cmd.usage, cmd.help)
+	}
+	return false
+}
+
+func (s *session) debugStack(d *evaluator.Debugger, _ string) bool {
+	for i, frame := range d.Frames() {
+		_ = s.printf("#%d %s\n", i, frameLocation(frame))
+	}
+	return false
+}
+
+// frameLocation 帧的名字和行号，模块中的帧带上模块的文件
+func frameLocation(frame *evaluator.Frame) string {
+	if frame.File != "" {
+		return fmt.Sprintf("%s %s:%d", frame.Name, frame.File, frame.Line())
+	}
+	return fmt.Sprintf("%s:%d", frame.Name, frame.Line())
+}
+
+func (s *session) debugEnv(d *evaluator.Debugger, arg string) bool {
+	frames := d.Frames()
+	index := 0
+	if arg != "" {
+		var err error
+		if index, err = strconv.Atoi(arg); err != nil || index < 0 || index >= len(frames) {
+			_ = s.printf("no frame %s\n", arg)
+			return false
+		}
+	}
+	depth := 0
+	for env := frames[index].Env; env != nil; env = env.Outer() {
+		_ = s.printf("scope %d:\n", depth)
+		for _, name := range env.Names() {
+			value, _ := env.Get(name)
+			_ = s.printf("  %s = %s\n", name, value.Inspect())
+		}
+		depth++
+	}
+	return false
+}
+
+// debugPrint 在最内层的帧中计算表达式。计算时不会触发断点。
+func (s *session) debugPrint(d *evaluator.Debugger, arg string) bool {
+	p := parser.New(lexer.New(arg))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		_ = printParserErrors(s.out, p.Errors())
+		return false
+	}
+	in := &evaluator.Interpreter{Builtins: s.interpreter.Builtins}
+	evaluated := in.Eval(program, d.Frames()[0].Env)
+	if evaluated != nil {
+		_ = s.printf("%s\n", s.printer.Sprint(evaluated))
+	}
+	return false
+}
+
+func (s *session) debugBreak(d *evaluator.Debugger, arg string) bool {
+	_ = s.setBreakpoint(d, arg)
+	return false
+}
+
+func (s *session) debugClear(d *evaluator.Debugger, arg string) bool {
+	_ = s.clearBreakpoint(d, arg)
+	return false
+}
+
+// setBreakpoint 解析行号并设置断点，没有行号时列出所有断点
+func (s *session) setBreakpoint(d *evaluator.Debugger, arg string) error {
+	if arg == "" {
+		lines := d.Breakpoints(s.interpreter.File)
+		if len(lines) == 0 {
+			return s.printf("no breakpoints\n")
+		}
+		return s.printf("breakpoints: %s\n", strings.Trim(fmt.Sprint(lines), "[]"))
+	}
+	line, err := strconv.Atoi(arg)
+	if err != nil || line < 1 {
+		return s.printf("invalid line %q\n", arg)
+	}
+	d.SetBreakpoint(s.interpreter.File, line)
+	return s.printf("breakpoint set at line %d\n", line)
+}
+
+// clearBreakpoint 解析行号并删除断点，没有行号时删除所有断点
+func (s *session) clearBreakpoint(d *evaluator.Debugger, arg string) error {
+	if arg == "" {
+		d.ClearBreakpoints()
+		return s.printf("all breakpoints cleared\n")
+	}
+	line, err := strconv.Atoi(arg)
+	if err != nil || line < 1 {
+		return s.printf("invalid line %q\n", arg)
+	}
+	d.ClearBreakpoint(s.interpreter.File, line)
+	return s.printf("breakpoint cleared at line %d\n", line)
+}
+
+func (s *session) cmdBreak(arg string) error {
+	return s.setBreakpoint(s.debugger, arg)
+}
+
+func (s *session) cmdClear(arg string) error {
+	return s.clearBreakpoint(s.debugger, arg)
+}
+
+// cmdDebug 在调试器中运行脚本文件。没有断点时在第一条语句处暂停。
+func (s *session) cmdDebug(arg string) error {
+	if arg == "" {
+		return s.printf("usage: %s\n", commands["debug"].usage)
+	}
+	s.debugger.Reset()
+	s.debugger.StopOnEntry = len(s.debugger.Breakpoints(s.interpreter.File)) == 0
+	s.interpreter.Debugger = s.debugger
+	defer func() { s.interpreter.Debugger = nil }()
+	if ok, err := s.loadFile(arg); !ok {
+		return err
+	}
+	return s.printf("finished %s\n", arg)
+}
@@ -0,0 +1,59 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDebugCommands(t *testing.T) {
+	script := t.TempDir() + "/debug.mk"
+	src := "let add = fn(a, b) {\n\tlet sum = a + b;\n\tsum\n};\nlet x = add(1, 2);\nx * 2\n"
+	if err := os.WriteFile(script, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			":debug " + script + "\nn\ns\nbt\nenv\np a + b\nout\nc",
+			"stopped at <main>:1 (entry): let add = fn(a,b) let sum = (a + b);sum;\n" +
+				DEBUG_PROMPT + "stopped at <main>:5 (step): let x = add(1, 2);\n" +
+				DEBUG_PROMPT + "stopped at add:2 (step): let sum = (a + b);\n" +
+				DEBUG_PROMPT + "#0 add:2\n#1 <main>:5\n" +
+				DEBUG_PROMPT + "scope 0:\n  a = 1\n  b = 2\nscope 1:\n  add = fn(a, b) {\nlet sum = (a + b);sum\n}\n" +
+				DEBUG_PROMPT + "3\n" +
+				DEBUG_PROMPT + "stopped at <main>:6 (step): (x * 2)\n" +
+				DEBUG_PROMPT + "finished " + script + "\n",
+		},
+		{
+			":break 3\n:break\n:debug " + script + "\np sum\nclear\nc\nx",
+			"breakpoint set at line 3\n" + PROMPT +
+				"breakpoints: 3\n" + PROMPT +
+				"stopped at add:3 (breakpoint): sum\n" +
+				DEBUG_PROMPT + "3\n" +
+				DEBUG_PROMPT + "all breakpoints cleared\n" +
+				DEBUG_PROMPT + "finished " + script + "\n" + PROMPT + "3\n",
+		},
+		{
+			":debug " + script + "\nfoo\nq\nx",
+			"stopped at <main>:1 (entry): let add = fn(a,b) let sum = (a + b);sum;\n" +
+				DEBUG_PROMPT + "unknown debug command foo, type help for a list of commands\n" +
+				DEBUG_PROMPT + script + ": ERROR: execution stopped by debugger\n" + PROMPT +
+				"ERROR: identifier not found: x\n",
+		},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := Start(strings.NewReader(tt.input+"\n:quit\n"), &out); err != nil {
+			t.Fatalf("Start returned error: %s", err)
+		}
+		got := strings.TrimPrefix(out.String(), PROMPT)
+		got = strings.TrimSuffix(got, PROMPT)
+		if got != tt.expected {
+			t.Errorf("wrong output for %q.\ngot=%q\nwant=%q", tt.input, got, tt.expected)
+		}
+	}
+}
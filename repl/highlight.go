@@ -0,0 +1,97 @@
+package repl
+
+import (
+	"github.com/hollykbuck/muskmelon/lexer"
+	"github.com/hollykbuck/muskmelon/repl/lineedit"
+	"github.com/hollykbuck/muskmelon/token"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// 终端颜色
+const (
+	colorReset   = "\x1b[0m"
+	colorRed     = "\x1b[31m"
+	colorGreen   = "\x1b[32m"
+	colorYellow  = "\x1b[33m"
+	colorBlue    = "\x1b[34m"
+	colorMagenta = "\x1b[35m"
+	colorCyan    = "\x1b[36m"
+	colorGray    = "\x1b[90m"
+)
+
+// tokenColors 输入高亮时每种 token 使用的颜色，没有列出的 token 不上色
+var tokenColors = map[token.TokenType]string{
+	token.FUNCTION: colorMagenta,
+	token.LET:      colorMagenta,
+	token.IF:       colorMagenta,
+	token.ELSE:     colorMagenta,
+	token.RETURN:   colorMagenta,
+	token.IMPORT:   colorMagenta,
+	token.EXPORT:   colorMagenta,
+	token.TRUE:     colorYellow,
+	token.FALSE:    colorYellow,
+	token.INT:      colorCyan,
+	token.STRING:   colorGreen,
+	token.ILLEGAL:  colorRed,
+	token.COMMENT:  colorGray,
+}
+
+// colorEnabled 判断是否应当向 out 输出颜色。
+// out 不是终端或者设置了 NO_COLOR 环境变量时不输出颜色。
+func colorEnabled(out io.Writer) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	f, ok := out.(*os.File)
+	return ok && lineedit.IsTerminal(f.Fd())
+}
+
+// Highlight 根据 lexer 的结果给一行输入加上终端颜色。
+// 去掉颜色之后与输入完全相同，token 之间的空白原样保留。
+func Highlight(line string) string {
+	var out strings.Builder
+	l := lexer.New(line)
+	var tokens []token.Token
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		tokens = append(tokens, tok)
+	}
+	// 注释不会交给 parser，需要按位置合并回 token 序列
+	tokens = append(tokens, l.Comments()...)
+	sort.SliceStable(tokens, func(i, j int) bool { return tokens[i].Pos.Offset < tokens[j].Pos.Offset })
+	last := 0
+	for _, tok := range tokens {
+		start := tok.Pos.Offset
+		end := start + tokenLength(line, tok)
+		out.WriteString(line[last:start])
+		if color, ok := tokenColors[tok.Type]; ok {
+			out.WriteString(color + line[start:end] + colorReset)
+		} else {
+			out.WriteString(line[start:end])
+		}
+		last = end
+	}
+	out.WriteString(line[last:])
+	return out.String()
+}
+
+// tokenLength 计算 token 在源码中占用的字节数
+func tokenLength(src string, tok token.Token) int {
+	switch tok.Type {
+	case token.STRING:
+		end := tok.Pos.Offset + 1 + len(tok.Literal)
+		// 没有结束的字符串一直延续到输入末尾
+		if end < len(src) && src[end] == '"' {
+			return len(tok.Literal) + 2
+		}
+		return len(src) - tok.Pos.Offset
+	case token.ILLEGAL:
+		_, size := utf8.DecodeRuneInString(src[tok.Pos.Offset:])
+		return size
+	default:
+		return len(tok.Literal)
+	}
+}
@@ -0,0 +1,118 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/hollykbuck/muskmelon/repl/lineedit"
+	"github.com/hollykbuck/muskmelon/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// HISTORY_FILE 用户 home 目录下保存 REPL 历史的文件
+const HISTORY_FILE = ".muskmelon_history"
+
+// lineReader 逐行读取用户输入
+type lineReader interface {
+	// ReadLine 显示 prompt 并读取一行，输入结束时返回 io.EOF
+	ReadLine(prompt string) (string, error)
+}
+
+// scannerReader 不支持行编辑的 lineReader，用于输入不是终端的情况
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *scannerReader) ReadLine(prompt string) (string, error) {
+	_, err := fmt.Fprint(r.out, prompt)
+	if err != nil {
+		return "", fmt.Errorf("输出失败: %w", err)
+	}
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// editorReader 使用 lineedit 的 lineReader，输入会被记录到历史中
+type editorReader struct {
+	editor *lineedit.Editor
+	out    io.Writer
+}
+
+func (r *editorReader) ReadLine(prompt string) (string, error) {
+	line, err := r.editor.ReadLine(prompt)
+	if err != nil {
+		return "", err
+	}
+	if err := r.editor.History.Add(line); err != nil {
+		_, _ = fmt.Fprintf(r.out, "保存历史失败: %s\n", err)
+	}
+	return line, nil
+}
+
+// newLineReader 输入是终端时使用行编辑器，否则逐行读取
+func newLineReader(in io.Reader, out io.Writer, s *session) lineReader {
+	f, ok := in.(*os.File)
+	if !ok || !lineedit.IsTerminal(f.Fd()) {
+		return &scannerReader{scanner: bufio.NewScanner(in), out: out}
+	}
+	editor := lineedit.New(in, out)
+	if home, err := os.UserHomeDir(); err == nil {
+		history, err := lineedit.LoadHistory(filepath.Join(home, HISTORY_FILE), lineedit.DefaultHistorySize)
+		if err != nil {
+			_, _ = fmt.Fprintf(out, "加载历史失败: %s\n", err)
+		}
+		editor.History = history
+	}
+	editor.Complete = s.complete
+	if s.printer.Color {
+		editor.Highlight = Highlight
+	}
+	return &editorReader{editor: editor, out: out}
+}
+
+// complete 补全光标前的单词。
+// 候选包括关键字、内置函数和会话中绑定的名字，以 ':' 开头的行补全元命令。
+func (s *session) complete(line []rune, pos int) ([]string, int) {
+	start := pos
+	for start > 0 && isIdentRune(line[start-1]) {
+		start--
+	}
+	prefix := string(line[start:pos])
+	var names []string
+	if start == 1 && line[0] == ':' {
+		for name := range commands {
+			names = append(names, name)
+		}
+	} else {
+		if prefix == "" {
+			return nil, start
+		}
+		names = append(names, token.Keywords()...)
+		names = append(names, s.interpreter.Builtins.Names()...)
+		names = append(names, s.env.Names()...)
+	}
+	seen := make(map[string]bool)
+	var candidates []string
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates, start
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,417 @@
+// Package lineedit 实现 REPL 使用的行编辑器。
+// 支持光标移动、历史记录、反向搜索和 Tab 补全，不依赖第三方库。
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// ErrInterrupted 用户按下 Ctrl-C 放弃当前输入
+var ErrInterrupted = errors.New("interrupted")
+
+// Completer 根据当前行和光标位置返回补全候选，以及被补全的单词的起始位置
+type Completer func(line []rune, pos int) (candidates []string, start int)
+
+// Highlighter 返回用于显示的行，通常是加上了终端颜色的行。
+// 返回值去掉控制序列之后必须与 line 相同。
+type Highlighter func(line string) string
+
+// 控制键
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyBackspace = 8
+	keyTab       = 9
+	keyLF        = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyCR        = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// 转义序列解析后得到的虚拟按键，取值不与任何字符冲突
+const (
+	keyUp rune = -1 - iota
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDeleteForward
+	keyUnknown
+)
+
+// Editor 行编辑器
+type Editor struct {
+	in  *bufio.Reader
+	out io.Writer
+	fd  uintptr
+	raw bool
+	// History 输入历史，Up/Down 和 Ctrl-R 在其中查找
+	History *History
+	// Complete Tab 补全，为 nil 时 Tab 插入空格
+	Complete Completer
+	// Highlight 绘制当前行时使用，为 nil 时原样显示
+	Highlight Highlighter
+
+	prompt string
+	line   []rune
+	pos    int
+	// histIdx 正在浏览的历史下标，等于 History.Len() 表示正在编辑的新行
+	histIdx int
+	// pending 浏览历史之前正在编辑的新行
+	pending []rune
+}
+
+// New 创建行编辑器。
+// in 是终端时 ReadLine 会把终端切换到 raw 模式，否则按收到的字节处理按键，用于测试。
+func New(in io.Reader, out io.Writer) *Editor {
+	e := &Editor{in: bufio.NewReader(in), out: out, History: NewHistory(DefaultHistorySize)}
+	if f, ok := in.(*os.File); ok && IsTerminal(f.Fd()) {
+		e.fd = f.Fd()
+		e.raw = true
+	}
+	return e
+}
+
+// ReadLine 显示 prompt 并读取一行输入，返回的行不包含换行符。
+// 在空行上按 Ctrl-D 或者输入结束时返回 io.EOF，按 Ctrl-C 返回 ErrInterrupted。
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if e.raw {
+		restore, err := makeRaw(e.fd)
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+	e.prompt = prompt
+	e.line = e.line[:0]
+	e.pos = 0
+	e.histIdx = e.History.Len()
+	e.pending = nil
+	if err := e.refresh(); err != nil {
+		return "", err
+	}
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(e.line) > 0 {
+				// 最后一行没有换行符时仍然返回已经输入的内容
+				return e.accept()
+			}
+			return "", err
+		}
+		done, err := e.handleKey(key)
+		if err != nil {
+			return "", err
+		}
+		if done {
+			return e.accept()
+		}
+	}
+}
+
+// accept 结束当前行的编辑
+func (e *Editor) accept() (string, error) {
+	line := string(e.line)
+	if _, err := io.WriteString(e.out, "\r\n"); err != nil {
+		return "", err
+	}
+	return line, nil
+}
+
+// handleKey 处理一个按键，返回 true 表示输入完成
+func (e *Editor) handleKey(key rune) (bool, error) {
+	switch key {
+	case keyCR, keyLF:
+		return true, nil
+	case keyCtrlC:
+		_, err := io.WriteString(e.out, "^C\r\n")
+		if err != nil {
+			return false, err
+		}
+		return false, ErrInterrupted
+	case keyCtrlD:
+		if len(e.line) == 0 {
+			_, err := io.WriteString(e.out, "\r\n")
+			if err != nil {
+				return false, err
+			}
+			return false, io.EOF
+		}
+		e.deleteForward()
+	case keyCtrlA, keyHome:
+		e.pos = 0
+	case keyCtrlE, keyEnd:
+		e.pos = len(e.line)
+	case keyCtrlB, keyLeft:
+		if e.pos > 0 {
+			e.pos--
+		}
+	case keyCtrlF, keyRight:
+		if e.pos < len(e.line) {
+			e.pos++
+		}
+	case keyBackspace, keyDelete:
+		if e.pos > 0 {
+			e.line = append(e.line[:e.pos-1], e.line[e.pos:]...)
+			e.pos--
+		}
+	case keyDeleteForward:
+		e.deleteForward()
+	case keyCtrlK:
+		e.line = e.line[:e.pos]
+	case keyCtrlU:
+		e.line = append(e.line[:0], e.line[e.pos:]...)
+		e.pos = 0
+	case keyCtrlW:
+		start := e.pos
+		for start > 0 && unicode.IsSpace(e.line[start-1]) {
+			start--
+		}
+		for start > 0 && !unicode.IsSpace(e.line[start-1]) {
+			start--
+		}
+		e.line = append(e.line[:start], e.line[e.pos:]...)
+		e.pos = start
+	case keyCtrlL:
+		if _, err := io.WriteString(e.out, "\x1b[H\x1b[2J"); err != nil {
+			return false, err
+		}
+	case keyCtrlP, keyUp:
+		e.historyMove(-1)
+	case keyCtrlN, keyDown:
+		e.historyMove(1)
+	case keyTab:
+		if e.Complete == nil {
+			e.insert([]rune("  "))
+			break
+		}
+		if err := e.complete(); err != nil {
+			return false, err
+		}
+	case keyCtrlR:
+		return e.reverseSearch()
+	case keyUnknown, keyEscape:
+	default:
+		if unicode.IsPrint(key) {
+			e.insert([]rune{key})
+		}
+	}
+	return false, e.refresh()
+}
+
+// insert 在光标处插入字符
+func (e *Editor) insert(runes []rune) {
+	line := make([]rune, 0, len(e.line)+len(runes))
+	line = append(line, e.line[:e.pos]...)
+	line = append(line, runes...)
+	line = append(line, e.line[e.pos:]...)
+	e.line = line
+	e.pos += len(runes)
+}
+
+// deleteForward 删除光标处的字符
+func (e *Editor) deleteForward() {
+	if e.pos < len(e.line) {
+		e.line = append(e.line[:e.pos], e.line[e.pos+1:]...)
+	}
+}
+
+// historyMove 在历史中前后移动
+func (e *Editor) historyMove(delta int) {
+	idx := e.histIdx + delta
+	if idx < 0 || idx > e.History.Len() {
+		return
+	}
+	if e.histIdx == e.History.Len() {
+		e.pending = append([]rune(nil), e.line...)
+	}
+	e.histIdx = idx
+	if idx == e.History.Len() {
+		e.line = append([]rune(nil), e.pending...)
+	} else {
+		e.line = []rune(e.History.At(idx))
+	}
+	e.pos = len(e.line)
+}
+
+// complete 处理 Tab 补全。
+// 只有一个候选时直接补全，多个候选时补全公共前缀，没有公共前缀可以补全时列出所有候选。
+func (e *Editor) complete() error {
+	candidates, start := e.Complete(e.line, e.pos)
+	if len(candidates) == 0 {
+		return nil
+	}
+	typed := string(e.line[start:e.pos])
+	prefix := candidates[0]
+	for _, c := range candidates[1:] {
+		prefix = commonPrefix(prefix, c)
+	}
+	if len(candidates) == 1 || len(prefix) > len(typed) {
+		e.line = append(e.line[:start:start], append([]rune(prefix), e.line[e.pos:]...)...)
+		e.pos = start + len([]rune(prefix))
+		return nil
+	}
+	_, err := fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	return err
+}
+
+// reverseSearch 处理 Ctrl-R 反向增量搜索。
+// 再次按 Ctrl-R 查找更早的匹配，Enter 接受并提交，Ctrl-G 或 Esc 取消，其他按键接受匹配后继续编辑。
+func (e *Editor) reverseSearch() (bool, error) {
+	var query []rune
+	idx := e.History.Len()
+	match := string(e.line)
+	search := func(from int) {
+		if from >= e.History.Len() {
+			from = e.History.Len() - 1
+		}
+		for i := from; i >= 0; i-- {
+			if strings.Contains(e.History.At(i), string(query)) {
+				idx = i
+				match = e.History.At(i)
+				return
+			}
+		}
+	}
+	for {
+		if _, err := fmt.Fprintf(e.out, "\r\x1b[K(reverse-i-search)`%s': %s", string(query), match); err != nil {
+			return false, err
+		}
+		key, err := e.readKey()
+		if err != nil {
+			return false, err
+		}
+		switch key {
+		case keyCtrlR:
+			if idx > 0 {
+				search(idx - 1)
+			}
+			continue
+		case keyBackspace, keyDelete:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				search(e.History.Len() - 1)
+			}
+			continue
+		case keyCtrlG, keyEscape, keyCtrlC:
+			return false, e.refresh()
+		}
+		if unicode.IsPrint(key) {
+			query = append(query, key)
+			search(idx)
+			continue
+		}
+		e.line = []rune(match)
+		e.pos = len(e.line)
+		if key == keyCR || key == keyLF {
+			return true, e.refresh()
+		}
+		return e.handleKey(key)
+	}
+}
+
+// refresh 重新绘制提示符和当前行，并把光标移动到正确的位置
+func (e *Editor) refresh() error {
+	line := string(e.line)
+	if e.Highlight != nil {
+		line = e.Highlight(line)
+	}
+	var out strings.Builder
+	out.WriteString("\r")
+	out.WriteString(e.prompt)
+	out.WriteString(line)
+	out.WriteString("\x1b[K")
+	if back := len(e.line) - e.pos; back > 0 {
+		out.WriteString(fmt.Sprintf("\x1b[%dD", back))
+	}
+	_, err := io.WriteString(e.out, out.String())
+	return err
+}
+
+// readKey 读取一个按键，将转义序列解析为虚拟按键
+func (e *Editor) readKey() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if r != keyEscape {
+		return r, nil
+	}
+	// 单独的 Esc 后面不会紧跟其他字节
+	if e.in.Buffered() == 0 && e.raw {
+		return keyEscape, nil
+	}
+	next, _, err := e.in.ReadRune()
+	if err != nil {
+		return keyEscape, nil
+	}
+	if next != '[' && next != 'O' {
+		return keyUnknown, nil
+	}
+	var params []rune
+	for {
+		c, _, err := e.in.ReadRune()
+		if err != nil {
+			return keyUnknown, nil
+		}
+		if c >= 0x40 && c <= 0x7e {
+			return escapeKey(c, string(params)), nil
+		}
+		params = append(params, c)
+	}
+}
+
+// escapeKey 将 CSI 转义序列映射为虚拟按键
+func escapeKey(final rune, params string) rune {
+	switch final {
+	case 'A':
+		return keyUp
+	case 'B':
+		return keyDown
+	case 'C':
+		return keyRight
+	case 'D':
+		return keyLeft
+	case 'H':
+		return keyHome
+	case 'F':
+		return keyEnd
+	case '~':
+		switch params {
+		case "1", "7":
+			return keyHome
+		case "4", "8":
+			return keyEnd
+		case "3":
+			return keyDeleteForward
+		}
+	}
+	return keyUnknown
+}
+
+func commonPrefix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return a[:i]
+}
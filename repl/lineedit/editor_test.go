@@ -0,0 +1,134 @@
+package lineedit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readLines 用 input 作为按键运行编辑器，返回读到的所有行
+func readLines(t *testing.T, e *Editor) []string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := e.ReadLine("> ")
+		if errors.Is(err, io.EOF) {
+			return lines
+		}
+		if errors.Is(err, ErrInterrupted) {
+			lines = append(lines, "<interrupted>")
+			continue
+		}
+		if err != nil {
+			t.Fatalf("ReadLine returned error: %s", err)
+		}
+		lines = append(lines, line)
+		_ = e.History.Add(line)
+	}
+}
+
+func TestEditorKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"plain", "let x = 1\r", []string{"let x = 1"}},
+		{"backspace", "abd\x7fc\r", []string{"abc"}},
+		{"cursor", "bc\x1b[D\x1b[Da\x1b[F!\r", []string{"abc!"}},
+		{"home and kill", "xyz\x01\x0b\r", []string{""}},
+		{"kill to start", "abc\x1b[D\x15\r", []string{"c"}},
+		{"delete word", "let value\x17x\r", []string{"let x"}},
+		{"delete forward", "abc\x01\x1b[3~\r", []string{"bc"}},
+		{"interrupt", "abc\x03def\r", []string{"<interrupted>", "def"}},
+		{"history", "one\rtwo\r\x1b[A\x1b[A\r", []string{"one", "two", "one"}},
+		{"history back to new line", "one\rne\x1b[A\x1b[B!\r", []string{"one", "ne!"}},
+		{"reverse search", "let a = 1\rputs(a)\rlen(a)\r\x12et\r", []string{"let a = 1", "puts(a)", "len(a)", "let a = 1"}},
+		{"reverse search again", "a1\ra2\ra3\r\x12a\x12\x12\r", []string{"a1", "a2", "a3", "a1"}},
+		{"reverse search edit", "puts(1)\r\x12put\x05!\r", []string{"puts(1)", "puts(1)!"}},
+		{"reverse search cancel", "abc\rx\x12ab\x07y\r", []string{"abc", "xy"}},
+		{"eof without newline", "tail", []string{"tail"}},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		e := New(strings.NewReader(tt.input), &out)
+		got := readLines(t, e)
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%s: wrong lines. got=%q, want=%q", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestEditorComplete(t *testing.T) {
+	words := []string{"let", "len", "length", "puts"}
+	completer := func(line []rune, pos int) ([]string, int) {
+		start := pos
+		for start > 0 && line[start-1] != ' ' && line[start-1] != '(' {
+			start--
+		}
+		var candidates []string
+		for _, w := range words {
+			if strings.HasPrefix(w, string(line[start:pos])) {
+				candidates = append(candidates, w)
+			}
+		}
+		return candidates, start
+	}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"pu\t(1)\r", "puts(1)"},
+		{"lengt\t\r", "length"},
+		{"x = le\t\r", "x = le"},
+		{"lenx\x1b[D\t\r", "lenx"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		e := New(strings.NewReader(tt.input), &out)
+		e.Complete = completer
+		got, err := e.ReadLine("> ")
+		if err != nil {
+			t.Fatalf("ReadLine returned error: %s", err)
+		}
+		if got != tt.expected {
+			t.Errorf("wrong completion for %q. got=%q, want=%q", tt.input, got, tt.expected)
+		}
+	}
+	var out bytes.Buffer
+	e := New(strings.NewReader("le\t\t\r"), &out)
+	e.Complete = completer
+	if _, err := e.ReadLine("> "); err != nil {
+		t.Fatalf("ReadLine returned error: %s", err)
+	}
+	if !strings.Contains(out.String(), "let  len  length") {
+		t.Errorf("candidates were not listed. got=%q", out.String())
+	}
+}
+
+func TestHistoryPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h, err := LoadHistory(path, 3)
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %s", err)
+	}
+	for _, line := range []string{"a", "b", "b", "", "c", "d"} {
+		if err := h.Add(line); err != nil {
+			t.Fatalf("Add failed: %s", err)
+		}
+	}
+	reloaded, err := LoadHistory(path, 3)
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %s", err)
+	}
+	var got []string
+	for i := 0; i < reloaded.Len(); i++ {
+		got = append(got, reloaded.At(i))
+	}
+	if strings.Join(got, ",") != "b,c,d" {
+		t.Errorf("wrong history. got=%q", got)
+	}
+}
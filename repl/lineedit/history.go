@@ -0,0 +1,105 @@
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// DefaultHistorySize History 默认保留的条数
+const DefaultHistorySize = 1000
+
+// History 输入历史。
+// 设置了文件路径时，每条新的历史都会追加到文件中，下次启动时可以重新加载。
+type History struct {
+	entries []string
+	max     int
+	path    string
+}
+
+// NewHistory History 的构造函数，最多保留 max 条
+func NewHistory(max int) *History {
+	if max <= 0 {
+		max = DefaultHistorySize
+	}
+	return &History{max: max}
+}
+
+// LoadHistory 从文件中加载历史，之后的新历史会追加到同一个文件。
+// 文件不存在时返回空的 History。
+func LoadHistory(path string, max int) (*History, error) {
+	h := NewHistory(max)
+	h.path = path
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return h, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h.push(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return h, err
+	}
+	// 文件超过上限时重写，避免无限增长
+	if len(h.entries) == h.max {
+		return h, h.rewrite()
+	}
+	return h, nil
+}
+
+// Add 添加一条历史。空行和与上一条相同的输入会被忽略。
+func (h *History) Add(line string) error {
+	if strings.TrimSpace(line) == "" || strings.ContainsAny(line, "\r\n") {
+		return nil
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == line {
+		return nil
+	}
+	h.push(line)
+	if h.path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(line + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Len 历史的条数
+func (h *History) Len() int {
+	return len(h.entries)
+}
+
+// At 返回第 i 条历史，0 是最早的一条
+func (h *History) At(i int) string {
+	return h.entries[i]
+}
+
+// push 添加历史并丢弃超出上限的旧历史
+func (h *History) push(line string) {
+	h.entries = append(h.entries, line)
+	if len(h.entries) > h.max {
+		h.entries = h.entries[len(h.entries)-h.max:]
+	}
+}
+
+// rewrite 用内存中的历史覆盖文件
+func (h *History) rewrite() error {
+	var content strings.Builder
+	for _, entry := range h.entries {
+		content.WriteString(entry + "\n")
+	}
+	return os.WriteFile(h.path, []byte(content.String()), 0o600)
+}
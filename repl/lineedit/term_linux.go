@@ -0,0 +1,9 @@
+package lineedit
+
+import "syscall"
+
+// 读取和设置终端属性的 ioctl 请求
+const (
+	ioctlGetTermios = syscall.TCGETS
+	ioctlSetTermios = syscall.TCSETS
+)
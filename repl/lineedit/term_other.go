@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package lineedit
+
+import "errors"
+
+// IsTerminal 在不支持的平台上总是返回 false，REPL 退回到逐行读取
+func IsTerminal(fd uintptr) bool {
+	return false
+}
+
+func makeRaw(fd uintptr) (func() error, error) {
+	return nil, errors.New("raw mode is not supported on this platform")
+}
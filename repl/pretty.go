@@ -0,0 +1,141 @@
+package repl
+
+import (
+	"fmt"
+	"github.com/hollykbuck/muskmelon/object"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Printer 将对象格式化为适合在 REPL 中阅读的文本。
+// 单行放不下的集合会被展开为多行并缩进，过长的字符串和集合会被截断。
+type Printer struct {
+	// Color 是否按对象类型输出终端颜色
+	Color bool
+	// Width 单行的最大宽度，超过时展开集合
+	Width int
+	// MaxItems 集合最多显示的元素个数
+	MaxItems int
+	// MaxString 字符串最多显示的字符个数
+	MaxString int
+	// Indent 每一层缩进使用的字符串
+	Indent string
+}
+
+// NewPrinter 使用默认配置创建 Printer
+func NewPrinter(color bool) *Printer {
+	return &Printer{Color: color, Width: 80, MaxItems: 100, MaxString: 1000, Indent: "  "}
+}
+
+// Sprint 格式化对象。顶层的字符串原样输出，集合中的字符串带引号。
+func (p *Printer) Sprint(obj object.Object) string {
+	if str, ok := obj.(*object.String); ok {
+		return p.paint(colorGreen, p.truncate(str.Value))
+	}
+	return p.format(obj, 0)
+}
+
+// format 格式化 depth 层的对象
+func (p *Printer) format(obj object.Object, depth int) string {
+	switch objActual := obj.(type) {
+	case *object.Integer:
+		return p.paint(colorCyan, objActual.Inspect())
+	case *object.Boolean:
+		return p.paint(colorYellow, objActual.Inspect())
+	case *object.Null:
+		return p.paint(colorGray, objActual.Inspect())
+	case *object.String:
+		return p.paint(colorGreen, fmt.Sprintf("%q", p.truncate(objActual.Value)))
+	case *object.Error:
+		return p.paint(colorRed, objActual.Inspect())
+	case *object.Builtin:
+		return p.paint(colorBlue, objActual.Inspect())
+	case *object.Array:
+		items := make([]string, 0, len(objActual.Elements))
+		for i, e := range objActual.Elements {
+			if i == p.MaxItems {
+				break
+			}
+			items = append(items, p.format(e, depth+1))
+		}
+		return p.collection("[", "]", items, len(objActual.Elements), depth)
+	case *object.Hash:
+		pairs := make([]object.HashPair, 0, len(objActual.Pairs))
+		for _, pair := range objActual.Pairs {
+			pairs = append(pairs, pair)
+		}
+		// 按键排序保证输出稳定
+		sort.Slice(pairs, func(i, j int) bool {
+			return pairs[i].Key.Inspect() < pairs[j].Key.Inspect()
+		})
+		items := make([]string, 0, len(pairs))
+		for i, pair := range pairs {
+			if i == p.MaxItems {
+				break
+			}
+			items = append(items, p.format(pair.Key, depth+1)+": "+p.format(pair.Value, depth+1))
+		}
+		return p.collection("{", "}", items, len(pairs), depth)
+	default:
+		return obj.Inspect()
+	}
+}
+
+// collection 拼接集合的元素。total 大于显示的元素个数时追加省略的个数。
+func (p *Printer) collection(open string, close string, items []string, total int, depth int) string {
+	if total > len(items) {
+		items = append(items, p.paint(colorGray, fmt.Sprintf("... (%d more)", total-len(items))))
+	}
+	if len(items) == 0 {
+		return open + close
+	}
+	single := open + strings.Join(items, ", ") + close
+	if !strings.Contains(single, "\n") && visibleWidth(single)+len(p.Indent)*depth <= p.Width {
+		return single
+	}
+	inner := strings.Repeat(p.Indent, depth+1)
+	var out strings.Builder
+	out.WriteString(open + "\n")
+	for _, item := range items {
+		out.WriteString(inner + item + ",\n")
+	}
+	out.WriteString(strings.Repeat(p.Indent, depth) + close)
+	return out.String()
+}
+
+// truncate 截断过长的字符串
+func (p *Printer) truncate(s string) string {
+	if utf8.RuneCountInString(s) <= p.MaxString {
+		return s
+	}
+	runes := []rune(s)
+	return fmt.Sprintf("%s... (%d more chars)", string(runes[:p.MaxString]), len(runes)-p.MaxString)
+}
+
+// paint 在启用颜色时给文本加上颜色
+func (p *Printer) paint(color string, s string) string {
+	if !p.Color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// visibleWidth 计算去掉颜色控制序列之后的字符个数
+func visibleWidth(s string) int {
+	width := 0
+	inEscape := false
+	for _, r := range s {
+		switch {
+		case r == '\x1b':
+			inEscape = true
+		case inEscape:
+			if r == 'm' {
+				inEscape = false
+			}
+		default:
+			width++
+		}
+	}
+	return width
+}
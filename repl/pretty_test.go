@@ -0,0 +1,80 @@
+package repl
+
+import (
+	"github.com/hollykbuck/muskmelon/object"
+	"strings"
+	"testing"
+)
+
+func TestPrinter(t *testing.T) {
+	long, err := object.FromGo(map[string]any{
+		"name":  "muskmelon",
+		"tags":  []string{"interpreter", "monkey", "go"},
+		"stars": 12345,
+		"owner": map[string]any{"login": "hollykbuck", "site": "example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	many, _ := object.FromGo(make([]int, 105))
+	tests := []struct {
+		input    object.Object
+		width    int
+		expected string
+	}{
+		{&object.String{Value: "top"}, 80, "top"},
+		{&object.Array{Elements: []object.Object{&object.String{Value: "a"}, object.NULL}}, 80, `["a", null]`},
+		{&object.Array{}, 80, "[]"},
+		{long, 80, `{
+  "name": "muskmelon",
+  "owner": {"login": "hollykbuck", "site": "example.com"},
+  "stars": 12345,
+  "tags": ["interpreter", "monkey", "go"],
+}`},
+		{long, 40, `{
+  "name": "muskmelon",
+  "owner": {
+    "login": "hollykbuck",
+    "site": "example.com",
+  },
+  "stars": 12345,
+  "tags": ["interpreter", "monkey", "go"],
+}`},
+		{many, 1000, "[" + strings.Repeat("0, ", 100) + "... (5 more)]"},
+		{&object.String{Value: strings.Repeat("x", 1003)}, 80, strings.Repeat("x", 1000) + "... (3 more chars)"},
+	}
+	for _, tt := range tests {
+		printer := NewPrinter(false)
+		printer.Width = tt.width
+		if got := printer.Sprint(tt.input); got != tt.expected {
+			t.Errorf("Sprint wrong.\ngot=%s\nwant=%s", got, tt.expected)
+		}
+	}
+}
+
+func TestPrinterColor(t *testing.T) {
+	printer := NewPrinter(true)
+	got := printer.Sprint(&object.Error{Message: "boom"})
+	if got != colorRed+"ERROR: boom"+colorReset {
+		t.Errorf("error is not red. got=%q", got)
+	}
+	if visibleWidth(printer.Sprint(&object.Integer{Value: 42})) != 2 {
+		t.Errorf("visibleWidth did not ignore escape sequences")
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	input := `let s = "hi"; if (x) { 1 } # "open`
+	got := Highlight(input)
+	expected := colorMagenta + "let" + colorReset + " s = " + colorGreen + `"hi"` + colorReset + "; " +
+		colorMagenta + "if" + colorReset + " (x) { " + colorCyan + "1" + colorReset + " } " +
+		colorRed + "#" + colorReset + " " + colorGreen + `"open` + colorReset
+	if got != expected {
+		t.Errorf("Highlight wrong.\ngot=%q\nwant=%q", got, expected)
+	}
+	got = Highlight("x // note")
+	expected = "x " + colorGray + "// note" + colorReset
+	if got != expected {
+		t.Errorf("Highlight wrong.\ngot=%q\nwant=%q", got, expected)
+	}
+}
@@ -1,13 +1,16 @@
 package repl
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
+	"github.com/hollykbuck/muskmelon/ast"
 	"github.com/hollykbuck/muskmelon/evaluator"
 	"github.com/hollykbuck/muskmelon/lexer"
 	"github.com/hollykbuck/muskmelon/object"
 	"github.com/hollykbuck/muskmelon/parser"
+	"github.com/hollykbuck/muskmelon/repl/lineedit"
 	"io"
+	"strings"
 )
 
 const PROMPT = ">> "
@@ -26,43 +29,160 @@ const MONKEY_FACE = `
     \_____\/
 `
 
+// session 一次 REPL 会话的状态
+type session struct {
+	out         io.Writer
+	printer     *Printer
+	interpreter *evaluator.Interpreter
+	env         *object.Environment
+	// transcript 成功执行并且修改了 environment 的输入，:save 把它们写成可以重放的脚本
+	transcript []string
+	// reader 读取用户输入，调试器暂停时也从这里读取调试命令
+	reader lineReader
+	// debugger :debug 使用的调试器，断点在 :reset 之后保留
+	debugger *evaluator.Debugger
+}
+
+// newSession 创建一个新的会话，puts 输出到 out
+func newSession(out io.Writer) *session {
+	s := &session{out: out, printer: NewPrinter(colorEnabled(out))}
+	s.debugger = evaluator.NewDebugger(s.onStop)
+	s.reset()
+	return s
+}
+
+// reset 丢弃会话中所有的绑定
+func (s *session) reset() {
+	s.interpreter = evaluator.New()
+	s.interpreter.Builtins.Set("puts", evaluator.Puts(s.out))
+	// import 在当前目录中查找模块
+	s.interpreter.Modules = evaluator.NewModules(evaluator.NewOSLoader("."))
+	s.env = object.NewEnvironment()
+	s.transcript = nil
+}
+
+// Options REPL 的启动选项
+type Options struct {
+	// Restore 启动时用于恢复会话的脚本，通常由 :save 生成
+	Restore string
+}
+
+// Start 使用默认选项启动 REPL
 func Start(in io.Reader, out io.Writer) error {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
-	for {
-		_, err := fmt.Fprintf(out, PROMPT)
+	return StartWithOptions(in, out, Options{})
+}
+
+// StartWithOptions 启动 REPL，直到输入结束或者执行 :quit
+func StartWithOptions(in io.Reader, out io.Writer, options Options) error {
+	s := newSession(out)
+	if options.Restore != "" {
+		ok, err := s.restore(options.Restore)
 		if err != nil {
-			return fmt.Errorf("输出失败: %w", err)
-		}
-		scanned := scanner.Scan()
-		if !scanned {
 			return err
 		}
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			err = printParserErrors(out, p.Errors())
-			if err != nil {
-				return err
-			}
+		if !ok {
+			return fmt.Errorf("恢复会话 %s 失败", options.Restore)
+		}
+	}
+	reader := newLineReader(in, out, s)
+	s.reader = reader
+	// buffer 保存还没有写完的多行输入
+	var buffer strings.Builder
+	for {
+		prompt := PROMPT
+		if buffer.Len() > 0 {
+			prompt = CONTINUATION_PROMPT
+		}
+		text, err := reader.ReadLine(prompt)
+		if errors.Is(err, lineedit.ErrInterrupted) {
+			// Ctrl-C 丢弃还没有写完的输入
+			buffer.Reset()
 			continue
 		}
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			_, err = io.WriteString(out, evaluated.Inspect())
-			if err != nil {
-				return err
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// 元命令在 lexer 之前处理
+		if buffer.Len() == 0 && isCommand(text) {
+			err = s.runCommand(text)
+			if errors.Is(err, errQuit) {
+				return nil
 			}
-			_, err = io.WriteString(out, "\n")
 			if err != nil {
 				return err
 			}
+			continue
+		}
+		buffer.WriteString(text)
+		buffer.WriteString("\n")
+		if !IsComplete(buffer.String()) {
+			continue
+		}
+		line := buffer.String()
+		buffer.Reset()
+		err = s.eval(line)
+		if err != nil {
+			return err
 		}
 	}
 }
 
+// eval 解析并执行一段输入，打印结果。
+// 语句逐条执行，出错时出错之前的语句仍然会被记录。
+func (s *session) eval(line string) error {
+	l := lexer.New(line)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return printParserErrors(s.out, p.Errors())
+	}
+	var evaluated object.Object
+	for i, statement := range program.Statements {
+		evaluated = s.interpreter.Eval(&ast.Program{Statements: []ast.Statement{statement}}, s.env)
+		if isError(evaluated) {
+			break
+		}
+		s.record(line, program.Statements, i)
+		if _, ok := statement.(*ast.ReturnStatement); ok {
+			break
+		}
+	}
+	if evaluated != nil {
+		_, err := io.WriteString(s.out, s.printer.Sprint(evaluated))
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(s.out, "\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record 将成功执行的第 i 条语句的源码记录到 transcript 中。
+// 只有 let 语句会影响 environment，其他语句重放时没有意义，不做记录。
+// 语句的源码从它的开始位置到下一条语句的开始位置为止。
+func (s *session) record(src string, statements []ast.Statement, i int) {
+	if _, ok := statements[i].(*ast.LetStatement); !ok {
+		return
+	}
+	end := len(src)
+	if i+1 < len(statements) {
+		end = ast.StatementPos(statements[i+1]).Offset
+	}
+	s.transcript = append(s.transcript, strings.TrimSpace(src[ast.StatementPos(statements[i]).Offset:end]))
+}
+
+// isError 判断 evaluator 的结果是否是错误
+func isError(obj object.Object) bool {
+	_, ok := obj.(*object.Error)
+	return ok
+}
+
 func printParserErrors(out io.Writer, errors []string) error {
 	_, err := io.WriteString(out, MONKEY_FACE)
 	if err != nil {
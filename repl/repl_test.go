@@ -1,8 +1,191 @@
 package repl
 
 import (
+	"bytes"
+	"os"
+	"strings"
 	"testing"
 )
 
 func TestError(t *testing.T) {
 }
+
+// TestStartMultiLine 测试跨越多行的输入在完整之后才会被执行
+func TestStartMultiLine(t *testing.T) {
+	input := "let add = fn(x, y) {\n  x + y\n};\nadd(1,\n2)\n"
+	var out bytes.Buffer
+	if err := Start(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("Start returned error: %s", err)
+	}
+	expected := PROMPT + CONTINUATION_PROMPT + CONTINUATION_PROMPT + PROMPT + CONTINUATION_PROMPT + "3\n" + PROMPT
+	if out.String() != expected {
+		t.Errorf("wrong output.\ngot=%q\nwant=%q", out.String(), expected)
+	}
+}
+
+// TestStartCommands 测试元命令
+func TestStartCommands(t *testing.T) {
+	script := t.TempDir() + "/lib.mk"
+	if err := os.WriteFile(script, []byte("let double = fn(x) { x * 2 };"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":type 1 + 1", "INTEGER\n"},
+		{":tokens let x", "LET        \"let\"\nIDENT      \"x\"\n"},
+		{":ast let x = -1;", "Program \"let\"\n  Statements[0]: LetStatement \"let\"\n    Name: Identifier \"x\"\n    Value: PrefixExpression \"-\"\n      Right: IntegerLiteral \"1\"\n"},
+		{"let b = 2;\nlet a = 1;\n:env", "a = 1\nb = 2\n"},
+		{":load " + script + "\ndouble(4)", "loaded " + script + "\n" + PROMPT + "8\n"},
+		{"let a = 1;\n:reset\n:env", "session reset\n" + PROMPT},
+		{":nope", "unknown command :nope, type :help for a list of commands\n"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := Start(strings.NewReader(tt.input+"\n:quit\nunreachable\n"), &out); err != nil {
+			t.Fatalf("Start returned error: %s", err)
+		}
+		got := strings.TrimPrefix(out.String(), strings.Repeat(PROMPT, strings.Count(tt.input, "\n")))
+		got = strings.TrimPrefix(got, PROMPT)
+		got = strings.TrimSuffix(got, PROMPT)
+		if got != tt.expected {
+			t.Errorf("wrong output for %q.\ngot=%q\nwant=%q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	s := newSession(&bytes.Buffer{})
+	if err := s.eval("let length = 1; let lever = 2;"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"le", "len,length,let,lever"},
+		{"1 + leng", "length"},
+		{"pu", "puts"},
+		{"ret", "return"},
+		{":lo", "load"},
+		{"1 + ", ""},
+	}
+	for _, tt := range tests {
+		candidates, _ := s.complete([]rune(tt.line), len([]rune(tt.line)))
+		if got := strings.Join(candidates, ","); got != tt.expected {
+			t.Errorf("complete(%q) wrong. got=%q, want=%q", tt.line, got, tt.expected)
+		}
+	}
+}
+
+// TestSaveRestore 测试保存会话并在新的会话中恢复
+func TestSaveRestore(t *testing.T) {
+	path := t.TempDir() + "/session.mk"
+	input := "let double = fn(x) {\n  x * 2\n};\n1 + 1\nlet broken = 1 + true;\nlet four = double(2);\n:save " + path + "\n"
+	var out bytes.Buffer
+	if err := Start(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("Start returned error: %s", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "let double = fn(x) {\n  x * 2\n};\nlet four = double(2);\n"
+	if string(content) != expected {
+		t.Errorf("wrong session file.\ngot=%q\nwant=%q", content, expected)
+	}
+
+	out.Reset()
+	err = StartWithOptions(strings.NewReader("double(four)\n:save "+path+"\n"), &out, Options{Restore: path})
+	if err != nil {
+		t.Fatalf("StartWithOptions returned error: %s", err)
+	}
+	if !strings.HasPrefix(out.String(), "restored "+path+"\n"+PROMPT+"8\n") {
+		t.Errorf("session was not restored. got=%q", out.String())
+	}
+	content, _ = os.ReadFile(path)
+	if string(content) != expected {
+		t.Errorf("restored session was not saved again.\ngot=%q\nwant=%q", content, expected)
+	}
+
+	out.Reset()
+	if err := Start(strings.NewReader("let a = 1;\n:restore "+path+"\n:env\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "restored "+path+"\n"+PROMPT+"double = ") || strings.Contains(out.String(), "a = 1") {
+		t.Errorf(":restore did not reset the session. got=%q", out.String())
+	}
+}
+
+// TestRestoreFailure 恢复失败时保留原来的会话
+func TestRestoreFailure(t *testing.T) {
+	dir := t.TempDir()
+	broken := dir + "/broken.mk"
+	if err := os.WriteFile(broken, []byte("let b = 2;\nlet c = 1 + true;\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{dir + "/missing.mk", broken} {
+		var out bytes.Buffer
+		if err := Start(strings.NewReader("let a = 1;\n:restore "+path+"\n:env\n:save "+dir+"/saved.mk\n"), &out); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(out.String(), "restored") || !strings.Contains(out.String(), "a = 1\n") || strings.Contains(out.String(), "b = 2") {
+			t.Errorf("failed :restore %s changed the session. got=%q", path, out.String())
+		}
+		content, _ := os.ReadFile(dir + "/saved.mk")
+		if string(content) != "let a = 1;\n" {
+			t.Errorf("transcript changed by failed :restore %s. got=%q", path, content)
+		}
+	}
+}
+
+// TestRecordStatements 同一行中出错之前的 let 语句仍然会被记录
+func TestRecordStatements(t *testing.T) {
+	path := t.TempDir() + "/session.mk"
+	input := "let a = 1; a + true\nlet b = a + 1; let c = b + true; let d = 4;\nlet e = 5; return e; let f = 6;\n:save " + path + "\n"
+	var out bytes.Buffer
+	if err := Start(strings.NewReader(input), &out); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "let a = 1;\nlet b = a + 1;\nlet e = 5;\n"
+	if string(content) != expected {
+		t.Errorf("wrong session file.\ngot=%q\nwant=%q", content, expected)
+	}
+}
+
+// TestRestoreOptionFailure 启动时恢复会话失败返回错误
+func TestRestoreOptionFailure(t *testing.T) {
+	dir := t.TempDir()
+	broken := dir + "/broken.mk"
+	if err := os.WriteFile(broken, []byte("let c = 1 + true;\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{dir + "/missing.mk", broken} {
+		var out bytes.Buffer
+		if err := StartWithOptions(strings.NewReader("1\n"), &out, Options{Restore: path}); err == nil {
+			t.Errorf("expected error for -restore %s, got output %q", path, out.String())
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/m.mk", []byte("export let x = 1;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// :reset 之后的会话仍然可以 import
+	input := "import \"" + dir + "/m\"[\"x\"]\n:reset\nimport \"" + dir + "/m\"[\"x\"] + 1\n"
+	var out bytes.Buffer
+	if err := Start(strings.NewReader(input), &out); err != nil {
+		t.Fatal(err)
+	}
+	expected := PROMPT + "1\n" + PROMPT + "session reset\n" + PROMPT + "2\n" + PROMPT
+	if out.String() != expected {
+		t.Errorf("wrong output.\ngot=%q\nwant=%q", out.String(), expected)
+	}
+}
@@ -0,0 +1,101 @@
+package repl
+
+import (
+	"github.com/hollykbuck/muskmelon/evaluator"
+	"github.com/hollykbuck/muskmelon/lexer"
+	"github.com/hollykbuck/muskmelon/object"
+	"github.com/hollykbuck/muskmelon/parser"
+	"github.com/hollykbuck/muskmelon/types"
+	"strings"
+)
+
+// ParseError 源码中存在语法错误
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string {
+	return "parser errors:\n\t" + strings.Join(e.Errors, "\n\t")
+}
+
+// RuntimeError 运行时产生了 object.Error
+type RuntimeError struct {
+	Err *object.Error
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Err.Inspect()
+}
+
+// TypeError 类型推导发现了一定会在运行时出错的代码
+type TypeError struct {
+	Errors []types.Error
+}
+
+func (e *TypeError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.String()
+	}
+	return "type errors:\n\t" + strings.Join(messages, "\n\t")
+}
+
+// Check 在运行之前推导脚本的类型，脚本中的 args 是字符串数组。
+// 返回不一定会在运行时出错的警告。语法错误返回 *ParseError，类型错误返回 *TypeError。
+func Check(src string) ([]types.Error, error) {
+	p := parser.New(lexer.New(StripShebang(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+	result := types.Check(program, map[string]types.Type{"args": types.Array(types.String)})
+	if len(result.Errors) != 0 {
+		return result.Warnings, &TypeError{Errors: result.Errors}
+	}
+	return result.Warnings, nil
+}
+
+// Execute 在 env 中解析并运行一段完整的源码。interpreter 的 Tracer 同时跟踪解析过程。
+// 语法错误返回 *ParseError，运行时错误返回 *RuntimeError。
+func Execute(interpreter *evaluator.Interpreter, env *object.Environment, src string) (object.Object, error) {
+	l := lexer.New(StripShebang(src))
+	p := parser.New(l)
+	p.SetTracer(interpreter.Tracer)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+	evaluated := interpreter.Eval(program, env)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		return nil, &RuntimeError{Err: errObj}
+	}
+	return evaluated, nil
+}
+
+// StripShebang 去掉脚本第一行的 #! 解释器声明。
+// 只去掉内容、保留换行，不影响后续代码的行号。
+func StripShebang(src string) string {
+	if !strings.HasPrefix(src, "#!") {
+		return src
+	}
+	if idx := strings.IndexByte(src, '\n'); idx >= 0 {
+		return src[idx:]
+	}
+	return ""
+}
+
+// ScriptArgs 将命令行参数转换为脚本中的 args 数组
+func ScriptArgs(args []string) *object.Array {
+	elements := make([]object.Object, len(args))
+	for i, arg := range args {
+		elements[i] = &object.String{Value: arg}
+	}
+	return &object.Array{Elements: elements}
+}
+
+// NewScriptEnvironment 创建运行脚本的 environment，绑定 args
+func NewScriptEnvironment(args []string) *object.Environment {
+	env := object.NewEnvironment()
+	env.Set("args", ScriptArgs(args))
+	return env
+}
@@ -0,0 +1,71 @@
+package repl
+
+import (
+	"errors"
+	"github.com/hollykbuck/muskmelon/evaluator"
+	"testing"
+)
+
+func TestExecute(t *testing.T) {
+	src := "#!/usr/bin/env muskmelon\nlet first = args[0];\nfirst + \"!\""
+	result, err := Execute(evaluator.New(), NewScriptEnvironment([]string{"hi"}), src)
+	if err != nil {
+		t.Fatalf("Execute returned error: %s", err)
+	}
+	if result.Inspect() != "hi!" {
+		t.Errorf("wrong result. got=%q", result.Inspect())
+	}
+}
+
+func TestExecuteErrors(t *testing.T) {
+	_, err := Execute(evaluator.New(), NewScriptEnvironment(nil), "let = 1;")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Errorf("expected ParseError. got=%T (%v)", err, err)
+	}
+	_, err = Execute(evaluator.New(), NewScriptEnvironment(nil), "1 + true")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected RuntimeError. got=%T (%v)", err, err)
+	}
+	if runtimeErr.Err.Message != "type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error message. got=%q", runtimeErr.Err.Message)
+	}
+}
+
+func TestStripShebang(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"#!/usr/bin/env muskmelon\n1", "\n1"},
+		{"#!/usr/bin/env muskmelon", ""},
+		{"1\n#!x", "1\n#!x"},
+	}
+	for _, tt := range tests {
+		if got := StripShebang(tt.input); got != tt.expected {
+			t.Errorf("StripShebang(%q) wrong. got=%q, want=%q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	if _, err := Check("#!/usr/bin/env muskmelon\nlet first = args[0];\nfirst + \"!\""); err != nil {
+		t.Errorf("Check returned error: %s", err)
+	}
+	warnings, err := Check("let f = fn(x) { x - 1 };\nf(args[0])")
+	if err != nil || len(warnings) != 1 || warnings[0].String() != "2:2: argument 1: cannot use string as int" {
+		t.Errorf("Check warnings wrong. got=%v, err=%v", warnings, err)
+	}
+	var typeErr *TypeError
+	if _, err := Check("let first = args[0];\nfirst - 1"); !errors.As(err, &typeErr) {
+		t.Fatalf("expected *TypeError, got %v", err)
+	}
+	if got := typeErr.Errors[0].String(); got != "2:7: type mismatch: string - int" {
+		t.Errorf("type error wrong. got=%q", got)
+	}
+	var parseErr *ParseError
+	if _, err := Check("let = 1"); !errors.As(err, &parseErr) {
+		t.Errorf("expected *ParseError, got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package repl
+
+import (
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/evaluator"
+	"github.com/hollykbuck/muskmelon/lexer"
+	"github.com/hollykbuck/muskmelon/object"
+	"github.com/hollykbuck/muskmelon/parser"
+	"github.com/hollykbuck/muskmelon/token"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 测试文件的约定：文件名以 TEST_FILE_SUFFIX 结尾，
+// 顶层的 let testXxx = fn() { ... } 是测试函数，Xxx 不能以小写字母开头。
+const (
+	TEST_FILE_SUFFIX = "_test.mk"
+	TEST_PREFIX      = "test"
+)
+
+// TestResult 一个测试函数的运行结果
+type TestResult struct {
+	Name string
+	// Pos 测试函数定义的位置
+	Pos token.Position
+	// Err 测试返回的错误，通过时为 nil
+	Err      *object.Error
+	Duration time.Duration
+}
+
+// Passed 测试是否通过
+func (r TestResult) Passed() bool {
+	return r.Err == nil
+}
+
+// FailurePos 失败的位置。错误带有位置时是产生错误的调用，否则是测试函数定义的位置。
+func (r TestResult) FailurePos() token.Position {
+	if r.Err != nil && r.Err.Pos.IsValid() {
+		return r.Err.Pos
+	}
+	return r.Pos
+}
+
+// IsTestName 判断顶层函数的名字是否表示测试函数
+func IsTestName(name string) bool {
+	if !strings.HasPrefix(name, TEST_PREFIX) {
+		return false
+	}
+	if len(name) == len(TEST_PREFIX) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(name[len(TEST_PREFIX):])
+	return !unicode.IsLower(r)
+}
+
+// RunTests 运行一个测试文件：先执行顶层代码，然后按定义的顺序不带参数调用测试函数。
+// 测试函数共享顶层的 environment。match 不为 nil 时只运行名字满足 match 的测试。
+// 语法错误返回 *ParseError，顶层代码出错返回 *RuntimeError。
+func RunTests(interpreter *evaluator.Interpreter, src string, match func(name string) bool) ([]TestResult, error) {
+	p := parser.New(lexer.New(StripShebang(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+	return RunTestProgram(interpreter, program, match)
+}
+
+// RunTestProgram 与 RunTests 相同，运行已经解析好的测试文件。顶层代码出错返回 *RuntimeError。
+func RunTestProgram(interpreter *evaluator.Interpreter, program *ast.Program, match func(name string) bool) ([]TestResult, error) {
+	env := NewScriptEnvironment(nil)
+	if errObj, ok := interpreter.Eval(program, env).(*object.Error); ok {
+		return nil, &RuntimeError{Err: errObj}
+	}
+	var results []TestResult
+	seen := make(map[string]bool)
+	for _, statement := range program.Statements {
+		let, ok := statement.(*ast.LetStatement)
+		// 同名的测试函数只运行一次，使用最后绑定的值
+		if !ok || !IsTestName(let.Name.Value) || seen[let.Name.Value] {
+			continue
+		}
+		seen[let.Name.Value] = true
+		if _, ok := let.Value.(*ast.FunctionLiteral); !ok {
+			continue
+		}
+		if match != nil && !match(let.Name.Value) {
+			continue
+		}
+		fn, ok := env.Get(let.Name.Value)
+		if !ok {
+			continue
+		}
+		start := time.Now()
+		result := TestResult{Name: let.Name.Value, Pos: let.Token.Pos}
+		if errObj, ok := interpreter.Apply(fn).(*object.Error); ok {
+			result.Err = errObj
+		}
+		result.Duration = time.Since(start)
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,76 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hollykbuck/muskmelon/evaluator"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testFile = `let add = fn(a, b) { a + b };
+let testAdd = fn() {
+	assertEq(add(1, 2), 3);
+};
+let testFails = fn() {
+	assert(true);
+	assertEq(add(1, 1), 3, "one plus one");
+};
+let testUnknown = fn() { missing };
+let testing = fn() { assert(false) };
+let testArgs = fn(t) { 1 };
+let testValue = 1;
+`
+
+func TestRunTests(t *testing.T) {
+	results, err := RunTests(evaluator.New(), testFile, nil)
+	if err != nil {
+		t.Fatalf("RunTests returned error: %s", err)
+	}
+	var got []string
+	for _, result := range results {
+		line := result.Name + " ok"
+		if !result.Passed() {
+			line = fmt.Sprintf("%s %s %s", result.Name, result.FailurePos(), result.Err.Message)
+		}
+		got = append(got, line)
+	}
+	expected := []string{
+		"testAdd ok",
+		"testFails 7:2 assertion failed: one plus one: got 2, want 3",
+		"testUnknown 9:1 identifier not found: missing",
+		"testArgs 11:1 wrong number of arguments. got=0, want=1",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("results wrong.\ngot=%q\nwant=%q", got, expected)
+	}
+	results, err = RunTests(evaluator.New(), testFile, func(name string) bool { return strings.HasSuffix(name, "Add") })
+	if err != nil || len(results) != 1 || results[0].Name != "testAdd" {
+		t.Errorf("match not applied. got=%+v, %v", results, err)
+	}
+}
+
+func TestRunTestsErrors(t *testing.T) {
+	_, err := RunTests(evaluator.New(), "let = 1", nil)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Errorf("expected ParseError. got=%T (%v)", err, err)
+	}
+	_, err = RunTests(evaluator.New(), "let testA = fn() { 1 };\nassert(false, \"setup\")", nil)
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.Err.Message != "assertion failed: setup" || runtimeErr.Err.Pos.Line != 2 {
+		t.Errorf("expected RuntimeError from top level. got=%T (%v)", err, err)
+	}
+}
+
+func TestIsTestName(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"test": true, "testAdd": true, "test_add": true, "test2": true,
+		"testing": false, "Test": false, "add": false,
+	} {
+		if IsTestName(name) != expected {
+			t.Errorf("IsTestName(%q) wrong. want=%t", name, expected)
+		}
+	}
+}
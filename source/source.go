@@ -0,0 +1,36 @@
+// Package source 查找 muskfmt、musklint 和 muskmelon test 等命令行工具要处理的源文件。
+package source
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// EXT 源文件的后缀
+const EXT = ".mk"
+
+// IsSource 判断文件是否是源文件
+func IsSource(path string) bool {
+	return filepath.Ext(path) == EXT
+}
+
+// Walk 按字典序对 root 中 match 返回 true 的文件调用 fn，fn 返回错误时停止遍历。
+// 直接指定的文件不检查 match。遍历目录时跳过隐藏目录，例如 .git。
+func Walk(root string, match func(path string) bool, fn func(path string) error) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if path != root && !match(path) {
+			return nil
+		}
+		return fn(path)
+	})
+}
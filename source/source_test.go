@@ -0,0 +1,51 @@
+package source
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.mk", "b.txt", "lib/c.mk", "lib/c_test.mk", ".git/d.mk", "lib/.cache/e.mk"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	isTest := func(path string) bool { return strings.HasSuffix(path, "_test.mk") }
+	tests := []struct {
+		root     string
+		match    func(string) bool
+		expected []string
+	}{
+		{dir, IsSource, []string{"a.mk", "lib/c.mk", "lib/c_test.mk"}},
+		{dir, isTest, []string{"lib/c_test.mk"}},
+		// 直接指定的文件和隐藏目录不受限制
+		{filepath.Join(dir, "b.txt"), IsSource, []string{"b.txt"}},
+		{filepath.Join(dir, ".git"), IsSource, []string{".git/d.mk"}},
+	}
+	for _, tt := range tests {
+		var files []string
+		err := Walk(tt.root, tt.match, func(path string) error {
+			rel, err := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(files, tt.expected) {
+			t.Errorf("%s: files wrong. got=%v, want=%v", tt.root, files, tt.expected)
+		}
+	}
+	if err := Walk(filepath.Join(dir, "missing"), IsSource, func(string) error { return nil }); !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+}
@@ -1,15 +1,46 @@
 package token
 
+import (
+	"fmt"
+	"sort"
+)
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	// Pos token 第一个字符在源码中的位置
+	Pos Position
+}
+
+// Position 源码中的位置
+type Position struct {
+	// Offset 字节偏移，从 0 开始
+	Offset int
+	// Line 行号，从 1 开始
+	Line int
+	// Column 列号，按字符计算，从 1 开始
+	Column int
+}
+
+// IsValid 判断位置是否有效。手动构造的 token 没有位置信息。
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	// COMMENT 注释，从 // 开始到行尾，源码开头的 #! 行也是注释。lexer 不会把注释交给 parser
+	COMMENT = "COMMENT"
 	// Identifiers + literals
 
 	// IDENT identifiers
@@ -47,6 +78,8 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
 	STRING   = "STRING"
 )
 
@@ -58,6 +91,8 @@ var keywords = map[string]TokenType{
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"import": IMPORT,
+	"export": EXPORT,
 }
 
 // LookupIdent 检查 keyword 表
@@ -69,3 +104,13 @@ func LookupIdent(ident string) TokenType {
 	}
 	return IDENT
 }
+
+// Keywords 返回所有关键字，按字典序排序
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
@@ -0,0 +1,217 @@
+// Package trace 定义 parser 和 evaluator 共用的跟踪接口。
+// Tracer 按每次运行挂载，收到的是结构化的事件，可以写成文本或者 JSON Lines，也可以记录下来检查。
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/object"
+	"github.com/hollykbuck/muskmelon/token"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Phase 产生事件的阶段
+type Phase string
+
+const (
+	PhaseParse Phase = "parse"
+	PhaseEval  Phase = "eval"
+)
+
+// Kind 事件的类型
+type Kind string
+
+const (
+	// KindEnter 开始解析一条规则或者开始计算一个节点
+	KindEnter Kind = "enter"
+	// KindExit 规则解析完成或者节点计算完成，Node、Value 和 Err 是结果
+	KindExit Kind = "exit"
+)
+
+// Event 一条跟踪事件
+type Event struct {
+	Phase Phase
+	Kind  Kind
+	// Name parser 中是解析规则的名字，evaluator 中是节点的类型名
+	Name string
+	// Depth 嵌套深度，从 0 开始
+	Depth int
+	Pos   token.Position
+	// Node parser 中是解析出的节点，evaluator 中是正在计算的节点，可能是 nil
+	Node ast.Node
+	// Value evaluator 计算出的值，只在 KindExit 事件中设置
+	Value object.Object
+	// Err 解析这条规则时记录的语法错误或者计算出的运行时错误
+	Err string
+}
+
+// Tracer 接收跟踪事件。同一次运行的事件按顺序在同一个 goroutine 中发送。
+type Tracer interface {
+	Trace(e Event)
+}
+
+// Func 把函数转换成 Tracer
+type Func func(e Event)
+
+func (f Func) Trace(e Event) { f(e) }
+
+// NodeName 节点的类型名，例如 "InfixExpression"。nil 节点返回 "nil"。
+func NodeName(node ast.Node) string {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return "nil"
+	}
+	t := reflect.TypeOf(node)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// NodePos 节点第一个 token 的位置，没有位置信息时返回零值
+func NodePos(node ast.Node) token.Position {
+	if node == nil {
+		return token.Position{}
+	}
+	v := reflect.ValueOf(node)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return token.Position{}
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return token.Position{}
+	}
+	if f := v.FieldByName("Token"); f.IsValid() {
+		if tok, ok := f.Interface().(token.Token); ok {
+			return tok.Pos
+		}
+	}
+	// Program 没有 Token，使用第一条语句的位置
+	if program, ok := node.(*ast.Program); ok && len(program.Statements) > 0 {
+		return NodePos(program.Statements[0])
+	}
+	return token.Position{}
+}
+
+// nodeString 节点的源码形式，nil 节点返回空字符串
+func nodeString(node ast.Node) string {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return ""
+	}
+	return node.String()
+}
+
+// Writer 把事件按深度缩进写成文本，每个事件一行：
+//
+//	eval 1:1 > InfixExpression
+//	eval 1:1 < InfixExpression = 3
+type Writer struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// NewWriter Writer 的构造函数
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (t *Writer) Trace(e Event) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-5s %-7s %s", e.Phase, e.Pos, strings.Repeat("  ", e.Depth))
+	if e.Kind == KindEnter {
+		fmt.Fprintf(&b, "> %s", e.Name)
+	} else {
+		fmt.Fprintf(&b, "< %s", e.Name)
+		switch {
+		case e.Err != "":
+			fmt.Fprintf(&b, " ! %s", e.Err)
+		case e.Value != nil:
+			fmt.Fprintf(&b, " = %s", e.Value.Inspect())
+		case e.Phase == PhaseParse && nodeString(e.Node) != "":
+			fmt.Fprintf(&b, " %s", nodeString(e.Node))
+		}
+	}
+	b.WriteByte('\n')
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, _ = io.WriteString(t.w, b.String())
+}
+
+// jsonEvent JSONWriter 写出的一行
+type jsonEvent struct {
+	Phase  Phase  `json:"phase"`
+	Kind   Kind   `json:"kind"`
+	Name   string `json:"name"`
+	Depth  int    `json:"depth"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	Node   string `json:"node,omitempty"`
+	Value  string `json:"value,omitempty"`
+	Type   string `json:"type,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// JSONWriter 把事件写成 JSON Lines，每个事件一个 JSON 对象
+type JSONWriter struct {
+	enc *json.Encoder
+	mu  sync.Mutex
+}
+
+// NewJSONWriter JSONWriter 的构造函数
+func NewJSONWriter(w io.Writer) *JSONWriter {
+	return &JSONWriter{enc: json.NewEncoder(w)}
+}
+
+func (t *JSONWriter) Trace(e Event) {
+	out := jsonEvent{
+		Phase:  e.Phase,
+		Kind:   e.Kind,
+		Name:   e.Name,
+		Depth:  e.Depth,
+		Line:   e.Pos.Line,
+		Column: e.Pos.Column,
+		Error:  e.Err,
+	}
+	if e.Kind == KindExit {
+		out.Node = nodeString(e.Node)
+	}
+	if e.Value != nil {
+		out.Value, out.Type = e.Value.Inspect(), string(e.Value.Type())
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_ = t.enc.Encode(out)
+}
+
+// Recorder 把事件记录在内存中
+type Recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *Recorder) Trace(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+// Events 返回记录的事件
+func (r *Recorder) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Event(nil), r.events...)
+}
+
+// Multi 把事件依次发送给多个 Tracer
+func Multi(tracers ...Tracer) Tracer {
+	return Func(func(e Event) {
+		for _, t := range tracers {
+			t.Trace(e)
+		}
+	})
+}
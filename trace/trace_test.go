@@ -0,0 +1,87 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/object"
+	"github.com/hollykbuck/muskmelon/token"
+	"testing"
+)
+
+func testEvents() []Event {
+	node := &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "5", Pos: token.Position{Offset: 4, Line: 1, Column: 5}}, Value: 5}
+	return []Event{
+		{Phase: PhaseEval, Kind: KindEnter, Name: NodeName(node), Depth: 1, Pos: NodePos(node), Node: node},
+		{Phase: PhaseEval, Kind: KindExit, Name: NodeName(node), Depth: 1, Pos: NodePos(node), Node: node, Value: &object.Integer{Value: 5}},
+		{Phase: PhaseEval, Kind: KindExit, Name: "Identifier", Err: "identifier not found: x"},
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, e := range testEvents() {
+		w.Trace(e)
+	}
+	expected := "eval  1:5       > IntegerLiteral\n" +
+		"eval  1:5       < IntegerLiteral = 5\n" +
+		"eval  -       < Identifier ! identifier not found: x\n"
+	if buf.String() != expected {
+		t.Errorf("output wrong.\ngot=%q\nwant=%q", buf.String(), expected)
+	}
+}
+
+func TestJSONWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewJSONWriter(&buf)
+	for _, e := range testEvents() {
+		w.Trace(e)
+	}
+	dec := json.NewDecoder(&buf)
+	var got []jsonEvent
+	for dec.More() {
+		var e jsonEvent
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e)
+	}
+	expected := []jsonEvent{
+		{Phase: PhaseEval, Kind: KindEnter, Name: "IntegerLiteral", Depth: 1, Line: 1, Column: 5},
+		{Phase: PhaseEval, Kind: KindExit, Name: "IntegerLiteral", Depth: 1, Line: 1, Column: 5, Node: "5", Value: "5", Type: "INTEGER"},
+		{Phase: PhaseEval, Kind: KindExit, Name: "Identifier", Error: "identifier not found: x"},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("wrong number of events. got=%d", len(got))
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("event %d wrong.\ngot=%+v\nwant=%+v", i, got[i], expected[i])
+		}
+	}
+}
+
+func TestNodeHelpers(t *testing.T) {
+	var nilStatement *ast.LetStatement
+	if NodeName(nilStatement) != "nil" || NodeName(nil) != "nil" {
+		t.Errorf("NodeName of nil node wrong")
+	}
+	if NodePos(nilStatement).IsValid() {
+		t.Errorf("NodePos of nil node should be invalid")
+	}
+	program := &ast.Program{Statements: []ast.Statement{
+		&ast.ReturnStatement{Token: token.Token{Type: token.RETURN, Pos: token.Position{Line: 2, Column: 3}}},
+	}}
+	if NodeName(program) != "Program" || NodePos(program).String() != "2:3" {
+		t.Errorf("Program helpers wrong. name=%s pos=%s", NodeName(program), NodePos(program))
+	}
+}
+
+func TestMulti(t *testing.T) {
+	var a, b Recorder
+	Multi(&a, &b).Trace(Event{Name: "x"})
+	if len(a.Events()) != 1 || len(b.Events()) != 1 {
+		t.Errorf("Multi did not forward events")
+	}
+}
@@ -0,0 +1,715 @@
+package types
+
+import (
+	"fmt"
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/token"
+	"sort"
+)
+
+// Builtins 内置函数的类型。没有列出的内置函数和找不到的名字都当作 any。
+// 名字与 evaluator.DefaultBuiltins 一致，增加内置函数时需要同时修改这里。
+var Builtins = map[string]Type{
+	"len":  Func([]Type{Any}, Int),
+	"puts": Any,
+	// 断言的说明参数是可选的
+	"assert":      Any,
+	"assertEq":    Any,
+	"assertError": Any,
+}
+
+// Error 一处类型错误
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e Error) String() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+// Result 类型推导的结果
+type Result struct {
+	// Errors 按位置排序的类型错误
+	Errors []Error
+	// Warnings 按位置排序的警告，与推导出的参数类型冲突，运行时可能出错
+	Warnings []Error
+	// Types 每个表达式推导出的类型
+	Types map[ast.Expression]Type
+	// Bindings 顶层 let 绑定的类型
+	Bindings map[string]*Scheme
+}
+
+// TypeOf 返回表达式的类型，表达式没有被推导过时返回 nil
+func (r *Result) TypeOf(e ast.Expression) Type {
+	return r.Types[e]
+}
+
+// Check 推导程序的类型。globals 是运行前已经绑定的名字的类型，可以为 nil。
+func Check(program *ast.Program, globals map[string]Type) *Result {
+	c := &checker{
+		result: &Result{Types: make(map[ast.Expression]Type), Bindings: make(map[string]*Scheme)},
+		params: make(map[*Var]bool),
+	}
+	builtins := newEnv(nil)
+	for name, t := range Builtins {
+		builtins.set(name, &Scheme{Type: t})
+	}
+	for name, t := range globals {
+		builtins.set(name, &Scheme{Type: t})
+	}
+	env := newEnv(builtins)
+	env.collectLets(program.Statements)
+	for _, statement := range program.Statements {
+		c.statement(env, statement)
+	}
+	for name, scheme := range env.names {
+		c.result.Bindings[name] = scheme
+	}
+	for _, errors := range [][]Error{c.result.Errors, c.result.Warnings} {
+		sort.SliceStable(errors, func(i, j int) bool {
+			return errors[i].Pos.Offset < errors[j].Pos.Offset
+		})
+	}
+	return c.result
+}
+
+// env 名字到类型的映射。程序和每个函数体各是一个作用域，与运行时的 Environment 对应。
+type env struct {
+	outer *env
+	names map[string]*Scheme
+	// lets 作用域中每个名字的 let 语句的位置，包括 if 块中的 let
+	lets map[string][]int
+}
+
+func newEnv(outer *env) *env {
+	return &env{outer: outer, names: make(map[string]*Scheme), lets: make(map[string][]int)}
+}
+
+// collectLets 记录作用域中的 let 语句，不进入函数字面量
+func (e *env) collectLets(statements []ast.Statement) {
+	for _, statement := range statements {
+		ast.Inspect(statement, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.LetStatement:
+				e.lets[n.Name.Value] = append(e.lets[n.Name.Value], n.Token.Pos.Offset)
+			case *ast.FunctionLiteral:
+				return false
+			}
+			return true
+		})
+	}
+}
+
+// reboundAfter 作用域中是否有 offset 之后绑定 name 的 let 语句
+func (e *env) reboundAfter(name string, offset int) bool {
+	for _, let := range e.lets[name] {
+		if let > offset {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *env) set(name string, s *Scheme) {
+	e.names[name] = s
+}
+
+func (e *env) get(name string) (*Scheme, bool) {
+	s, _ := e.lookup(name)
+	return s, s != nil
+}
+
+// lookup 返回名字的类型和绑定名字的作用域，找不到时都为 nil
+func (e *env) lookup(name string) (*Scheme, *env) {
+	for ; e != nil; e = e.outer {
+		if s, ok := e.names[name]; ok {
+			return s, e
+		}
+	}
+	return nil, nil
+}
+
+// snapshot 复制作用域中的绑定
+func (e *env) snapshot() map[string]*Scheme {
+	names := make(map[string]*Scheme, len(e.names))
+	for name, s := range e.names {
+		names[name] = s
+	}
+	return names
+}
+
+type checker struct {
+	result *Result
+	// nextID 下一个类型变量的编号
+	nextID int
+	// level 当前 let 的嵌套层数，用于泛化
+	level int
+	// trail 被确定的类型变量，用于撤销尝试失败的统一
+	trail []*Var
+	// returns 正在推导的函数中 return 语句的类型，栈顶是最内层的函数
+	returns []Type
+	// params 正在推导的函数的未标注参数的类型变量
+	params map[*Var]bool
+}
+
+func (c *checker) errorf(pos token.Position, format string, args ...interface{}) {
+	c.result.Errors = append(c.result.Errors, Error{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+// mismatch 报告类型冲突，types 是冲突涉及的类型。
+// 冲突涉及推导出的参数类型时不一定会在运行时出错：正在推导的函数的参数退化为 any，不报告；
+// 其余的参数类型来自已经推导完的函数，报告为警告。不涉及推导出的参数类型时报告为错误。
+func (c *checker) mismatch(pos token.Position, types []Type, format string, args ...interface{}) {
+	var params []*Var
+	for _, t := range types {
+		params = append(params, inferred(t)...)
+	}
+	if len(params) == 0 {
+		c.errorf(pos, format, args...)
+		return
+	}
+	open := false
+	for _, v := range params {
+		if c.params[v] {
+			v.instance = Any
+			open = true
+		}
+	}
+	if !open {
+		c.result.Warnings = append(c.result.Warnings, Error{Pos: pos, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+// inferred 返回 t 的绑定链上未标注参数的类型变量
+func inferred(t Type) []*Var {
+	var params []*Var
+	for {
+		v, ok := t.(*Var)
+		if !ok {
+			return params
+		}
+		if v.param {
+			params = append(params, v)
+		}
+		if v.instance == nil {
+			return params
+		}
+		t = v.instance
+	}
+}
+
+func (c *checker) fresh() *Var {
+	c.nextID++
+	return &Var{id: c.nextID, level: c.level}
+}
+
+// statement 推导语句，返回语句的值的类型
+func (c *checker) statement(e *env, statement ast.Statement) Type {
+	switch s := statement.(type) {
+	case *ast.LetStatement:
+		c.let(e, s)
+		return Null
+	case *ast.ReturnStatement:
+		t := Type(Null)
+		if s.ReturnValue != nil {
+			t = c.expression(e, s.ReturnValue)
+		}
+		if len(c.returns) > 0 {
+			top := len(c.returns) - 1
+			c.returns[top] = c.join(c.returns[top], t)
+		}
+		// return 之后的代码不会执行，语句的值可以是任何类型
+		return c.fresh()
+	case *ast.ExpressionStatement:
+		if s.Expression == nil {
+			return Null
+		}
+		return c.expression(e, s.Expression)
+	}
+	return Any
+}
+
+// let 推导 let 语句并泛化绑定的类型。
+// 函数的名字在推导函数体之前绑定为单态的类型变量，使递归调用可以被推导。
+func (c *checker) let(e *env, s *ast.LetStatement) {
+	c.level++
+	var t Type
+	if fn, ok := s.Value.(*ast.FunctionLiteral); ok {
+		self := c.fresh()
+		e.set(s.Name.Value, &Scheme{Type: self})
+		t = c.expression(e, fn)
+		if err := c.unify(self, t); err != nil {
+			t = Any
+		}
+	} else {
+		t = c.expression(e, s.Value)
+	}
+	if s.Type != nil {
+		c.expect(s.Type, t, "let "+s.Name.Value)
+	}
+	c.level--
+	e.set(s.Name.Value, c.generalize(t))
+}
+
+// block 推导块中的语句，返回最后一条语句的值的类型
+func (c *checker) block(e *env, b *ast.BlockStatement) Type {
+	t := Type(Null)
+	for _, statement := range b.Statements {
+		t = c.statement(e, statement)
+	}
+	return t
+}
+
+// expression 推导表达式的类型并记录到结果中
+func (c *checker) expression(e *env, expression ast.Expression) Type {
+	t := c.infer(e, expression)
+	c.result.Types[expression] = t
+	return t
+}
+
+func (c *checker) infer(e *env, expression ast.Expression) Type {
+	switch n := expression.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.Boolean:
+		return Bool
+	case *ast.StringLiteral:
+		return String
+	case *ast.Identifier:
+		s, scope := e.lookup(n.Value)
+		if s == nil {
+			return Any
+		}
+		// 闭包在调用时才查找外层的名字，外层之后重新绑定的名字在调用时可能是任何类型
+		if scope != e && scope.reboundAfter(n.Value, n.Token.Pos.Offset) {
+			return Any
+		}
+		return c.instantiate(s)
+	case *ast.PrefixExpression:
+		return c.prefix(e, n)
+	case *ast.InfixExpression:
+		return c.infix(e, n)
+	case *ast.IfExpression:
+		c.expression(e, n.Condition)
+		// if 的块与外层共享作用域，两个分支分别从 if 之前的绑定开始推导，之后合并
+		before := e.snapshot()
+		t := c.block(e, n.Consequence)
+		consequence := e.names
+		e.names = before
+		alternative := Type(Null)
+		if n.Alternative != nil {
+			e.names = e.snapshot()
+			alternative = c.block(e, n.Alternative)
+		}
+		e.names = c.mergeBranches(before, consequence, e.names)
+		return c.join(t, alternative)
+	case *ast.FunctionLiteral:
+		return c.function(e, n)
+	case *ast.CallExpression:
+		return c.call(e, n)
+	case *ast.ArrayLiteral:
+		elem := Type(c.fresh())
+		for _, element := range n.Elements {
+			elem = c.join(elem, c.expression(e, element))
+		}
+		return Array(elem)
+	case *ast.IndexExpression:
+		return c.index(e, n)
+	}
+	return Any
+}
+
+// mergeBranches 合并 if 两个分支之后的绑定。
+// 分支中重新绑定的名字取两个分支的类型，不一致或者只在一个分支中绑定时退化为 any。
+func (c *checker) mergeBranches(before, consequence, alternative map[string]*Scheme) map[string]*Scheme {
+	merged := make(map[string]*Scheme, len(before))
+	for name, s := range before {
+		merged[name] = s
+	}
+	for _, branch := range []map[string]*Scheme{consequence, alternative} {
+		for name := range branch {
+			a, b := consequence[name], alternative[name]
+			switch {
+			case a == b:
+				merged[name] = a
+			case a == nil || b == nil:
+				merged[name] = &Scheme{Type: Any}
+			default:
+				merged[name] = &Scheme{Type: c.join(c.instantiate(a), c.instantiate(b))}
+			}
+		}
+	}
+	return merged
+}
+
+func (c *checker) prefix(e *env, n *ast.PrefixExpression) Type {
+	right := c.expression(e, n.Right)
+	switch n.Operator {
+	case "!":
+		return Bool
+	case "-":
+		if c.unify(right, Int) != nil {
+			c.mismatch(n.Token.Pos, []Type{right}, "unknown operator: -%s", Format(right))
+			return Any
+		}
+		return Int
+	}
+	return Any
+}
+
+// infix 推导中缀表达式，规则与 evalInfixExpression 一致：
+// == 和 != 可以比较任意两个值，+ 用于整数和字符串，其余运算符只用于整数。
+func (c *checker) infix(e *env, n *ast.InfixExpression) Type {
+	left := c.expression(e, n.Left)
+	right := c.expression(e, n.Right)
+	switch n.Operator {
+	case "==", "!=":
+		return Bool
+	case "+":
+		if c.unify(left, right) != nil {
+			c.operatorError(n, left, right, []Type{left, right})
+			return Any
+		}
+		switch t := prune(left).(type) {
+		case *Var:
+			return t
+		case *Con:
+			if t.Name == INT || t.Name == STRING || t.Name == ANY {
+				return t
+			}
+		}
+		// 两边的类型相同，只有两边都是推导出的参数类型时才不一定出错
+		if len(inferred(left)) == 0 {
+			c.operatorError(n, left, right, []Type{left})
+		} else {
+			c.operatorError(n, left, right, []Type{right})
+		}
+		return Any
+	case "-", "*", "/", "<", ">":
+		result := Int
+		if n.Operator == "<" || n.Operator == ">" {
+			result = Bool
+		}
+		mark := len(c.trail)
+		var failed []Type
+		if c.unify(left, Int) != nil {
+			failed = append(failed, left)
+		}
+		if c.unify(right, Int) != nil {
+			failed = append(failed, right)
+		}
+		if len(failed) != 0 {
+			c.undo(mark)
+			c.operatorError(n, left, right, failed)
+			return Any
+		}
+		return result
+	}
+	return Any
+}
+
+// operatorError 两边类型确定且不同时报告类型不匹配，否则报告运算符不支持。
+// failed 是不符合运算符要求的一边或两边的类型。
+func (c *checker) operatorError(n *ast.InfixExpression, left Type, right Type, failed []Type) {
+	l, r := prune(left), prune(right)
+	_, leftVar := l.(*Var)
+	_, rightVar := r.(*Var)
+	f := &formatter{names: make(map[*Var]string)}
+	if !leftVar && !rightVar && f.format(l) != f.format(r) {
+		c.mismatch(n.Token.Pos, failed, "type mismatch: %s %s %s", f.format(l), n.Operator, f.format(r))
+		return
+	}
+	c.mismatch(n.Token.Pos, failed, "unknown operator: %s %s %s", f.format(l), n.Operator, f.format(r))
+}
+
+// function 推导函数字面量，返回值的类型是所有 return 语句和函数体最后一条语句的类型
+func (c *checker) function(outer *env, n *ast.FunctionLiteral) Type {
+	e := newEnv(outer)
+	e.collectLets(n.Body.Statements)
+	params := make([]Type, len(n.Parameters))
+	var open []*Var
+	for i, param := range n.Parameters {
+		var t Type
+		if i < len(n.ParameterTypes) && n.ParameterTypes[i] != nil {
+			t = c.annotation(n.ParameterTypes[i])
+		} else {
+			v := c.fresh()
+			v.param = true
+			c.params[v] = true
+			open = append(open, v)
+			t = v
+		}
+		params[i] = t
+		e.set(param.Value, &Scheme{Type: t})
+	}
+	c.returns = append(c.returns, c.fresh())
+	body := c.block(e, n.Body)
+	result := c.join(c.returns[len(c.returns)-1], body)
+	c.returns = c.returns[:len(c.returns)-1]
+	for _, v := range open {
+		delete(c.params, v)
+	}
+	if n.ReturnType != nil {
+		result = c.expect(n.ReturnType, result, "return value")
+	}
+	return Func(params, result)
+}
+
+// annotation 把类型标注转换为类型。hash 和 fn 没有对应的类型，当作 any 处理。
+func (c *checker) annotation(a *ast.TypeAnnotation) Type {
+	switch a.Name {
+	case "int":
+		return Int
+	case "string":
+		return String
+	case "bool":
+		return Bool
+	case "null":
+		return Null
+	case "array":
+		if a.Elem != nil {
+			return Array(c.annotation(a.Elem))
+		}
+		return Array(c.fresh())
+	}
+	return Any
+}
+
+// expect 检查类型是否符合类型标注，错误信息与运行时的类型检查一致。
+// 返回标注的类型，不符合时报告错误并返回 any。
+func (c *checker) expect(a *ast.TypeAnnotation, t Type, what string) Type {
+	expected := c.annotation(a)
+	mark := len(c.trail)
+	if err := c.unify(t, expected); err != nil {
+		c.undo(mark)
+		c.mismatch(a.Token.Pos, []Type{t}, "type error: %s expects %s, got %s", what, a, Format(t))
+		return Any
+	}
+	return expected
+}
+
+// call 推导函数调用。参数少于形参会在运行时出错，多余的参数会被忽略。
+func (c *checker) call(e *env, n *ast.CallExpression) Type {
+	callee := c.expression(e, n.Function)
+	args := make([]Type, len(n.Arguments))
+	for i, argument := range n.Arguments {
+		args[i] = c.expression(e, argument)
+	}
+	switch t := prune(callee).(type) {
+	case *Var:
+		result := c.fresh()
+		if err := c.unify(t, Func(args, result)); err != nil {
+			return Any
+		}
+		return result
+	case *Con:
+		switch t.Name {
+		case ANY:
+			return Any
+		case FUNC:
+		default:
+			c.mismatch(n.Token.Pos, []Type{callee}, "not a function: %s", Format(t))
+			return Any
+		}
+		params, result := t.Args[:len(t.Args)-1], t.Args[len(t.Args)-1]
+		if len(args) < len(params) {
+			c.mismatch(n.Token.Pos, []Type{callee}, "wrong number of arguments. got=%d, want=%d", len(args), len(params))
+			return Any
+		}
+		for i, param := range params {
+			if err := c.unify(param, args[i]); err != nil {
+				c.mismatch(n.Token.Pos, []Type{callee, param, args[i]}, "argument %d: cannot use %s as %s", i+1, Format(args[i]), Format(param))
+				return Any
+			}
+		}
+		if ident, ok := n.Function.(*ast.Identifier); ok && ident.Value == "len" && callee == Builtins["len"] {
+			c.checkLen(n, args[0])
+		}
+		return result
+	}
+	return Any
+}
+
+// checkLen len 只接受字符串和数组
+func (c *checker) checkLen(n *ast.CallExpression, arg Type) {
+	if t, ok := prune(arg).(*Con); ok {
+		switch t.Name {
+		case STRING, ARRAY, ANY:
+		default:
+			c.mismatch(n.Token.Pos, []Type{arg}, "argument to `len` not supported, got %s", Format(t))
+		}
+	}
+}
+
+// index 推导索引表达式。下标不是整数的数组索引和对非集合类型的索引在运行时会出错。
+func (c *checker) index(e *env, n *ast.IndexExpression) Type {
+	left := c.expression(e, n.Left)
+	index := c.expression(e, n.Index)
+	switch t := prune(left).(type) {
+	case *Var:
+		elem := c.fresh()
+		if c.unify(t, Array(elem)) != nil || c.unify(index, Int) != nil {
+			return Any
+		}
+		return elem
+	case *Con:
+		switch t.Name {
+		case ANY:
+			return Any
+		case ARRAY:
+			if c.unify(index, Int) != nil {
+				c.mismatch(n.Token.Pos, []Type{left, index}, "index operator not supported: %s[%s]", Format(t), Format(index))
+				return Any
+			}
+			return t.Args[0]
+		}
+		c.mismatch(n.Token.Pos, []Type{left}, "index operator not supported: %s", Format(t))
+	}
+	return Any
+}
+
+// join 尝试统一两个类型，失败时撤销统一并返回 any
+func (c *checker) join(a Type, b Type) Type {
+	mark := len(c.trail)
+	if c.unify(a, b) != nil {
+		c.undo(mark)
+		return Any
+	}
+	if prune(b) == Any {
+		return Any
+	}
+	return a
+}
+
+// undo 撤销 mark 之后确定的类型变量
+func (c *checker) undo(mark int) {
+	for _, v := range c.trail[mark:] {
+		v.instance = nil
+	}
+	c.trail = c.trail[:mark]
+}
+
+// unify 统一两个类型，any 可以与任何类型统一
+func (c *checker) unify(a Type, b Type) error {
+	a, b = prune(a), prune(b)
+	if a == b {
+		return nil
+	}
+	if v, ok := a.(*Var); ok {
+		return c.bind(v, b)
+	}
+	if v, ok := b.(*Var); ok {
+		return c.bind(v, a)
+	}
+	ca, cb := a.(*Con), b.(*Con)
+	if ca.Name == ANY || cb.Name == ANY {
+		return nil
+	}
+	if ca.Name != cb.Name || len(ca.Args) != len(cb.Args) {
+		return fmt.Errorf("cannot unify %s with %s", Format(a), Format(b))
+	}
+	for i := range ca.Args {
+		if err := c.unify(ca.Args[i], cb.Args[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bind 确定类型变量，同时把 t 中类型变量的层数降到 v 的层数
+func (c *checker) bind(v *Var, t Type) error {
+	if occurs(v, t) {
+		return fmt.Errorf("recursive type %s", Format(t))
+	}
+	adjustLevels(t, v.level)
+	v.instance = t
+	c.trail = append(c.trail, v)
+	return nil
+}
+
+func occurs(v *Var, t Type) bool {
+	switch t := prune(t).(type) {
+	case *Var:
+		return t == v
+	case *Con:
+		for _, arg := range t.Args {
+			if occurs(v, arg) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func adjustLevels(t Type, level int) {
+	switch t := prune(t).(type) {
+	case *Var:
+		if t.level > level {
+			t.level = level
+		}
+	case *Con:
+		for _, arg := range t.Args {
+			adjustLevels(arg, level)
+		}
+	}
+}
+
+// generalize 把层数高于当前层数的类型变量变为多态的
+func (c *checker) generalize(t Type) *Scheme {
+	s := &Scheme{Type: t}
+	seen := make(map[*Var]bool)
+	var collect func(t Type)
+	collect = func(t Type) {
+		switch t := prune(t).(type) {
+		case *Var:
+			if t.level > c.level && !seen[t] {
+				seen[t] = true
+				s.Vars = append(s.Vars, t)
+			}
+		case *Con:
+			for _, arg := range t.Args {
+				collect(arg)
+			}
+		}
+	}
+	collect(t)
+	return s
+}
+
+// instantiate 把多态的类型变量替换为新的类型变量
+func (c *checker) instantiate(s *Scheme) Type {
+	if len(s.Vars) == 0 {
+		return s.Type
+	}
+	mapping := make(map[*Var]Type, len(s.Vars))
+	for _, v := range s.Vars {
+		mapping[v] = c.fresh()
+	}
+	var copyType func(t Type) Type
+	copyType = func(t Type) Type {
+		// 保留推导出的参数类型，调用处的冲突据此报告为警告
+		if v, ok := t.(*Var); ok && v.param && v.instance != nil {
+			c.nextID++
+			return &Var{id: c.nextID, level: c.level, instance: copyType(v.instance), param: true}
+		}
+		switch t := prune(t).(type) {
+		case *Var:
+			if replacement, ok := mapping[t]; ok {
+				return replacement
+			}
+			return t
+		case *Con:
+			if len(t.Args) == 0 {
+				return t
+			}
+			args := make([]Type, len(t.Args))
+			for i, arg := range t.Args {
+				args[i] = copyType(arg)
+			}
+			return &Con{Name: t.Name, Args: args}
+		}
+		return t
+	}
+	return copyType(s.Type)
+}
@@ -0,0 +1,169 @@
+package types
+
+import (
+	"github.com/hollykbuck/muskmelon/ast"
+	"github.com/hollykbuck/muskmelon/evaluator"
+	"github.com/hollykbuck/muskmelon/lexer"
+	"github.com/hollykbuck/muskmelon/parser"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func check(t *testing.T, input string, globals map[string]Type) (*ast.Program, *Result) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program, Check(program, globals)
+}
+
+func TestInferBindings(t *testing.T) {
+	tests := []struct {
+		input    string
+		name     string
+		expected string
+	}{
+		{"let x = 5;", "x", "int"},
+		{`let s = "a" + "b";`, "s", "string"},
+		{"let b = !5;", "b", "bool"},
+		{"let id = fn(x) { x };", "id", "fn(a) -> a"},
+		{"let id = fn(x) { x }; let n = id(1); let s = id(\"a\");", "s", "string"},
+		{"let add = fn(a, b) { a + b };", "add", "fn(a, a) -> a"},
+		{"let sub = fn(a, b) { a - b };", "sub", "fn(int, int) -> int"},
+		{"let first = fn(xs) { xs[0] };", "first", "fn([a]) -> a"},
+		{"let xs = [1, 2, 3];", "xs", "[int]"},
+		{`let xs = [1, "two"];`, "xs", "[any]"},
+		{"let f = fn(x) { if (x) { 1 } else { 2 } };", "f", "fn(a) -> int"},
+		{`let f = fn(x) { if (x) { 1 } else { "a" } };`, "f", "fn(a) -> any"},
+		{"let f = fn(x) { if (x) { 1 } };", "f", "fn(a) -> any"},
+		{"let fact = fn(n) { if (n < 2) { return 1; } n * fact(n - 1) };", "fact", "fn(int) -> int"},
+		{"let f = fn(n) { return n; 1 };", "f", "fn(int) -> int"},
+		{"let compose = fn(f, g) { fn(x) { g(f(x)) } };", "compose", "fn(fn(a) -> b, fn(b) -> c) -> fn(a) -> c"},
+		{"let n = len(\"abc\");", "n", "int"},
+		{"let r = puts(1);", "r", "any"},
+		{"let first = args[0];", "first", "string"},
+		{"let x: int = 5;", "x", "int"},
+		{"let f = fn(a: string, b) { b };", "f", "fn(string, a) -> a"},
+		{"let f = fn(a): bool { a };", "f", "fn(bool) -> bool"},
+		{"let f = fn(xs: array) { xs };", "f", "fn([a]) -> [a]"},
+		{"let f = fn(xs: [[int]]) { xs[0] };", "f", "fn([[int]]) -> [int]"},
+		{"let f = fn(g: fn) { g(1) };", "f", "fn(any) -> any"},
+	}
+	for _, tt := range tests {
+		_, result := check(t, tt.input, map[string]Type{"args": Array(String)})
+		if len(result.Errors) != 0 {
+			t.Errorf("%q: unexpected errors %v", tt.input, result.Errors)
+			continue
+		}
+		scheme, ok := result.Bindings[tt.name]
+		if !ok {
+			t.Errorf("%q: %s is not bound", tt.input, tt.name)
+			continue
+		}
+		if got := scheme.String(); got != tt.expected {
+			t.Errorf("%q: type of %s wrong. got=%q, want=%q", tt.input, tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestInferErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`"a" - 1`, []string{"1:5: type mismatch: string - int"}},
+		{`"a" - "b"`, []string{"1:5: unknown operator: string - string"}},
+		{"true + false", []string{"1:6: unknown operator: bool + bool"}},
+		{`1 + "a"`, []string{"1:3: type mismatch: int + string"}},
+		{"-true", []string{"1:1: unknown operator: -bool"}},
+		{"let f = fn(x) { true + x };", []string{"1:22: unknown operator: bool + bool"}},
+		{"let f = fn(a, b) { a }; f(1);", []string{"1:26: wrong number of arguments. got=1, want=2"}},
+		{"let f = fn(a) { a }; f(1, 2);", nil},
+		{"5(1)", []string{"1:2: not a function: int"}},
+		{"len(1)", []string{"1:4: argument to `len` not supported, got int"}},
+		{`[1, 2]["a"]`, []string{"1:7: index operator not supported: [int][string]"}},
+		{"1[0]", []string{"1:2: index operator not supported: int"}},
+		{"let f = fn(x) { x + 1 }; let y = f(2) - \"a\";", []string{"1:39: type mismatch: int - string"}},
+		{`if (true) { 1 } else { "a" } - 1`, nil},
+		{"unknown + 1; unknown(1)[2]", nil},
+		{"1 == \"a\"", nil},
+		{`let x: int = "a";`, []string{"1:8: type error: let x expects int, got string"}},
+		{`let f = fn(a: string) { a - 1 };`, []string{"1:27: type mismatch: string - int"}},
+		{`let f = fn(a: string) { a }; f(1);`, []string{"1:31: argument 1: cannot use int as string"}},
+		{`let f = fn(): int { "a" };`, []string{"1:15: type error: return value expects int, got string"}},
+		{`let x: any = 1; let y: [string] = [];`, nil},
+		// if 块中的 let 重新绑定外层的名字，分支之后的类型是两种可能的合并
+		{`let c = false; let x = 1; if (c) { let x = "s"; 0 }; puts(x + 1)`, nil},
+		{`let c = false; let x = 1; if (c) { let x = 2; 0 }; x + "a"`, []string{"1:54: type mismatch: int + string"}},
+		// 闭包在调用时查找外层的名字，之后重新绑定的名字是 any
+		{`let x = "a"; let f = fn() { x }; let x = 1; puts(f() + 1)`, nil},
+		{`let x = "a"; let f = fn() { x }; f() - 1`, []string{"1:38: type mismatch: string - int"}},
+	}
+	for _, tt := range tests {
+		_, result := check(t, tt.input, nil)
+		var got []string
+		for _, err := range result.Errors {
+			got = append(got, err.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%q: errors wrong.\ngot=%q\nwant=%q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestInferWarnings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`let f = fn(x) { x * 2 }; f("a");`, []string{"1:27: argument 1: cannot use string as int"}},
+		{`let f = fn(x, y) { x * y }; f(1, "a");`, []string{"1:30: argument 2: cannot use string as int"}},
+		// y 被泛化，调用时复制出的参数类型仍然是推导出的
+		{`let f = fn(x, y) { [x * 2, y] }; f("a", 1);`, []string{"1:35: argument 1: cannot use string as int"}},
+		// 参数的用法在不同的分支中，函数体中的冲突使参数退化为 any
+		{`let f = fn(x, y) { if (y) { x - 1 } else { len(x) } }; f("ab", false)`, nil},
+		{"let f = fn(x) { x - 1; len(x) }; f(1)", nil},
+		// 没有泛化的函数参数可以用于不同类型的参数
+		{`let id = fn(x) { x }; let pair = fn(f) { [f(1), f("a")] }; pair(id)`, nil},
+	}
+	for _, tt := range tests {
+		_, result := check(t, tt.input, nil)
+		if len(result.Errors) != 0 {
+			t.Errorf("%q: unexpected errors %v", tt.input, result.Errors)
+		}
+		var got []string
+		for _, err := range result.Warnings {
+			got = append(got, err.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%q: warnings wrong.\ngot=%q\nwant=%q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestTypeOf(t *testing.T) {
+	program, result := check(t, "let f = fn(x) { x + 1 }; f(2) < 3", nil)
+	statement := program.Statements[1].(*ast.ExpressionStatement)
+	infix := statement.Expression.(*ast.InfixExpression)
+	if got := Format(result.TypeOf(infix)); got != "bool" {
+		t.Errorf("type of %s wrong. got=%q", infix, got)
+	}
+	if got := Format(result.TypeOf(infix.Left)); got != "int" {
+		t.Errorf("type of %s wrong. got=%q", infix.Left, got)
+	}
+}
+
+// TestBuiltinsMatchEvaluator 检查 Builtins 与 evaluator 中的内置函数一致
+func TestBuiltinsMatchEvaluator(t *testing.T) {
+	var names []string
+	for name := range Builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if expected := evaluator.DefaultBuiltins().Names(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Builtins wrong. got=%v, want=%v", names, expected)
+	}
+}
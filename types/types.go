@@ -0,0 +1,145 @@
+// Package types 对 AST 做 Hindley-Milner 风格的类型推导。
+// 推导在运行之前进行，只报告一定会在运行时出错的类型错误。
+// 语言本身是动态类型的，无法统一的地方（例如 if 的两个分支类型不同）退化为 any，不会报错。
+// 同样退化为 any 的还有 if 两个分支绑定为不同类型的名字，以及闭包捕获之后又被重新绑定的名字。
+// 未标注的参数的类型是从函数体中的用法推导出来的，用法可能在不会执行的分支中，
+// 与推导出的参数类型冲突时运行时不一定出错：函数体中的冲突使参数退化为 any，调用处的冲突报告为警告。
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Type 类型，*Var 或者 *Con
+type Type interface {
+	String() string
+	typeNode()
+}
+
+// Var 类型变量。instance 不为 nil 时类型变量已经被确定为 instance。
+type Var struct {
+	id       int
+	level    int
+	instance Type
+	// param 是否是未标注的参数的类型，或者从它复制出来的类型变量
+	param bool
+}
+
+func (v *Var) typeNode() {}
+
+func (v *Var) String() string {
+	return Format(v)
+}
+
+// Con 类型构造器，例如 int、[int] 和 fn(int) -> int。
+// 函数类型的 Args 是参数类型，最后一个是返回值类型。
+type Con struct {
+	Name string
+	Args []Type
+}
+
+func (c *Con) typeNode() {}
+
+func (c *Con) String() string {
+	return Format(c)
+}
+
+// 类型构造器的名字
+const (
+	INT    = "int"
+	BOOL   = "bool"
+	STRING = "string"
+	NULL   = "null"
+	ANY    = "any"
+	ARRAY  = "array"
+	FUNC   = "fn"
+)
+
+// 基本类型
+var (
+	Int    Type = &Con{Name: INT}
+	Bool   Type = &Con{Name: BOOL}
+	String Type = &Con{Name: STRING}
+	Null   Type = &Con{Name: NULL}
+	// Any 可以与任何类型统一，表示推导不出的类型
+	Any Type = &Con{Name: ANY}
+)
+
+// Array 元素类型为 elem 的数组
+func Array(elem Type) Type {
+	return &Con{Name: ARRAY, Args: []Type{elem}}
+}
+
+// Func 函数类型
+func Func(params []Type, result Type) Type {
+	args := make([]Type, 0, len(params)+1)
+	args = append(args, params...)
+	return &Con{Name: FUNC, Args: append(args, result)}
+}
+
+// prune 沿着已经确定的类型变量找到实际的类型
+func prune(t Type) Type {
+	for {
+		v, ok := t.(*Var)
+		if !ok || v.instance == nil {
+			return t
+		}
+		t = v.instance
+	}
+}
+
+// Format 输出类型，没有确定的类型变量按出现的顺序命名为 a、b、c……
+func Format(t Type) string {
+	f := &formatter{names: make(map[*Var]string)}
+	return f.format(t)
+}
+
+type formatter struct {
+	names map[*Var]string
+}
+
+func (f *formatter) format(t Type) string {
+	switch t := prune(t).(type) {
+	case *Var:
+		name, ok := f.names[t]
+		if !ok {
+			name = varName(len(f.names))
+			f.names[t] = name
+		}
+		return name
+	case *Con:
+		switch t.Name {
+		case ARRAY:
+			return "[" + f.format(t.Args[0]) + "]"
+		case FUNC:
+			params := make([]string, len(t.Args)-1)
+			for i, param := range t.Args[:len(t.Args)-1] {
+				params[i] = f.format(param)
+			}
+			return fmt.Sprintf("fn(%s) -> %s", strings.Join(params, ", "), f.format(t.Args[len(t.Args)-1]))
+		default:
+			return t.Name
+		}
+	}
+	return "?"
+}
+
+// varName 第 i 个类型变量的名字：a……z，然后是 a1……
+func varName(i int) string {
+	name := string(rune('a' + i%26))
+	if i >= 26 {
+		name += fmt.Sprint(i / 26)
+	}
+	return name
+}
+
+// Scheme 多态类型，Vars 中的类型变量在每次使用时被替换为新的类型变量
+type Scheme struct {
+	Vars []*Var
+	Type Type
+}
+
+func (s *Scheme) String() string {
+	return Format(s.Type)
+}